@@ -0,0 +1,279 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxRecentAuditEntries is the number of audit entries kept in memory for recent-audit.
+const maxRecentAuditEntries = 1000
+
+// Audit actions other than runtime control changes
+const (
+	// AuditActionCall records a tool call that was allowed to run.
+	AuditActionCall = "call"
+	// AuditActionDeny records a tool call or resource read denied by a policy.
+	AuditActionDeny = "deny"
+	// AuditActionRead records a resource read; Tool is the tool that produced the resource.
+	AuditActionRead = "read"
+)
+
+// AuditEntry records a tool call, or a change of the profiled process's state.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Identity is the authenticated identity of the caller, if any.
+	Identity string `json:"identity,omitempty"`
+	// Tool is the tool that was called, the tool that produced a resource that was read,
+	// or "ttl" for automatic reverts.
+	Tool string `json:"tool"`
+	// Action is AuditActionCall, AuditActionDeny, or the change that was made, e.g. "set gogc" or "gc".
+	Action string `json:"action"`
+	// Detail describes a change or denial, e.g. "100 -> 50, reverts in 5m0s", or the URI of a resource read.
+	Detail string `json:"detail,omitempty"`
+	// Arguments are the arguments of a tool call.
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	// Duration is how long a tool call took.
+	Duration time.Duration `json:"duration_ns,omitempty"`
+	// ResultBytes is the size of the text returned by a tool call.
+	ResultBytes int `json:"result_bytes,omitempty"`
+	// Error is the error returned by a tool call, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// AuditSink receives audit entries, e.g. to write them to a log or a file.
+// Write is called for every entry and must be safe for concurrent use.
+type AuditSink interface {
+	Write(e AuditEntry) error
+}
+
+// WithAuditSink sends audit entries to the given sinks. Every tool call, policy
+// denial and runtime control change is recorded. Without a sink, entries are only
+// kept in memory for the recent-audit tool.
+func WithAuditSink(sinks ...AuditSink) Option {
+	return func(c *config) {
+		c.auditSinks = append(c.auditSinks, sinks...)
+	}
+}
+
+// slogAuditSink writes audit entries as structured log records.
+type slogAuditSink struct {
+	logger *slog.Logger
+}
+
+// NewSlogAuditSink returns an audit sink that writes each entry as an "audit"
+// record at info level, or at warn level for denials and failed calls.
+func NewSlogAuditSink(logger *slog.Logger) AuditSink {
+	return &slogAuditSink{logger: logger}
+}
+
+func (s *slogAuditSink) Write(e AuditEntry) error {
+	level := slog.LevelInfo
+	if e.Action == AuditActionDeny || e.Error != "" {
+		level = slog.LevelWarn
+	}
+	attrs := []slog.Attr{
+		slog.String("identity", e.Identity),
+		slog.String("tool", e.Tool),
+		slog.String("action", e.Action),
+	}
+	if e.Detail != "" {
+		attrs = append(attrs, slog.String("detail", e.Detail))
+	}
+	if len(e.Arguments) > 0 {
+		attrs = append(attrs, slog.Any("arguments", e.Arguments))
+	}
+	if e.Action == AuditActionCall || e.Action == AuditActionRead {
+		attrs = append(attrs, slog.Duration("duration", e.Duration), slog.Int("result_bytes", e.ResultBytes))
+	}
+	if e.Error != "" {
+		attrs = append(attrs, slog.String("error", e.Error))
+	}
+	s.logger.LogAttrs(context.Background(), level, "audit", attrs...)
+	return nil
+}
+
+// JSONLinesAuditSink writes audit entries as JSON lines.
+type JSONLinesAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLinesAuditSink returns an audit sink that writes each entry as a line of JSON to w.
+func NewJSONLinesAuditSink(w io.Writer) *JSONLinesAuditSink {
+	return &JSONLinesAuditSink{w: w}
+}
+
+// OpenAuditFile opens (or creates) a file to append audit entries to as JSON lines.
+// The caller closes the file when the server has stopped.
+func OpenAuditFile(path string) (*JSONLinesAuditSink, *os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	return NewJSONLinesAuditSink(f), f, nil
+}
+
+func (s *JSONLinesAuditSink) Write(e AuditEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+// auditLog sends audit entries to the sinks, if any, and keeps the most recent entries in memory.
+type auditLog struct {
+	sinks []AuditSink
+
+	mu     sync.Mutex
+	recent []AuditEntry // ordered from oldest to newest
+}
+
+func newAuditLog(sinks []AuditSink) *auditLog {
+	return &auditLog{sinks: sinks}
+}
+
+// record sends an entry to all sinks and keeps it for recent-audit.
+func (l *auditLog) record(e AuditEntry) {
+	for _, sink := range l.sinks {
+		if err := sink.Write(e); err != nil {
+			log.Printf("audit sink: %v", err)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recent = append(l.recent, e)
+	if len(l.recent) > maxRecentAuditEntries {
+		l.recent = l.recent[len(l.recent)-maxRecentAuditEntries:]
+	}
+}
+
+// list returns up to limit recent entries matching the filter, newest first.
+func (l *auditLog) list(limit int, match func(AuditEntry) bool) []AuditEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var result []AuditEntry
+	for i := len(l.recent) - 1; i >= 0 && len(result) < limit; i-- {
+		if match(l.recent[i]) {
+			result = append(result, l.recent[i])
+		}
+	}
+	return result
+}
+
+// audit records an audit entry.
+func (a *agent) audit(e AuditEntry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	a.auditLog.record(e)
+}
+
+// auditCall runs a tool call and records it with its arguments, duration, result size and error.
+func (a *agent) auditCall(ctx context.Context, request mcp.CallToolRequest, next func() (*mcp.CallToolResult, error)) (*mcp.CallToolResult, error) {
+	start := time.Now()
+	result, err := next()
+
+	identity, _ := identityFromContext(ctx)
+	e := AuditEntry{
+		Time:      start,
+		Identity:  identity,
+		Tool:      request.Params.Name,
+		Action:    AuditActionCall,
+		Arguments: request.Params.Arguments,
+		Duration:  time.Since(start),
+	}
+	if result != nil {
+		text := resultText(result)
+		e.ResultBytes = len(text)
+		if result.IsError {
+			e.Error = text
+		}
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	a.audit(e)
+	return result, err
+}
+
+// resultText returns the text contents of a tool result.
+func resultText(result *mcp.CallToolResult) string {
+	var b strings.Builder
+	for _, c := range result.Content {
+		if t, ok := c.(mcp.TextContent); ok {
+			b.WriteString(t.Text)
+		}
+	}
+	return b.String()
+}
+
+// RecentAuditHandler lists recent audit entries, newest first, optionally
+// filtered by identity, tool and errors.
+func RecentAuditHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+
+	limit := 50
+	if v, ok := request.Params.Arguments["limit"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+	identity, _ := request.Params.Arguments["identity"].(string)
+	tool, _ := request.Params.Arguments["tool"].(string)
+	errorsOnly, _ := request.Params.Arguments["errors_only"].(bool)
+
+	entries := a.auditLog.list(limit, func(e AuditEntry) bool {
+		return (identity == "" || e.Identity == identity) &&
+			(tool == "" || e.Tool == tool) &&
+			(!errorsOnly || e.Error != "" || e.Action == AuditActionDeny)
+	})
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Audit entries (%d, newest first)\n\n", len(entries)))
+	for _, e := range entries {
+		who := e.Identity
+		if who == "" {
+			who = "-"
+		}
+		result.WriteString(fmt.Sprintf("%s %s %s %s", e.Time.Format(time.RFC3339), who, e.Tool, e.Action))
+		if len(e.Arguments) > 0 {
+			args, _ := json.Marshal(e.Arguments)
+			result.WriteString(" " + string(args))
+		}
+		if e.Detail != "" {
+			result.WriteString(": " + e.Detail)
+		}
+		if e.Action == AuditActionCall || e.Action == AuditActionRead {
+			result.WriteString(fmt.Sprintf(" (%s, %s)", e.Duration.Round(time.Microsecond), formatValue(int64(e.ResultBytes))))
+		}
+		if e.Error != "" {
+			result.WriteString(" error: " + firstLine(e.Error))
+		}
+		result.WriteString("\n")
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(result.String()),
+		},
+	}, nil
+}
+
+// firstLine returns the first line of s.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
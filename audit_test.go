@@ -0,0 +1,126 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestRecentAuditHandler(t *testing.T) {
+	var buf bytes.Buffer
+	_, a := newPprofServer(newConfig(WithAuditSink(NewJSONLinesAuditSink(&buf))))
+	ctx := context.WithValue(context.Background(), agentKey{}, a)
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entries := []AuditEntry{
+		{Identity: "alice", Tool: "heap-profile", Action: AuditActionCall, Arguments: map[string]interface{}{"limit": 10.0}, Duration: 2 * time.Millisecond, ResultBytes: 2048},
+		{Identity: "bob", Tool: "cpu-profile", Action: AuditActionDeny, Detail: "bob may not call cpu-profile"},
+		{Identity: "alice", Tool: "cpu-profile", Action: AuditActionCall, Error: "profile error (cpu): busy\ndetails"},
+		{Tool: "ttl", Action: "set gogc", Detail: "50 -> 100"},
+	}
+	for i, e := range entries {
+		e.Time = start.Add(time.Duration(i) * time.Minute)
+		a.audit(e)
+	}
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      []string
+	}{
+		{
+			name: "all",
+			want: []string{
+				"2024-05-01T12:03:00Z - ttl set gogc: 50 -> 100",
+				"2024-05-01T12:02:00Z alice cpu-profile call (0s, 0B) error: profile error (cpu): busy",
+				"2024-05-01T12:01:00Z bob cpu-profile deny: bob may not call cpu-profile",
+				`2024-05-01T12:00:00Z alice heap-profile call {"limit":10} (2ms, 2.00KB)`,
+			},
+		},
+		{
+			name:      "limit",
+			arguments: map[string]interface{}{"limit": 1.0},
+			want:      []string{"2024-05-01T12:03:00Z - ttl set gogc: 50 -> 100"},
+		},
+		{
+			name:      "identity",
+			arguments: map[string]interface{}{"identity": "bob"},
+			want:      []string{"2024-05-01T12:01:00Z bob cpu-profile deny: bob may not call cpu-profile"},
+		},
+		{
+			name:      "tool and errors",
+			arguments: map[string]interface{}{"tool": "cpu-profile", "errors_only": true},
+			want: []string{
+				"2024-05-01T12:02:00Z alice cpu-profile call (0s, 0B) error: profile error (cpu): busy",
+				"2024-05-01T12:01:00Z bob cpu-profile deny: bob may not call cpu-profile",
+			},
+		},
+		{
+			name:      "no match",
+			arguments: map[string]interface{}{"identity": "carol"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request mcp.CallToolRequest
+			request.Params.Arguments = tt.arguments
+			result, err := RecentAuditHandler(ctx, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header, body, _ := strings.Cut(resultText(result), "\n\n")
+			var got []string
+			if body != "" {
+				got = strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("%s\ngot:\n%s\nwant:\n%s", header, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+
+	// Every entry was also written to the sink.
+	var lines int
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e AuditEntry
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		if want := entries[lines]; e.Tool != want.Tool || e.Action != want.Action || e.Identity != want.Identity {
+			t.Errorf("sink entry %d = %+v, want %+v", lines, e, want)
+		}
+		lines++
+	}
+	if lines != len(entries) {
+		t.Errorf("sink has %d entries, want %d", lines, len(entries))
+	}
+}
+
+func TestAuditLogKeepsRecentEntries(t *testing.T) {
+	// Without sinks, entries are only kept in memory.
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	l := newAuditLog(nil)
+	for i := 0; i < maxRecentAuditEntries+10; i++ {
+		l.record(AuditEntry{ResultBytes: i})
+	}
+	if logged.Len() > 0 {
+		t.Errorf("entries were logged:\n%s", logged.String())
+	}
+	all := l.list(maxRecentAuditEntries*2, func(AuditEntry) bool { return true })
+	if len(all) != maxRecentAuditEntries {
+		t.Fatalf("kept %d entries, want %d", len(all), maxRecentAuditEntries)
+	}
+	if newest, oldest := all[0].ResultBytes, all[len(all)-1].ResultBytes; newest != maxRecentAuditEntries+9 || oldest != 10 {
+		t.Errorf("kept entries %d to %d, want 10 to %d", oldest, newest, maxRecentAuditEntries+9)
+	}
+}
@@ -0,0 +1,572 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Default regression check criteria
+const (
+	defaultRegressionThreshold = 10 // percent increase of a function's value
+	defaultRegressionMinShare  = 1  // percent of the current profile's total
+	defaultRegressionSigma     = 3  // standard deviations above sampling noise
+)
+
+// baselineName restricts baseline names to characters that are safe in file names.
+var baselineName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// WithBaselineDir persists named baselines as .pb.gz files in the given directory,
+// so they survive restarts and can be shared between deploys. Existing baselines
+// in the directory are loaded on startup. Without it, baselines are kept in memory.
+func WithBaselineDir(dir string) Option {
+	return func(c *config) {
+		c.baselineDir = dir
+	}
+}
+
+// baselineStore keeps named baseline profiles. Unlike snapshots, baselines are
+// never evicted; saving a baseline under an existing name replaces it.
+type baselineStore struct {
+	mu        sync.Mutex
+	baselines map[string]*Snapshot
+	dir       string
+	// redactor redacts baselines loaded from dir, which may predate the redaction rules.
+	redactor *redactor
+}
+
+// baselineMetaExt is the extension of the file persisted next to each baseline's profile.
+const baselineMetaExt = ".json"
+
+// baselineMeta is persisted as <name>.json next to a baseline's <name>.pb.gz file.
+type baselineMeta struct {
+	// ProfileType is the baseline's profile type, which file names cannot hold
+	// unambiguously: both types and names may contain '-'.
+	ProfileType string `json:"profile_type"`
+}
+
+// newBaselineStore creates a baseline store. If dir is not empty, baselines are
+// persisted there as <name>.pb.gz files with their profile type in <name>.json,
+// and existing files are loaded and redacted with r.
+func newBaselineStore(dir string, r *redactor) *baselineStore {
+	s := &baselineStore{
+		baselines: make(map[string]*Snapshot),
+		dir:       dir,
+		redactor:  r,
+	}
+	if dir != "" {
+		if err := s.load(); err != nil {
+			log.Printf("baseline store: %v", err)
+		}
+	}
+	return s
+}
+
+// load reads existing baseline files from the store directory.
+func (s *baselineStore) load() error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create baseline directory: %w", err)
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read baseline directory: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range entries {
+		file := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(file, snapshotFileExt) {
+			continue
+		}
+		name := strings.TrimSuffix(file, snapshotFileExt)
+		profileType, err := s.readMeta(name)
+		if err != nil {
+			log.Printf("baseline store: skipping %s: %v", file, err)
+			continue
+		}
+		if !baselineName.MatchString(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, file))
+		if err != nil {
+			log.Printf("baseline store: failed to read %s: %v", file, err)
+			continue
+		}
+		if data, err = s.redactor.data(data); err != nil {
+			log.Printf("baseline store: skipping %s: %v", file, err)
+			continue
+		}
+		s.baselines[name] = &Snapshot{
+			ID:          name,
+			ProfileType: profileType,
+			CreatedAt:   info.ModTime(),
+			Size:        len(data),
+			data:        data,
+			file:        file,
+		}
+	}
+	return nil
+}
+
+// readMeta returns the profile type persisted for the named baseline.
+func (s *baselineStore) readMeta(name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, name+baselineMetaExt))
+	if err != nil {
+		return "", err
+	}
+	var meta baselineMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return "", fmt.Errorf("invalid baseline metadata: %w", err)
+	}
+	if meta.ProfileType == "" {
+		return "", fmt.Errorf("baseline metadata has no profile type")
+	}
+	return meta.ProfileType, nil
+}
+
+// Save stores gzipped protobuf profile data as the named baseline.
+func (s *baselineStore) Save(name, profileType string, data []byte) (*Snapshot, error) {
+	if !baselineName.MatchString(name) {
+		return nil, fmt.Errorf("invalid baseline name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	b := &Snapshot{
+		ID:          name,
+		ProfileType: profileType,
+		CreatedAt:   time.Now(),
+		Size:        len(data),
+		data:        data,
+		file:        name + snapshotFileExt,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dir != "" {
+		// The metadata is written first, so every profile file has its type.
+		meta, err := json.Marshal(baselineMeta{ProfileType: profileType})
+		if err != nil {
+			return nil, fmt.Errorf("failed to persist baseline %s: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(s.dir, name+baselineMetaExt), meta, 0o644); err != nil {
+			return nil, fmt.Errorf("failed to persist baseline %s: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(s.dir, b.file), data, 0o644); err != nil {
+			return nil, fmt.Errorf("failed to persist baseline %s: %w", name, err)
+		}
+	}
+	s.baselines[name] = b
+	return b, nil
+}
+
+// Get returns the named baseline.
+func (s *baselineStore) Get(name string) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok := s.baselines[name]; ok {
+		return b, nil
+	}
+	return nil, fmt.Errorf("baseline %q not found", name)
+}
+
+// List returns the baselines sorted by name.
+func (s *baselineStore) List() []*Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]*Snapshot, 0, len(s.baselines))
+	for _, b := range s.baselines {
+		result = append(result, b)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// regressionCriteria are the thresholds a function's change must exceed to count as a regression.
+type regressionCriteria struct {
+	// threshold is the minimum increase over the baseline, in percent.
+	threshold float64
+	// minShare is the minimum share of the current profile's total, in percent.
+	minShare float64
+	// sigma is the minimum number of standard deviations above sampling noise.
+	sigma float64
+	// cumulative compares cumulative instead of flat values.
+	cumulative bool
+	// normalize scales the baseline so its total matches the current profile.
+	normalize bool
+}
+
+// functionStat holds a function's value and sample count in one profile.
+type functionStat struct {
+	value int64
+	count int64
+}
+
+// regression is a function whose value increased beyond the regression criteria.
+type regression struct {
+	Function string
+	Base     float64 // baseline value, scaled when normalizing
+	Current  int64
+	Percent  float64 // increase over the baseline; +Inf for new functions
+	Share    float64 // share of the current total, in percent
+	Sigma    float64 // increase in standard deviations of the sampling noise; NaN if unknown
+}
+
+// regressionReport is the result of comparing a profile against a baseline.
+type regressionReport struct {
+	ValueType    *profile.ValueType
+	BaseTotal    float64
+	CurrentTotal int64
+	Scale        float64
+	Regressions  []regression
+	// CountsKnown is false when the profiles have no raw sample counts to estimate noise from.
+	CountsKnown bool
+}
+
+// checkRegressions compares the per-function values of current against base.
+// The value compared is the one analyze uses (CPU time, allocated or in-use bytes, ...).
+// Sampling noise is estimated by treating raw sample counts as Poisson distributed.
+// Only CPU profiles have them: the object and contention counts of memory, block
+// and mutex profiles are scaled estimates, and goroutine counts are not sampled,
+// so their significance is not tested.
+func checkRegressions(base, current *profile.Profile, profileType string, c regressionCriteria) (*regressionReport, error) {
+	ci := analysisValueIndex(current, profileType)
+	st := current.SampleType[ci]
+	bi := sampleTypeIndex(base, st.Type)
+	if bi < 0 {
+		return nil, fmt.Errorf("baseline has no %s values", st.Type)
+	}
+	cc, bc := sampleCountIndex(current), sampleCountIndex(base)
+
+	bStats, bTotal := functionStats(base, bi, bc, c.cumulative)
+	cStats, cTotal := functionStats(current, ci, cc, c.cumulative)
+
+	report := &regressionReport{
+		ValueType:    st,
+		CurrentTotal: cTotal.value,
+		Scale:        1,
+		CountsKnown:  cc >= 0 && bc >= 0,
+	}
+	if c.normalize && bTotal.value != 0 {
+		report.Scale = float64(cTotal.value) / float64(bTotal.value)
+	}
+	report.BaseTotal = float64(bTotal.value) * report.Scale
+	if cTotal.value <= 0 {
+		return report, nil
+	}
+
+	for name, cur := range cStats {
+		b := bStats[name]
+		baseValue := float64(b.value) * report.Scale
+		delta := float64(cur.value) - baseValue
+		if delta <= 0 {
+			continue
+		}
+		share := float64(cur.value) / float64(cTotal.value) * 100
+		if share < c.minShare {
+			continue
+		}
+		percent := math.Inf(1)
+		if baseValue > 0 {
+			percent = delta / baseValue * 100
+		}
+		if percent < c.threshold {
+			continue
+		}
+		sigma := math.NaN()
+		if report.CountsKnown {
+			// The scale applied to counts follows the scale applied to values.
+			k := report.Scale
+			variance := float64(cur.count) + k*k*float64(b.count)
+			if variance > 0 {
+				sigma = (float64(cur.count) - k*float64(b.count)) / math.Sqrt(variance)
+			}
+			if math.IsNaN(sigma) || sigma < c.sigma {
+				continue
+			}
+		}
+		report.Regressions = append(report.Regressions, regression{
+			Function: name,
+			Base:     baseValue,
+			Current:  cur.value,
+			Percent:  percent,
+			Share:    share,
+			Sigma:    sigma,
+		})
+	}
+	sort.Slice(report.Regressions, func(i, j int) bool {
+		ri, rj := report.Regressions[i], report.Regressions[j]
+		di, dj := float64(ri.Current)-ri.Base, float64(rj.Current)-rj.Base
+		if di != dj {
+			return di > dj
+		}
+		return ri.Function < rj.Function
+	})
+	return report, nil
+}
+
+// functionStats sums the value at idx and the sample count at countIdx (if not negative)
+// per function: of the leaf function for flat values, or of every function on the
+// stack, counted once per sample, for cumulative values. It also returns the totals.
+func functionStats(p *profile.Profile, idx, countIdx int, cumulative bool) (map[string]functionStat, functionStat) {
+	stats := make(map[string]functionStat)
+	var total functionStat
+	for _, s := range p.Sample {
+		var count int64
+		if countIdx >= 0 {
+			count = s.Value[countIdx]
+		}
+		total.value += s.Value[idx]
+		total.count += count
+
+		seen := make(map[string]bool)
+		for _, loc := range s.Location {
+			for _, line := range loc.Line {
+				if line.Function == nil || seen[line.Function.Name] {
+					continue
+				}
+				seen[line.Function.Name] = true
+				st := stats[line.Function.Name]
+				st.value += s.Value[idx]
+				st.count += count
+				stats[line.Function.Name] = st
+				if !cumulative {
+					break
+				}
+			}
+			if !cumulative && len(seen) > 0 {
+				break
+			}
+		}
+	}
+	return stats, total
+}
+
+// sampleTypeIndex returns the index of the named sample type, or -1.
+func sampleTypeIndex(p *profile.Profile, typ string) int {
+	for i, st := range p.SampleType {
+		if st.Type == typ {
+			return i
+		}
+	}
+	return -1
+}
+
+// sampleCountIndex returns the index of the raw sample count ("samples"), or -1
+// if the profile has none.
+func sampleCountIndex(p *profile.Profile) int {
+	for i, st := range p.SampleType {
+		if st.Type == "samples" && st.Unit == "count" {
+			return i
+		}
+	}
+	return -1
+}
+
+// formatRegressionReport renders the verdict and the regressions of a report.
+func formatRegressionReport(baseline, current *Snapshot, report *regressionReport, c regressionCriteria, limit int) string {
+	var b strings.Builder
+	if len(report.Regressions) == 0 {
+		b.WriteString("Verdict: PASS\n")
+	} else {
+		noun := "regressions"
+		if len(report.Regressions) == 1 {
+			noun = "regression"
+		}
+		fmt.Fprintf(&b, "Verdict: FAIL (%d %s)\n", len(report.Regressions), noun)
+	}
+	fmt.Fprintf(&b, "Baseline: %s (%s profile, saved %s)\n", baseline.ID, baseline.ProfileType, baseline.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Current: %s\n", current.ID)
+
+	values := "flat"
+	if c.cumulative {
+		values = "cumulative"
+	}
+	fmt.Fprintf(&b, "Criteria: %s %s up by %.4g%% or more, at least %.4g%% of the current total",
+		values, report.ValueType.Type, c.threshold, c.minShare)
+	if report.CountsKnown {
+		fmt.Fprintf(&b, ", %.4g sigma above sampling noise\n", c.sigma)
+	} else {
+		b.WriteString(" (no raw sample counts, significance not tested)\n")
+	}
+
+	st := report.ValueType
+	fmt.Fprintf(&b, "Total: %s -> %s", formatAnalysisValue(int64(report.BaseTotal), st), formatAnalysisValue(report.CurrentTotal, st))
+	if report.BaseTotal > 0 {
+		fmt.Fprintf(&b, " (%+.1f%%)", (float64(report.CurrentTotal)-report.BaseTotal)/report.BaseTotal*100)
+	}
+	if report.Scale != 1 {
+		fmt.Fprintf(&b, ", baseline scaled by %.3g", report.Scale)
+	}
+	b.WriteString("\n")
+
+	if len(report.Regressions) == 0 {
+		return b.String()
+	}
+	b.WriteString("\nRegressions:\n")
+	for i, r := range report.Regressions {
+		if i == limit {
+			fmt.Fprintf(&b, "... and %d more\n", len(report.Regressions)-limit)
+			break
+		}
+		change := "new"
+		if !math.IsInf(r.Percent, 1) {
+			change = fmt.Sprintf("%+.1f%%", r.Percent)
+		}
+		fmt.Fprintf(&b, "%s: %s -> %s (%s, %.1f%% of total",
+			r.Function, formatAnalysisValue(int64(r.Base), st), formatAnalysisValue(r.Current, st), change, r.Share)
+		if !math.IsNaN(r.Sigma) {
+			fmt.Fprintf(&b, ", %.1f sigma", r.Sigma)
+		}
+		b.WriteString(")\n")
+	}
+	return b.String()
+}
+
+// SaveBaselineHandler saves a named baseline profile: a stored snapshot, or a
+// freshly collected profile of the given type. Saving under an existing name replaces it.
+func SaveBaselineHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+	name, _ := request.Params.Arguments["name"].(string)
+	if name == "" {
+		return handleMCPError(fmt.Errorf("name is required")), nil
+	}
+
+	var profileType string
+	var data []byte
+	if id, _ := request.Params.Arguments["snapshot"].(string); id != "" {
+		snap, err := a.lookupSnapshot(id)
+		if err != nil {
+			return handleMCPError(err), nil
+		}
+		profileType, data = snap.ProfileType, snap.data
+	} else {
+		profileType, _ = request.Params.Arguments["type"].(string)
+		if profileType == "" {
+			profileType = ProfileTypeCPU
+		}
+		var err error
+		if data, err = collectProfile(ctx, profileType, request); err != nil {
+			return handleMCPError(err), nil
+		}
+	}
+
+	b, err := a.baselines.Save(name, profileType, data)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(fmt.Sprintf("Saved %s profile as baseline %s (%s)",
+				b.ProfileType, b.ID, formatValue(int64(b.Size)))),
+		},
+	}, nil
+}
+
+// ListBaselinesHandler lists the saved baselines.
+func ListBaselinesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	baselines := agentFromContext(ctx).baselines.List()
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Baselines (%d)\n\n", len(baselines)))
+	for _, b := range baselines {
+		result.WriteString(fmt.Sprintf("%s: type=%s, saved=%s, size=%s\n",
+			b.ID, b.ProfileType, b.CreatedAt.Format(time.RFC3339), formatValue(int64(b.Size))))
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(result.String()),
+		},
+	}, nil
+}
+
+// CheckRegressionHandler compares a profile against a named baseline and reports the
+// functions whose value increased beyond the thresholds, with a PASS or FAIL verdict
+// that can gate a canary rollout. The current profile is a snapshot, or "now" to
+// collect a fresh profile of the baseline's type.
+func CheckRegressionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+
+	name, _ := request.Params.Arguments["baseline"].(string)
+	baseline, err := a.baselines.Get(name)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+
+	currentID, _ := request.Params.Arguments["current"].(string)
+	var current *Snapshot
+	if currentID == "" || currentID == "now" {
+		data, err := collectProfile(ctx, baseline.ProfileType, request)
+		if err != nil {
+			return handleMCPError(err), nil
+		}
+		current = a.snapshots.Add(baseline.ProfileType, data)
+	} else if current, err = a.lookupSnapshot(currentID); err != nil {
+		return handleMCPError(err), nil
+	}
+	if baseline.ProfileType != current.ProfileType {
+		return handleMCPError(fmt.Errorf("cannot compare %s snapshot %s against %s baseline %s",
+			current.ProfileType, current.ID, baseline.ProfileType, baseline.ID)), nil
+	}
+
+	c := regressionCriteria{
+		threshold: defaultRegressionThreshold,
+		minShare:  defaultRegressionMinShare,
+		sigma:     defaultRegressionSigma,
+	}
+	if v, ok := request.Params.Arguments["threshold"].(float64); ok {
+		c.threshold = v
+	}
+	if v, ok := request.Params.Arguments["min_share"].(float64); ok {
+		c.minShare = v
+	}
+	if v, ok := request.Params.Arguments["sigma"].(float64); ok {
+		c.sigma = v
+	}
+	c.cumulative, _ = request.Params.Arguments["cumulative"].(bool)
+	c.normalize, _ = request.Params.Arguments["normalize"].(bool)
+	limit := 20
+	if v, ok := request.Params.Arguments["limit"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+
+	pb, err := baseline.Profile()
+	if err != nil {
+		return handleMCPError(&ProfileError{
+			ProfileType: baseline.ProfileType,
+			Err:         fmt.Errorf("failed to parse baseline profile: %w", err),
+		}), nil
+	}
+	pc, err := current.Profile()
+	if err != nil {
+		return handleMCPError(&ProfileError{
+			ProfileType: current.ProfileType,
+			Err:         fmt.Errorf("failed to parse current profile: %w", err),
+		}), nil
+	}
+	report, err := checkRegressions(pb, pc, baseline.ProfileType, c)
+	if err != nil {
+		return handleMCPError(&ProfileError{ProfileType: baseline.ProfileType, Err: err}), nil
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(formatRegressionReport(baseline, current, report, c, limit)),
+		},
+	}, nil
+}
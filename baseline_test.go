@@ -0,0 +1,148 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckRegressions(t *testing.T) {
+	base := map[string]int64{"main.hot": 100, "main.cold": 100, "main.noise": 10}
+	current := map[string]int64{"main.hot": 200, "main.cold": 100, "main.noise": 14, "main.new": 20}
+	defaults := regressionCriteria{threshold: defaultRegressionThreshold, minShare: defaultRegressionMinShare, sigma: defaultRegressionSigma}
+
+	tests := []struct {
+		name        string
+		profileType string
+		criteria    func(c *regressionCriteria)
+		want        []string
+		countsKnown bool
+	}{
+		{
+			// main.noise grew by 40%, but 10 -> 14 samples is within sampling noise.
+			name:        "cpu",
+			profileType: ProfileTypeCPU,
+			want:        []string{"main.hot", "main.new"},
+			countsKnown: true,
+		},
+		{
+			name:        "cpu threshold",
+			profileType: ProfileTypeCPU,
+			criteria:    func(c *regressionCriteria) { c.threshold = 150 },
+			want:        []string{"main.new"},
+			countsKnown: true,
+		},
+		{
+			name:        "cpu min share",
+			profileType: ProfileTypeCPU,
+			criteria:    func(c *regressionCriteria) { c.minShare = 10 },
+			want:        []string{"main.hot"},
+			countsKnown: true,
+		},
+		{
+			// Scaled to the current total, main.hot grew by 26%, about 2 sigma.
+			name:        "cpu normalized",
+			profileType: ProfileTypeCPU,
+			criteria:    func(c *regressionCriteria) { c.normalize = true },
+			want:        []string{"main.new"},
+			countsKnown: true,
+		},
+		{
+			// Heap object counts are scaled estimates, so significance is not tested.
+			name:        "heap",
+			profileType: ProfileTypeHeap,
+			want:        []string{"main.hot", "main.new", "main.noise"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaults
+			if tt.criteria != nil {
+				tt.criteria(&c)
+			}
+			b, cur := cpuProfile(base), cpuProfile(current)
+			if tt.profileType == ProfileTypeHeap {
+				b, cur = heapProfile(base), heapProfile(current)
+			}
+			report, err := checkRegressions(b, cur, tt.profileType, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range report.Regressions {
+				got = append(got, r.Function)
+				if tt.countsKnown == math.IsNaN(r.Sigma) {
+					t.Errorf("%s: sigma = %v with counts known = %v", r.Function, r.Sigma, tt.countsKnown)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("regressions = %v, want %v", got, tt.want)
+			}
+			if report.CountsKnown != tt.countsKnown {
+				t.Errorf("CountsKnown = %v, want %v", report.CountsKnown, tt.countsKnown)
+			}
+		})
+	}
+
+	report, err := checkRegressions(cpuProfile(base), cpuProfile(current), ProfileTypeCPU, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hot := report.Regressions[0]
+	if want := 100 / math.Sqrt(300); math.Abs(hot.Sigma-want) > 1e-9 {
+		t.Errorf("sigma of main.hot = %v, want %v", hot.Sigma, want)
+	}
+	if hot.Percent != 100 || !math.IsInf(report.Regressions[1].Percent, 1) {
+		t.Errorf("percents = %v, %v; want 100, +Inf", hot.Percent, report.Regressions[1].Percent)
+	}
+}
+
+func TestFormatRegressionReportUntestedSignificance(t *testing.T) {
+	c := regressionCriteria{threshold: 10, minShare: 1, sigma: 3}
+	report, err := checkRegressions(heapProfile(map[string]int64{"main.a": 10}), heapProfile(map[string]int64{"main.a": 20}), ProfileTypeHeap, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := &Snapshot{ID: "base", ProfileType: ProfileTypeHeap}
+	out := formatRegressionReport(snap, &Snapshot{ID: "current"}, report, c, 10)
+	if !strings.Contains(out, "significance not tested") || strings.Contains(out, "sigma") {
+		t.Errorf("report does not say significance was not tested:\n%s", out)
+	}
+}
+
+func TestBaselineStorePersistence(t *testing.T) {
+	data := func(t *testing.T) []byte {
+		var buf bytes.Buffer
+		if err := cpuProfile(map[string]int64{"main.f": 1}).Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}(t)
+
+	tests := []struct {
+		name        string
+		profileType string
+		baseline    string
+	}{
+		{name: "builtin type", profileType: ProfileTypeHeap, baseline: "nightly"},
+		{name: "type with dashes", profileType: "open-conns", baseline: "release-1.2"},
+		{name: "type with other characters", profileType: "pool/leased buffers", baseline: "v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if _, err := newBaselineStore(dir, nil).Save(tt.baseline, tt.profileType, data); err != nil {
+				t.Fatal(err)
+			}
+			b, err := newBaselineStore(dir, nil).Get(tt.baseline)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.ProfileType != tt.profileType || !bytes.Equal(b.data, data) {
+				t.Errorf("reloaded baseline has type %q and %d bytes, want %q and %d bytes", b.ProfileType, len(b.data), tt.profileType, len(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,563 @@
+package pprofmcpagent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Benchmark runner limits
+const (
+	maxBenchmarkRuns        = 32
+	maxBenchmarkCount       = 50
+	defaultBenchmarkCount   = 6
+	defaultBenchmarkTimeout = 10 * time.Minute
+	// benchmarkAlpha is the significance level below which a change is reported.
+	benchmarkAlpha = 0.05
+	// benchmarkOutputTail is the number of output lines included when go test fails.
+	benchmarkOutputTail = 40
+)
+
+// WithModuleDir allows tools to run `go test -bench` in packages of the Go module
+// in the given directory, with CPU and memory profiles captured for each run.
+// Package paths passed to the tools are relative to the directory.
+func WithModuleDir(dir string) Option {
+	return func(c *config) {
+		c.moduleDir = dir
+	}
+}
+
+// benchmarkResult is one result line of `go test -bench` output.
+type benchmarkResult struct {
+	Name       string
+	Iterations int64
+	// Values maps units (ns/op, B/op, allocs/op, custom metrics) to values.
+	Values map[string]float64
+}
+
+// benchmarkRun is one invocation of `go test -bench` with its parsed results
+// and the snapshot IDs of the captured profiles.
+type benchmarkRun struct {
+	ID          string
+	Package     string
+	Pattern     string
+	Count       int
+	CreatedAt   time.Time
+	Results     []benchmarkResult
+	CPUSnapshot string
+	MemSnapshot string
+}
+
+// benchmarkRunner runs benchmarks in a module directory and keeps the most recent runs.
+type benchmarkRunner struct {
+	dir string
+
+	mu   sync.Mutex
+	runs []*benchmarkRun // ordered from oldest to newest
+}
+
+// add stores a run, evicting the oldest runs beyond maxBenchmarkRuns.
+func (r *benchmarkRunner) add(run *benchmarkRun) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs = append(r.runs, run)
+	if len(r.runs) > maxBenchmarkRuns {
+		r.runs = r.runs[len(r.runs)-maxBenchmarkRuns:]
+	}
+}
+
+// get returns the run with the given ID.
+func (r *benchmarkRunner) get(id string) (*benchmarkRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, run := range r.runs {
+		if run.ID == id {
+			return run, nil
+		}
+	}
+	return nil, fmt.Errorf("benchmark run %q not found", id)
+}
+
+// list returns the stored runs from newest to oldest.
+func (r *benchmarkRunner) list() []*benchmarkRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]*benchmarkRun, 0, len(r.runs))
+	for i := len(r.runs) - 1; i >= 0; i-- {
+		result = append(result, r.runs[i])
+	}
+	return result
+}
+
+// benchmarkPackage validates a package path relative to the module directory.
+// Only a single local package is accepted, as go test writes profiles for one package only.
+func benchmarkPackage(pkg string) (string, error) {
+	if pkg == "" || pkg == "." {
+		return ".", nil
+	}
+	clean := filepath.ToSlash(filepath.Clean(strings.TrimPrefix(pkg, "./")))
+	if !filepath.IsLocal(clean) || strings.Contains(clean, "...") || strings.HasPrefix(clean, "-") {
+		return "", fmt.Errorf("package %q must be a single package directory relative to the module", pkg)
+	}
+	return "./" + clean, nil
+}
+
+// benchmarkOptions are the settings of one benchmark run.
+type benchmarkOptions struct {
+	pkg       string
+	pattern   string
+	count     int
+	benchtime string
+	timeout   time.Duration
+}
+
+// run runs the benchmarks with CPU and memory profiling and returns the raw output
+// and the paths of the profiles, which are written to tmp.
+func (r *benchmarkRunner) run(ctx context.Context, opts benchmarkOptions, tmp string) ([]byte, string, string, error) {
+	cpuProfile := filepath.Join(tmp, "cpu.pprof")
+	memProfile := filepath.Join(tmp, "mem.pprof")
+	args := []string{
+		"test",
+		"-run=^$",
+		"-bench=" + opts.pattern,
+		"-benchmem",
+		"-count=" + strconv.Itoa(opts.count),
+		"-cpuprofile=" + cpuProfile,
+		"-memprofile=" + memProfile,
+		// Keep the test binary out of the module directory.
+		"-o=" + filepath.Join(tmp, "bench.test"),
+	}
+	if opts.benchtime != "" {
+		args = append(args, "-benchtime="+opts.benchtime)
+	}
+	args = append(args, opts.pkg)
+
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = r.dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %v", opts.timeout)
+		}
+		return out, "", "", fmt.Errorf("go test failed: %w\n%s", err, outputTail(out, benchmarkOutputTail))
+	}
+	return out, cpuProfile, memProfile, nil
+}
+
+// outputTail returns the last n lines of command output.
+func outputTail(out []byte, n int) string {
+	lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	if len(lines) > n {
+		lines = append([]string{"..."}, lines[len(lines)-n:]...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseBenchmarkOutput parses the result lines of `go test -bench` output, e.g.
+// "BenchmarkParse-8   1000000   1234 ns/op   512 B/op   3 allocs/op".
+func parseBenchmarkOutput(out []byte) []benchmarkResult {
+	var results []benchmarkResult
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") || len(fields)%2 != 0 {
+			continue
+		}
+		iterations, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		result := benchmarkResult{
+			Name:       fields[0],
+			Iterations: iterations,
+			Values:     make(map[string]float64),
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				break
+			}
+			result.Values[fields[i+1]] = v
+		}
+		if len(result.Values) > 0 {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// benchmarkSamples groups the values of repeated results by benchmark name and unit.
+// It returns the benchmark names and units in order of first appearance.
+func benchmarkSamples(results []benchmarkResult) (map[string]map[string][]float64, []string, []string) {
+	samples := make(map[string]map[string][]float64)
+	var names, units []string
+	seenUnit := make(map[string]bool)
+	for _, r := range results {
+		if samples[r.Name] == nil {
+			samples[r.Name] = make(map[string][]float64)
+			names = append(names, r.Name)
+		}
+		for _, unit := range sortedUnits(r.Values) {
+			samples[r.Name][unit] = append(samples[r.Name][unit], r.Values[unit])
+			if !seenUnit[unit] {
+				seenUnit[unit] = true
+				units = append(units, unit)
+			}
+		}
+	}
+	return samples, names, units
+}
+
+// sortedUnits returns the units of a result: ns/op, B/op and allocs/op first, then custom metrics.
+func sortedUnits(values map[string]float64) []string {
+	rank := func(unit string) int {
+		switch unit {
+		case "ns/op":
+			return 0
+		case "B/op":
+			return 1
+		case "allocs/op":
+			return 2
+		}
+		return 3
+	}
+	units := make([]string, 0, len(values))
+	for unit := range values {
+		units = append(units, unit)
+	}
+	sort.Slice(units, func(i, j int) bool {
+		if rank(units[i]) != rank(units[j]) {
+			return rank(units[i]) < rank(units[j])
+		}
+		return units[i] < units[j]
+	})
+	return units
+}
+
+// meanStddev returns the mean and sample standard deviation of xs.
+func meanStddev(xs []float64) (float64, float64) {
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	mean := sum / float64(len(xs))
+	if len(xs) < 2 {
+		return mean, 0
+	}
+	var sq float64
+	for _, x := range xs {
+		sq += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(xs)-1))
+}
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U test of xs and ys,
+// using the normal approximation with tie and continuity corrections, like benchstat
+// does to decide whether two sets of benchmark results differ.
+func mannWhitneyU(xs, ys []float64) float64 {
+	n1, n2 := float64(len(xs)), float64(len(ys))
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	type obs struct {
+		v float64
+		x bool
+	}
+	all := make([]obs, 0, len(xs)+len(ys))
+	for _, v := range xs {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range ys {
+		all = append(all, obs{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	// Assign average ranks to ties and sum the ranks of xs.
+	var rankSum, tieTerm float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].x {
+				rankSum += rank
+			}
+		}
+		t := float64(j - i)
+		tieTerm += t*t*t - t
+		i = j
+	}
+
+	u := rankSum - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	n := n1 + n2
+	variance := n1 * n2 / 12 * ((n + 1) - tieTerm/(n*(n-1)))
+	if variance <= 0 {
+		// All values are equal.
+		return 1
+	}
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		z = 0
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// formatBenchmarkValue formats a benchmark value in its unit, e.g. 1.23µs for ns/op.
+func formatBenchmarkValue(v float64, unit string) string {
+	switch unit {
+	case "ns/op":
+		return time.Duration(v).String()
+	case "B/op":
+		return formatValue(int64(v))
+	default:
+		return strconv.FormatFloat(v, 'g', 4, 64)
+	}
+}
+
+// formatBenchmarkSummary renders the mean ± relative standard deviation of each
+// benchmark and unit of a run.
+func formatBenchmarkSummary(run *benchmarkRun) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Benchmark run %s: %s, -bench=%s, -count=%d\n\n", run.ID, run.Package, run.Pattern, run.Count)
+	samples, names, units := benchmarkSamples(run.Results)
+	if len(names) == 0 {
+		b.WriteString("No benchmarks matched.\n")
+		return b.String()
+	}
+	for _, name := range names {
+		var parts []string
+		for _, unit := range units {
+			xs, ok := samples[name][unit]
+			if !ok {
+				continue
+			}
+			mean, sd := meanStddev(xs)
+			parts = append(parts, fmt.Sprintf("%s %s ± %s", unit, formatBenchmarkValue(mean, unit), relative(sd, mean)))
+		}
+		fmt.Fprintf(&b, "%s (n=%d): %s\n", name, len(samples[name][units[0]]), strings.Join(parts, ", "))
+	}
+	return b.String()
+}
+
+// relative formats sd as a percentage of mean.
+func relative(sd, mean float64) string {
+	if mean == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.0f%%", sd/math.Abs(mean)*100)
+}
+
+// compareBenchmarkRuns renders a benchstat-style comparison of two runs: for each
+// benchmark and unit, the means ± relative standard deviation of both runs, the
+// change of the mean and the p-value of the Mann-Whitney U test. Changes with
+// p >= benchmarkAlpha are shown as "~", as they may be noise.
+func compareBenchmarkRuns(base, current *benchmarkRun) string {
+	bs, baseNames, _ := benchmarkSamples(base.Results)
+	cs, names, units := benchmarkSamples(current.Results)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Comparison of %s (current) against %s (base)\n", current.ID, base.ID)
+	fmt.Fprintf(&b, "Changes with p >= %.2f (Mann-Whitney U test) are shown as ~.\n", benchmarkAlpha)
+
+	for _, unit := range units {
+		fmt.Fprintf(&b, "\n%s:\n", unit)
+		for _, name := range names {
+			xs, ys := bs[name][unit], cs[name][unit]
+			if len(ys) == 0 {
+				continue
+			}
+			if len(xs) == 0 {
+				fmt.Fprintf(&b, "%s: only in current\n", name)
+				continue
+			}
+			bm, bsd := meanStddev(xs)
+			cm, csd := meanStddev(ys)
+			p := mannWhitneyU(xs, ys)
+			delta := "~"
+			if p < benchmarkAlpha && bm != 0 {
+				delta = fmt.Sprintf("%+.2f%%", (cm-bm)/math.Abs(bm)*100)
+			}
+			fmt.Fprintf(&b, "%s: %s ± %s -> %s ± %s  %s (p=%.3f n=%d+%d)\n", name,
+				formatBenchmarkValue(bm, unit), relative(bsd, bm),
+				formatBenchmarkValue(cm, unit), relative(csd, cm),
+				delta, p, len(xs), len(ys))
+		}
+	}
+	for _, name := range baseNames {
+		if _, ok := cs[name]; !ok {
+			fmt.Fprintf(&b, "\n%s: only in base\n", name)
+		}
+	}
+	return b.String()
+}
+
+// validateBenchtime checks that a -benchtime value is a positive duration or
+// a positive iteration count such as 1000x. Empty means go test's default.
+func validateBenchtime(benchtime string) error {
+	if benchtime == "" {
+		return nil
+	}
+	if n, ok := strings.CutSuffix(benchtime, "x"); ok {
+		if count, err := strconv.Atoi(n); err == nil && count > 0 {
+			return nil
+		}
+	} else if d, err := time.ParseDuration(benchtime); err == nil && d > 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid benchtime %q: use a duration such as 2s or an iteration count such as 1000x", benchtime)
+}
+
+// RunBenchmarkHandler runs `go test -bench` for a package of the module directory
+// with CPU and memory profiling. The results are summarized and stored as a
+// benchmark run for compare-benchmarks, and the captured profiles are stored as
+// snapshots and rendered with the usual views.
+func RunBenchmarkHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+	if a.bench == nil {
+		return handleMCPError(fmt.Errorf("no module directory is configured")), nil
+	}
+
+	pkgParam, _ := request.Params.Arguments["package"].(string)
+	pkg, err := benchmarkPackage(pkgParam)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+	opts := benchmarkOptions{
+		pkg:     pkg,
+		pattern: ".",
+		count:   defaultBenchmarkCount,
+		timeout: defaultBenchmarkTimeout,
+	}
+	if pattern, ok := request.Params.Arguments["bench"].(string); ok && pattern != "" {
+		opts.pattern = pattern
+	}
+	if count, ok := request.Params.Arguments["count"].(float64); ok && count > 0 {
+		opts.count = min(int(count), maxBenchmarkCount)
+	}
+	opts.benchtime, _ = request.Params.Arguments["benchtime"].(string)
+	if err := validateBenchtime(opts.benchtime); err != nil {
+		return handleMCPError(err), nil
+	}
+	if timeout, ok := request.Params.Arguments["timeout"].(float64); ok && timeout > 0 {
+		opts.timeout = min(time.Duration(timeout*float64(time.Second)), defaultBenchmarkTimeout)
+	}
+
+	tmp, err := os.MkdirTemp("", "pprof-mcp-bench-")
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+	defer os.RemoveAll(tmp)
+
+	out, cpuProfile, memProfile, err := a.bench.run(ctx, opts, tmp)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+
+	run := &benchmarkRun{
+		ID:        "bench-" + uuid.NewString()[:8],
+		Package:   pkg,
+		Pattern:   opts.pattern,
+		Count:     opts.count,
+		CreatedAt: time.Now(),
+		Results:   parseBenchmarkOutput(out),
+	}
+	result := &mcp.CallToolResult{}
+	view := viewParams(request)
+	for _, prof := range []struct {
+		path        string
+		profileType string
+		snapshot    *string
+	}{
+		{cpuProfile, ProfileTypeCPU, &run.CPUSnapshot},
+		{memProfile, ProfileTypeAllocs, &run.MemSnapshot},
+	} {
+		// No profile is written when no benchmark matched.
+		data, err := os.ReadFile(prof.path)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		if data, err = a.redactor.data(data); err != nil {
+			return handleMCPError(&ProfileError{ProfileType: prof.profileType, Err: err}), nil
+		}
+		snap := a.snapshots.Add(prof.profileType, data)
+		p, err := snap.Profile()
+		if err != nil {
+			return handleMCPError(&ProfileError{
+				ProfileType: prof.profileType,
+				Err:         fmt.Errorf("failed to parse profile: %w", err),
+			}), nil
+		}
+		*prof.snapshot = snap.ID
+		result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("Snapshot ID: %s (%s profile of the run)\n\n%s",
+			snap.ID, prof.profileType, renderView(p, view, prof.profileType))))
+	}
+	a.bench.add(run)
+
+	result.Content = append([]mcp.Content{mcp.NewTextContent(formatBenchmarkSummary(run))}, result.Content...)
+	return result, nil
+}
+
+// ListBenchmarkRunsHandler lists the stored benchmark runs.
+func ListBenchmarkRunsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+	if a.bench == nil {
+		return handleMCPError(fmt.Errorf("no module directory is configured")), nil
+	}
+	runs := a.bench.list()
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Benchmark runs (%d)\n\n", len(runs)))
+	for _, run := range runs {
+		result.WriteString(fmt.Sprintf("%s: package=%s, bench=%s, count=%d, created=%s, cpu=%s, mem=%s\n",
+			run.ID, run.Package, run.Pattern, run.Count, run.CreatedAt.Format(time.RFC3339), run.CPUSnapshot, run.MemSnapshot))
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(result.String()),
+		},
+	}, nil
+}
+
+// CompareBenchmarksHandler compares two benchmark runs with benchstat-style statistics.
+func CompareBenchmarksHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+	if a.bench == nil {
+		return handleMCPError(fmt.Errorf("no module directory is configured")), nil
+	}
+	baseID, _ := request.Params.Arguments["base"].(string)
+	base, err := a.bench.get(baseID)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+	currentID, _ := request.Params.Arguments["current"].(string)
+	current, err := a.bench.get(currentID)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(compareBenchmarkRuns(base, current)),
+		},
+	}, nil
+}
@@ -0,0 +1,90 @@
+package pprofmcpagent
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestBenchmarkPackage(t *testing.T) {
+	tests := []struct {
+		pkg     string
+		want    string
+		wantErr bool
+	}{
+		{pkg: "", want: "."},
+		{pkg: ".", want: "."},
+		{pkg: "./internal/parser", want: "./internal/parser"},
+		{pkg: "internal/parser/", want: "./internal/parser"},
+		{pkg: "internal/../parser", want: "./parser"},
+		{pkg: "../other", wantErr: true},
+		{pkg: "internal/../../other", wantErr: true},
+		{pkg: "/usr/local/go/src/fmt", wantErr: true},
+		{pkg: "./...", wantErr: true},
+		{pkg: "internal/...", wantErr: true},
+		{pkg: "-exec=sh", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := benchmarkPackage(tt.pkg)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("benchmarkPackage(%q) = %q, %v; want %q, error %t", tt.pkg, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateBenchtime(t *testing.T) {
+	for _, benchtime := range []string{"", "2s", "500ms", "1000x", "1x"} {
+		if err := validateBenchtime(benchtime); err != nil {
+			t.Errorf("validateBenchtime(%q): %v", benchtime, err)
+		}
+	}
+	for _, benchtime := range []string{"2", "0s", "-1s", "0x", "-5x", "x", "10y", "1s -exec=sh"} {
+		if err := validateBenchtime(benchtime); err == nil {
+			t.Errorf("validateBenchtime(%q) succeeded", benchtime)
+		}
+	}
+}
+
+func TestParseBenchmarkOutput(t *testing.T) {
+	out := []byte(`goos: linux
+goarch: amd64
+pkg: example.com/mod/parser
+BenchmarkParse-8   	 1000000	      1234 ns/op	     512 B/op	       3 allocs/op
+BenchmarkParse/large-8         	     100	  12345678 ns/op	        42.5 MB/s
+BenchmarkBroken-8   FAIL
+--- FAIL: BenchmarkBroken-8
+PASS
+ok  	example.com/mod/parser	3.210s
+`)
+	want := []benchmarkResult{
+		{Name: "BenchmarkParse-8", Iterations: 1000000, Values: map[string]float64{"ns/op": 1234, "B/op": 512, "allocs/op": 3}},
+		{Name: "BenchmarkParse/large-8", Iterations: 100, Values: map[string]float64{"ns/op": 12345678, "MB/s": 42.5}},
+	}
+	if got := parseBenchmarkOutput(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseBenchmarkOutput() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	// Two-sided p-values of the normal approximation with tie and continuity
+	// corrections, as computed by R's wilcox.test(xs, ys, exact = FALSE).
+	tests := []struct {
+		name   string
+		xs, ys []float64
+		want   float64
+	}{
+		{"separated", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 0.012186},
+		{"separated reversed", []float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}, 0.012186},
+		{"different sizes", []float64{1, 2, 3}, []float64{4, 5, 6, 7}, 0.051830},
+		{"overlapping", []float64{10, 11, 12, 13, 14}, []float64{12, 13, 14, 15, 16}, 0.113846},
+		{"ties", []float64{1, 1, 2, 2, 3}, []float64{2, 3, 3, 4, 4}, 0.052412},
+		{"same values", []float64{1, 2, 3, 4, 5}, []float64{1, 2, 3, 4, 5}, 1},
+		{"all equal", []float64{5, 5, 5}, []float64{5, 5, 5}, 1},
+		{"empty", nil, []float64{1, 2}, 1},
+	}
+	for _, tt := range tests {
+		if got := mannWhitneyU(tt.xs, tt.ys); math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("%s: mannWhitneyU(%v, %v) = %.6f, want %.6f", tt.name, tt.xs, tt.ys, got, tt.want)
+		}
+	}
+}
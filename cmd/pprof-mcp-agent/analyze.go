@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	pprofmcpagent "github.com/yudppp/pprof-mcp-agent"
+)
+
+// analyze prints the views of profile files, for offline analysis without an MCP client.
+func analyze(args []string) {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	view := fs.String("view", string(pprofmcpagent.ViewModeFlat), "view mode: flat, cum, graph or packages")
+	limit := fs.Int("limit", 100, "maximum number of locations to show")
+	redactions := redactFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pprof-mcp-agent analyze [-view flat|cum|graph] [-limit 100] [-redact pattern] file.pb.gz...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for i, path := range fs.Args() {
+		if i > 0 {
+			fmt.Println()
+		}
+		if fs.NArg() > 1 {
+			fmt.Printf("== %s ==\n", path)
+		}
+		result, err := pprofmcpagent.RenderProfileFile(path, *limit, pprofmcpagent.ViewMode(*view), *redactions...)
+		if err != nil {
+			log.Printf("%s: %v", path, err)
+			failed = true
+			continue
+		}
+		fmt.Print(result)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
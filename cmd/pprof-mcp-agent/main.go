@@ -0,0 +1,122 @@
+// Command pprof-mcp-agent serves pprof data of a remote Go process through the
+// Model Context Protocol (MCP). It fetches profiles from the process's
+// net/http/pprof endpoint, so services can be profiled without recompiling them.
+//
+// Usage:
+//
+//	pprof-mcp-agent -target http://localhost:6060 [-transport sse|stdio] [-addr :1239]
+//	pprof-mcp-agent -targets-file targets.json [-targets-dir dir] [-transport sse|stdio] [-addr :1239]
+//	pprof-mcp-agent -profile-dir ./profiles [-transport sse|stdio] [-addr :1239]
+//	pprof-mcp-agent -module-dir . [-transport sse|stdio] [-addr :1239]
+//	pprof-mcp-agent analyze [-view flat|cum|graph] [-limit 100] [-redact pattern] file.pb.gz...
+//
+// With -targets-file or -targets-dir, tools select the targets to profile
+// through their target and targets arguments. With -profile-dir, profile files
+// in the directory can be analyzed offline. With -module-dir, benchmarks of the
+// module can be run with profiling and compared. With -audit-file, every tool
+// call is appended to the file as a JSON line. With -redact, matches of the
+// pattern are replaced in function names, file paths and label values of all
+// profiles. The analyze command prints the views of profile files without
+// starting a server.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+
+	pprofmcpagent "github.com/yudppp/pprof-mcp-agent"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "analyze" {
+		analyze(os.Args[2:])
+		return
+	}
+
+	target := flag.String("target", "", "URL of the remote net/http/pprof endpoint (e.g. http://localhost:6060)")
+	transport := flag.String("transport", "sse", "MCP transport: sse or stdio")
+	addr := flag.String("addr", ":1239", "listen address for the sse transport")
+	targetsFile := flag.String("targets-file", "", "JSON file listing remote targets")
+	targetsDir := flag.String("targets-dir", "", "directory of JSON target files, re-read on every tool call")
+	profileDir := flag.String("profile-dir", "", "directory of profile files available for offline analysis")
+	baselineDir := flag.String("baseline-dir", "", "directory where named baselines are persisted")
+	moduleDir := flag.String("module-dir", "", "Go module directory whose benchmarks can be run and profiled")
+	auditFile := flag.String("audit-file", "", "file to append the audit log of tool calls to as JSON lines")
+	redactions := redactFlag(flag.CommandLine)
+	flag.Parse()
+
+	if *target == "" && *targetsFile == "" && *targetsDir == "" && *profileDir == "" && *moduleDir == "" {
+		log.Println("-target, -targets-file, -targets-dir, -profile-dir or -module-dir is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var opts []pprofmcpagent.Option
+	if *target != "" {
+		opts = append(opts, pprofmcpagent.WithRemoteTarget(*target))
+	} else {
+		// Never profile this command itself.
+		opts = append(opts, pprofmcpagent.WithoutLocalProcess())
+	}
+	if *targetsFile != "" {
+		opts = append(opts, pprofmcpagent.WithTargetsFile(*targetsFile))
+	}
+	if *targetsDir != "" {
+		opts = append(opts, pprofmcpagent.WithTargetsDir(*targetsDir))
+	}
+	if *profileDir != "" {
+		opts = append(opts, pprofmcpagent.WithProfileDir(*profileDir))
+	}
+	if *baselineDir != "" {
+		opts = append(opts, pprofmcpagent.WithBaselineDir(*baselineDir))
+	}
+	if *moduleDir != "" {
+		opts = append(opts, pprofmcpagent.WithModuleDir(*moduleDir))
+	}
+	if len(*redactions) > 0 {
+		opts = append(opts, pprofmcpagent.WithRedaction(*redactions...))
+	}
+	if *auditFile != "" {
+		sink, f, err := pprofmcpagent.OpenAuditFile(*auditFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		opts = append(opts, pprofmcpagent.WithAuditSink(sink))
+	}
+
+	var err error
+	switch *transport {
+	case "sse":
+		log.Printf("MCP server listening on %s", *addr)
+		err = pprofmcpagent.ServeSSE(ctx, *addr, opts...)
+	case "stdio":
+		err = pprofmcpagent.ServeStdio(ctx, opts...)
+	default:
+		log.Fatalf("unknown transport %q", *transport)
+	}
+	if err != nil {
+		log.Fatalf("Error starting server: %v", err)
+	}
+}
+
+// redactFlag adds the repeatable -redact flag to fs and returns the rules it collects.
+func redactFlag(fs *flag.FlagSet) *[]pprofmcpagent.RedactionRule {
+	var rules []pprofmcpagent.RedactionRule
+	fs.Func("redact", "regular expression to redact from function names, file paths and label values (repeatable)", func(pattern string) error {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return err
+		}
+		rules = append(rules, pprofmcpagent.RedactionRule{Pattern: pattern})
+		return nil
+	})
+	return &rules
+}
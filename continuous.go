@@ -0,0 +1,250 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Default continuous profiling settings
+const (
+	DefaultContinuousInterval    = time.Minute
+	DefaultContinuousCPUDuration = 10 * time.Second
+	DefaultContinuousCapacity    = 300
+)
+
+// ContinuousProfilingConfig configures the background collector that periodically
+// captures profiles into a bounded ring buffer.
+type ContinuousProfilingConfig struct {
+	// Interval between two collection rounds (default: 1 minute).
+	Interval time.Duration
+	// CPUDuration is how long the CPU profile is sampled in each round (default: 10 seconds).
+	CPUDuration time.Duration
+	// ProfileTypes to collect (default: cpu, heap, goroutine and mutex).
+	ProfileTypes []string
+	// Capacity is the maximum number of profiles kept; the oldest are overwritten (default: 300).
+	Capacity int
+	// MaxBytes bounds the total size of kept profiles; zero means unbounded.
+	MaxBytes int64
+}
+
+// WithContinuousProfiling enables the background collector. Profiles are captured
+// until the context given by WithContext (or ServeSSE) is cancelled.
+func WithContinuousProfiling(cc ContinuousProfilingConfig) Option {
+	return func(c *config) {
+		if cc.Interval <= 0 {
+			cc.Interval = DefaultContinuousInterval
+		}
+		if cc.CPUDuration <= 0 {
+			cc.CPUDuration = DefaultContinuousCPUDuration
+		}
+		if cc.CPUDuration > cc.Interval {
+			cc.CPUDuration = cc.Interval
+		}
+		if len(cc.ProfileTypes) == 0 {
+			cc.ProfileTypes = []string{ProfileTypeCPU, ProfileTypeHeap, ProfileTypeGoroutine, ProfileTypeMutex}
+		}
+		if cc.Capacity <= 0 {
+			cc.Capacity = DefaultContinuousCapacity
+		}
+		c.continuous = &cc
+	}
+}
+
+// continuousCollector periodically captures profiles into a ring buffer.
+type continuousCollector struct {
+	cfg    ContinuousProfilingConfig
+	source profileSource
+	ring   *snapshotStore
+}
+
+func newContinuousCollector(cfg ContinuousProfilingConfig, source profileSource) *continuousCollector {
+	return &continuousCollector{
+		cfg:    cfg,
+		source: source,
+		ring:   newSnapshotStore(cfg.Capacity, cfg.MaxBytes, "", nil),
+	}
+}
+
+// run collects profiles every interval until ctx is cancelled.
+func (c *continuousCollector) run(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		c.collect(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collect captures one round of all configured profile types.
+func (c *continuousCollector) collect(ctx context.Context) {
+	for _, profileType := range c.cfg.ProfileTypes {
+		data, err := c.source.Profile(ctx, mcp.CallToolRequest{}, profileType, c.cfg.CPUDuration)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("continuous profiling: %v", err)
+			continue
+		}
+		c.ring.Add(profileType, data)
+	}
+}
+
+// continuousRange returns the ring buffer entries of the given type captured
+// within the time range described by the from and to request parameters, oldest first.
+func continuousRange(ctx context.Context, request mcp.CallToolRequest) ([]*Snapshot, time.Time, time.Time, error) {
+	collector := agentFromContext(ctx).continuous
+	if collector == nil {
+		return nil, time.Time{}, time.Time{}, fmt.Errorf("continuous profiling is not enabled")
+	}
+
+	now := time.Now()
+	fromParam, _ := request.Params.Arguments["from"].(string)
+	from, err := parseTimeParam(fromParam, now, time.Time{})
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+	}
+	toParam, _ := request.Params.Arguments["to"].(string)
+	to, err := parseTimeParam(toParam, now, now)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+	}
+
+	profileType, _ := request.Params.Arguments["type"].(string)
+	var result []*Snapshot
+	for _, snap := range collector.ring.List(profileType) {
+		if snap.CreatedAt.Before(from) || snap.CreatedAt.After(to) {
+			continue
+		}
+		result = append([]*Snapshot{snap}, result...)
+	}
+	return result, from, to, nil
+}
+
+// parseTimeParam parses an RFC 3339 timestamp or a duration relative to now
+// (e.g. "15m" means 15 minutes ago). An empty value yields def.
+// Negative durations, which would point into the future, are rejected.
+func parseTimeParam(value string, now, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("duration %q is negative; durations count back from now", value)
+		}
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// aggregateContinuous combines the profiles of one type over a time range.
+// CPU samples are summed; mutex, block and allocation profiles are cumulative
+// since process start, so the first profile is subtracted from the last one;
+// heap and goroutine profiles are point-in-time and are averaged.
+func aggregateContinuous(profileType string, snapshots []*Snapshot) (*profile.Profile, string, error) {
+	switch profileType {
+	case ProfileTypeMutex, ProfileTypeBlock, ProfileTypeAllocs:
+		if len(snapshots) < 2 {
+			return nil, "", fmt.Errorf("need at least two %s profiles in the range to compute a delta", profileType)
+		}
+		p, err := diffSnapshots(snapshots[0], snapshots[len(snapshots)-1], false)
+		return p, "delta between first and last profile", err
+	}
+
+	profiles := make([]*profile.Profile, 0, len(snapshots))
+	for _, snap := range snapshots {
+		p, err := snap.Profile()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse %s: %w", snap.ID, err)
+		}
+		profiles = append(profiles, p)
+	}
+	merged, err := profile.Merge(profiles)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to merge profiles: %w", err)
+	}
+	if profileType == ProfileTypeCPU {
+		return merged, "sum of all profiles", nil
+	}
+	merged.Scale(1 / float64(len(profiles)))
+	return merged, "average of all profiles", nil
+}
+
+// ContinuousProfilesHandler lists the profiles captured by the background collector
+// within a time range, optionally filtered by profile type.
+func ContinuousProfilesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	snapshots, from, to, err := continuousRange(ctx, request)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Continuous profiles from %s to %s (%d)\n\n",
+		formatRangeTime(from), to.Format(time.RFC3339), len(snapshots)))
+	for _, snap := range snapshots {
+		result.WriteString(fmt.Sprintf("%s: type=%s, created=%s, size=%s\n",
+			snap.ID, snap.ProfileType, snap.CreatedAt.Format(time.RFC3339), formatValue(int64(snap.Size))))
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(result.String()),
+		},
+	}, nil
+}
+
+// ContinuousAggregateHandler aggregates the background profiles of one type
+// over a time range and renders the result with the requested view.
+func ContinuousAggregateHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	profileType, _ := request.Params.Arguments["type"].(string)
+	if profileType == "" {
+		return handleMCPError(fmt.Errorf("type is required")), nil
+	}
+	snapshots, from, to, err := continuousRange(ctx, request)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+	if len(snapshots) == 0 {
+		return handleMCPError(fmt.Errorf("no %s profiles captured between %s and %s",
+			profileType, formatRangeTime(from), to.Format(time.RFC3339))), nil
+	}
+
+	p, method, err := aggregateContinuous(profileType, snapshots)
+	if err != nil {
+		return handleMCPError(&ProfileError{
+			ProfileType: profileType,
+			Err:         err,
+		}), nil
+	}
+
+	result := renderView(p, viewParams(request), profileType)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(fmt.Sprintf("Aggregated %d %s profiles from %s to %s (%s)\n\n%s",
+				len(snapshots), profileType,
+				snapshots[0].CreatedAt.Format(time.RFC3339),
+				snapshots[len(snapshots)-1].CreatedAt.Format(time.RFC3339),
+				method, result)),
+		},
+	}, nil
+}
+
+// formatRangeTime formats the start of a time range, where the zero time means unbounded.
+func formatRangeTime(t time.Time) string {
+	if t.IsZero() {
+		return "the beginning"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,152 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+func TestParseTimeParam(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	def := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "", want: def},
+		{value: "15m", want: now.Add(-15 * time.Minute)},
+		{value: "1h30m", want: now.Add(-90 * time.Minute)},
+		{value: "0s", want: now},
+		{value: "2024-05-01T11:00:00Z", want: time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)},
+		{value: "2024-05-01T13:00:00+02:00", want: time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)},
+		{value: "-5m", wantErr: true},
+		{value: "yesterday", wantErr: true},
+		{value: "2024-05-01", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeParam(tt.value, now, def)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseTimeParam(%q) = %v, %v; want %v, error %t", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestAggregateContinuous(t *testing.T) {
+	contentionTypes := []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}}
+	contention := func(values map[string][]int64) *profile.Profile {
+		p := flatProfile(contentionTypes, values)
+		p.PeriodType = &profile.ValueType{Type: "contentions", Unit: "count"}
+		p.Period = 1
+		return p
+	}
+	snapshots := func(profileType string, profiles ...*profile.Profile) []*Snapshot {
+		var result []*Snapshot
+		for _, p := range profiles {
+			var buf bytes.Buffer
+			if err := p.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			result = append(result, &Snapshot{ProfileType: profileType, data: buf.Bytes()})
+		}
+		return result
+	}
+
+	tests := []struct {
+		name        string
+		profileType string
+		snapshots   []*Snapshot
+		want        map[string][]int64
+		wantMethod  string
+		wantErr     string
+	}{
+		{
+			name:        "cpu",
+			profileType: ProfileTypeCPU,
+			snapshots: snapshots(ProfileTypeCPU,
+				cpuProfile(map[string]int64{"main.a": 1}),
+				cpuProfile(map[string]int64{"main.a": 2, "main.b": 1}),
+				cpuProfile(map[string]int64{"main.b": 3})),
+			want:       map[string][]int64{"main.a": {3, 30000000}, "main.b": {4, 40000000}},
+			wantMethod: "sum of all profiles",
+		},
+		{
+			name:        "heap",
+			profileType: ProfileTypeHeap,
+			snapshots: snapshots(ProfileTypeHeap,
+				heapProfile(map[string]int64{"main.a": 2}),
+				heapProfile(map[string]int64{"main.a": 4, "main.b": 2})),
+			want:       map[string][]int64{"main.a": {3, 3072, 3, 3072}, "main.b": {1, 1024, 1, 1024}},
+			wantMethod: "average of all profiles",
+		},
+		{
+			name:        "mutex",
+			profileType: ProfileTypeMutex,
+			snapshots: snapshots(ProfileTypeMutex,
+				contention(map[string][]int64{"main.a": {2, 100}}),
+				contention(map[string][]int64{"main.a": {4, 200}}),
+				contention(map[string][]int64{"main.a": {5, 400}, "main.b": {1, 50}})),
+			want:       map[string][]int64{"main.a": {3, 300}, "main.b": {1, 50}},
+			wantMethod: "delta between first and last profile",
+		},
+		{
+			name:        "allocs",
+			profileType: ProfileTypeAllocs,
+			snapshots: snapshots(ProfileTypeAllocs,
+				heapProfile(map[string]int64{"main.a": 2}),
+				heapProfile(map[string]int64{"main.a": 7})),
+			want:       map[string][]int64{"main.a": {5, 5120, 5, 5120}},
+			wantMethod: "delta between first and last profile",
+		},
+		{
+			name:        "single cumulative profile",
+			profileType: ProfileTypeBlock,
+			snapshots:   snapshots(ProfileTypeBlock, contention(map[string][]int64{"main.a": {2, 100}})),
+			wantErr:     "need at least two block profiles in the range to compute a delta",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, method, err := aggregateContinuous(tt.profileType, tt.snapshots)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if method != tt.wantMethod {
+				t.Errorf("method = %q, want %q", method, tt.wantMethod)
+			}
+			if got := leafValues(p); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("values = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// leafValues sums the sample values of a profile per leaf function, leaving out functions without values.
+func leafValues(p *profile.Profile) map[string][]int64 {
+	values := make(map[string][]int64)
+	for _, s := range p.Sample {
+		name := s.Location[0].Line[0].Function.Name
+		if values[name] == nil {
+			values[name] = make([]int64, len(s.Value))
+		}
+		for i, v := range s.Value {
+			values[name][i] += v
+		}
+	}
+	for name, vs := range values {
+		if !slices.ContainsFunc(vs, func(v int64) bool { return v != 0 }) {
+			delete(values, name)
+		}
+	}
+	return values
+}
@@ -0,0 +1,401 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// WithRuntimeControl enables tools that change runtime settings of the process
+// (profiling rates, GOGC, GOMEMLIMIT, GOMAXPROCS) and force garbage collections.
+// They are disabled by default, as they affect the behaviour of the process.
+// Every change is recorded as an audit entry, and changes made with a TTL are
+// reverted when it expires or when the context given by WithContext is cancelled.
+// Runtime control is not available for remote targets.
+func WithRuntimeControl() Option {
+	return func(c *config) {
+		c.runtimeControl = true
+	}
+}
+
+// WithBlockProfileRate sets the block profile rate of the process with
+// runtime.SetBlockProfileRate and records it. The runtime does not report the
+// current rate, so without this option block_profile_rate can only be changed
+// with a TTL after it was set once through runtime control.
+func WithBlockProfileRate(rate int) Option {
+	return func(c *config) {
+		c.blockProfileRate = &rate
+	}
+}
+
+// blockProfileRate tracks the block profile rate, which the runtime does not expose.
+// It is known once the rate is set through WithBlockProfileRate or runtime control.
+var (
+	blockProfileRate      atomic.Int64
+	blockProfileRateKnown atomic.Bool
+)
+
+// setBlockProfileRate sets the block profile rate and records it.
+func setBlockProfileRate(v int64) {
+	runtime.SetBlockProfileRate(int(v))
+	blockProfileRate.Store(v)
+	blockProfileRateKnown.Store(true)
+}
+
+// runtimeSetting is a runtime setting that can be changed through runtime control.
+type runtimeSetting struct {
+	name        string
+	description string
+	// get returns the current value.
+	get func() int64
+	// set changes the value.
+	set func(v int64)
+	// validate checks a new value.
+	validate func(v int64) error
+	// format formats a value for display.
+	format func(v int64) string
+	// revertible returns an error if changes cannot have a TTL, because the
+	// current value to revert to is unknown. Nil means they always can.
+	revertible func() error
+}
+
+// runtimeSettings are the settings that can be changed, by name.
+var runtimeSettings = map[string]runtimeSetting{
+	"block_profile_rate": {
+		name:        "block_profile_rate",
+		description: "runtime.SetBlockProfileRate: sample one blocking event per rate nanoseconds blocked (1: all, 0: off)",
+		get: func() int64 {
+			if !blockProfileRateKnown.Load() {
+				return -1
+			}
+			return blockProfileRate.Load()
+		},
+		set:      setBlockProfileRate,
+		validate: nonNegative,
+		format: func(v int64) string {
+			if v < 0 {
+				return "unknown"
+			}
+			return strconv.FormatInt(v, 10)
+		},
+		revertible: func() error {
+			if !blockProfileRateKnown.Load() {
+				return fmt.Errorf("the runtime does not report the current rate; set it once without a ttl, or record it with WithBlockProfileRate")
+			}
+			return nil
+		},
+	},
+	"mutex_profile_fraction": {
+		name:        "mutex_profile_fraction",
+		description: "runtime.SetMutexProfileFraction: sample one in rate mutex contention events (1: all, 0: off)",
+		get:         func() int64 { return int64(runtime.SetMutexProfileFraction(-1)) },
+		set:         func(v int64) { runtime.SetMutexProfileFraction(int(v)) },
+		validate:    nonNegative,
+		format:      formatInt,
+	},
+	"gogc": {
+		name:        "gogc",
+		description: "debug.SetGCPercent (GOGC): heap growth in percent that triggers a GC (-1: off)",
+		get:         readGOGC,
+		set:         func(v int64) { debug.SetGCPercent(int(v)) },
+		validate: func(v int64) error {
+			if v < -1 {
+				return fmt.Errorf("must be -1 (off) or a percentage")
+			}
+			return nil
+		},
+		format: func(v int64) string {
+			if v < 0 {
+				return "off"
+			}
+			return strconv.FormatInt(v, 10)
+		},
+	},
+	"gomemlimit": {
+		name:        "gomemlimit",
+		description: "debug.SetMemoryLimit (GOMEMLIMIT): soft memory limit in bytes (-1: unlimited)",
+		get:         func() int64 { return debug.SetMemoryLimit(-1) },
+		set: func(v int64) {
+			if v < 0 {
+				v = math.MaxInt64
+			}
+			debug.SetMemoryLimit(v)
+		},
+		validate: func(v int64) error {
+			if v < -1 {
+				return fmt.Errorf("must be -1 (unlimited) or a number of bytes")
+			}
+			return nil
+		},
+		format: func(v int64) string {
+			if v < 0 || v == math.MaxInt64 {
+				return "unlimited"
+			}
+			return formatValue(v)
+		},
+	},
+	"gomaxprocs": {
+		name:        "gomaxprocs",
+		description: "runtime.GOMAXPROCS: maximum number of CPUs executing Go code simultaneously",
+		get:         func() int64 { return int64(runtime.GOMAXPROCS(0)) },
+		set:         func(v int64) { runtime.GOMAXPROCS(int(v)) },
+		validate: func(v int64) error {
+			if v < 1 {
+				return fmt.Errorf("must be at least 1")
+			}
+			return nil
+		},
+		format: formatInt,
+	},
+}
+
+// runtimeSettingNames returns the names of the runtime settings, sorted.
+func runtimeSettingNames() []string {
+	names := make([]string, 0, len(runtimeSettings))
+	for name := range runtimeSettings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func nonNegative(v int64) error {
+	if v < 0 {
+		return fmt.Errorf("must not be negative")
+	}
+	return nil
+}
+
+func formatInt(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+// pendingRevert is a change that is reverted when its TTL expires.
+type pendingRevert struct {
+	// original is the value before the first of possibly several changes with a TTL.
+	original int64
+	at       time.Time
+	timer    *time.Timer
+	// a is the agent that made the last change; the revert is audited there.
+	a *agent
+}
+
+// runtimeControl changes runtime settings and reverts changes made with a TTL.
+// Settings are process-wide, so pending reverts are shared by all agents.
+type runtimeControl struct {
+	mu      sync.Mutex
+	reverts map[string]*pendingRevert
+}
+
+// processRuntimeControl is the runtime control of all agents in the process.
+var processRuntimeControl = &runtimeControl{reverts: make(map[string]*pendingRevert)}
+
+// enableRuntimeControl enables runtime control for an agent. The pending reverts
+// of the agent's changes are applied when ctx is cancelled, so temporary changes
+// do not outlive the server.
+func enableRuntimeControl(ctx context.Context, a *agent) *runtimeControl {
+	c := processRuntimeControl
+	go func() {
+		<-ctx.Done()
+		c.revertAll(a)
+	}()
+	return c
+}
+
+// set changes a runtime setting on behalf of agent a and returns the previous value.
+// With a positive ttl, the setting is reverted when the ttl expires. A change to a
+// setting with a pending revert, made by any agent, replaces the revert time but
+// keeps the value to revert to.
+func (c *runtimeControl) set(a *agent, identity, tool string, s runtimeSetting, v int64, ttl time.Duration) (int64, error) {
+	if err := s.validate(v); err != nil {
+		return 0, fmt.Errorf("invalid value for %s: %w", s.name, err)
+	}
+	if ttl > 0 && s.revertible != nil {
+		if err := s.revertible(); err != nil {
+			return 0, fmt.Errorf("cannot change %s with a ttl: %w", s.name, err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prev := s.get()
+	s.set(v)
+
+	detail := fmt.Sprintf("%s -> %s", s.format(prev), s.format(v))
+	pending, ok := c.reverts[s.name]
+	if ok {
+		pending.timer.Stop()
+		delete(c.reverts, s.name)
+	}
+	if ttl > 0 {
+		original := prev
+		if ok {
+			original = pending.original
+		}
+		p := &pendingRevert{original: original, at: time.Now().Add(ttl), a: a}
+		p.timer = time.AfterFunc(ttl, func() { c.revert(s.name, p) })
+		c.reverts[s.name] = p
+		detail += fmt.Sprintf(", reverts to %s in %s", s.format(original), ttl)
+	} else if ok {
+		detail += ", pending revert cancelled"
+	}
+	a.audit(AuditEntry{Identity: identity, Tool: tool, Action: "set " + s.name, Detail: detail})
+	return prev, nil
+}
+
+// revert restores a setting to the original value of its pending revert p.
+// It does nothing if p was replaced or cancelled by a later change.
+func (c *runtimeControl) revert(name string, p *pendingRevert) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pending, ok := c.reverts[name]
+	if !ok || pending != p {
+		return
+	}
+	pending.timer.Stop()
+	delete(c.reverts, name)
+
+	s := runtimeSettings[name]
+	prev := s.get()
+	s.set(pending.original)
+	pending.a.audit(AuditEntry{
+		Tool:   "ttl",
+		Action: "revert " + name,
+		Detail: fmt.Sprintf("%s -> %s", s.format(prev), s.format(pending.original)),
+	})
+}
+
+// revertAll applies the pending reverts of the last changes made by agent a.
+func (c *runtimeControl) revertAll(a *agent) {
+	c.mu.Lock()
+	pending := make(map[string]*pendingRevert, len(c.reverts))
+	for name, p := range c.reverts {
+		if p.a == a {
+			pending[name] = p
+		}
+	}
+	c.mu.Unlock()
+	for name, p := range pending {
+		c.revert(name, p)
+	}
+}
+
+// pending returns the pending revert of a setting, if any.
+func (c *runtimeControl) pending(name string) (pendingRevert, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.reverts[name]; ok {
+		return *p, true
+	}
+	return pendingRevert{}, false
+}
+
+// RuntimeSettingsHandler lists the runtime settings that can be changed with
+// set-runtime-setting, their current values and pending reverts.
+func RuntimeSettingsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+	if a.control == nil {
+		return handleMCPError(fmt.Errorf("runtime control is not enabled")), nil
+	}
+
+	var result strings.Builder
+	result.WriteString("Runtime settings\n\n")
+	for _, name := range runtimeSettingNames() {
+		s := runtimeSettings[name]
+		result.WriteString(fmt.Sprintf("%s: %s", name, s.format(s.get())))
+		if p, ok := a.control.pending(name); ok {
+			result.WriteString(fmt.Sprintf(" (reverts to %s in %s)", s.format(p.original), time.Until(p.at).Round(time.Second)))
+		}
+		result.WriteString(fmt.Sprintf("\n  %s\n", s.description))
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(result.String()),
+		},
+	}, nil
+}
+
+// SetRuntimeSettingHandler changes a runtime setting, optionally for a limited time.
+func SetRuntimeSettingHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+	if a.control == nil {
+		return handleMCPError(fmt.Errorf("runtime control is not enabled")), nil
+	}
+
+	name, _ := request.Params.Arguments["setting"].(string)
+	s, ok := runtimeSettings[name]
+	if !ok {
+		return handleMCPError(fmt.Errorf("unknown runtime setting %q, expected one of %s",
+			name, strings.Join(runtimeSettingNames(), ", "))), nil
+	}
+	value, ok := request.Params.Arguments["value"].(float64)
+	if !ok {
+		return handleMCPError(fmt.Errorf("value is required")), nil
+	}
+	var ttl time.Duration
+	if v, ok := request.Params.Arguments["ttl"].(float64); ok && v > 0 {
+		ttl = time.Duration(v * float64(time.Second))
+	}
+
+	identity, _ := identityFromContext(ctx)
+	prev, err := a.control.set(a, identity, "set-runtime-setting", s, int64(value), ttl)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+
+	text := fmt.Sprintf("%s changed from %s to %s", name, s.format(prev), s.format(s.get()))
+	if p, ok := a.control.pending(name); ok {
+		text += fmt.Sprintf("; reverts to %s at %s", s.format(p.original), p.at.Format(time.RFC3339))
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(text),
+		},
+	}, nil
+}
+
+// ForceGCHandler runs a garbage collection, and optionally returns as much memory
+// to the operating system as possible with debug.FreeOSMemory.
+func ForceGCHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+	if a.control == nil {
+		return handleMCPError(fmt.Errorf("runtime control is not enabled")), nil
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	action := "gc"
+	start := time.Now()
+	if free, _ := request.Params.Arguments["free_os_memory"].(bool); free {
+		action = "free_os_memory"
+		debug.FreeOSMemory()
+	} else {
+		runtime.GC()
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	detail := fmt.Sprintf("heap in use %s -> %s, released to OS %s -> %s, took %s",
+		formatValue(int64(before.HeapInuse)), formatValue(int64(after.HeapInuse)),
+		formatValue(int64(before.HeapReleased)), formatValue(int64(after.HeapReleased)),
+		elapsed.Round(time.Microsecond))
+	identity, _ := identityFromContext(ctx)
+	a.audit(AuditEntry{Identity: identity, Tool: "force-gc", Action: action, Detail: detail})
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(fmt.Sprintf("Ran %s: %s", action, detail)),
+		},
+	}, nil
+}
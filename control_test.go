@@ -0,0 +1,238 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestSetRuntimeSettingHandler(t *testing.T) {
+	defer runtime.SetMutexProfileFraction(runtime.SetMutexProfileFraction(-1))
+	runtime.SetMutexProfileFraction(0)
+
+	_, disabled := newPprofServer(newConfig())
+	_, a := newPprofServer(newConfig(WithRuntimeControl(), WithAuditSink(NewJSONLinesAuditSink(&strings.Builder{}))))
+	tests := []struct {
+		name      string
+		agent     *agent
+		arguments map[string]interface{}
+		want      string
+		wantErr   string
+	}{
+		{
+			name:      "disabled",
+			agent:     disabled,
+			arguments: map[string]interface{}{"setting": "gogc", "value": 50.0},
+			wantErr:   "runtime control is not enabled",
+		},
+		{
+			name:      "unknown setting",
+			agent:     a,
+			arguments: map[string]interface{}{"setting": "gcpercent", "value": 50.0},
+			wantErr:   `unknown runtime setting "gcpercent", expected one of block_profile_rate, gogc, gomaxprocs, gomemlimit, mutex_profile_fraction`,
+		},
+		{
+			name:      "missing value",
+			agent:     a,
+			arguments: map[string]interface{}{"setting": "gogc"},
+			wantErr:   "value is required",
+		},
+		{
+			name:      "invalid gogc",
+			agent:     a,
+			arguments: map[string]interface{}{"setting": "gogc", "value": -2.0},
+			wantErr:   "invalid value for gogc: must be -1 (off) or a percentage",
+		},
+		{
+			name:      "invalid gomaxprocs",
+			agent:     a,
+			arguments: map[string]interface{}{"setting": "gomaxprocs", "value": 0.0},
+			wantErr:   "invalid value for gomaxprocs: must be at least 1",
+		},
+		{
+			name:      "invalid fraction",
+			agent:     a,
+			arguments: map[string]interface{}{"setting": "mutex_profile_fraction", "value": -1.0},
+			wantErr:   "invalid value for mutex_profile_fraction: must not be negative",
+		},
+		{
+			name:      "set",
+			agent:     a,
+			arguments: map[string]interface{}{"setting": "mutex_profile_fraction", "value": 5.0},
+			want:      "mutex_profile_fraction changed from 0 to 5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), agentKey{}, tt.agent)
+			var request mcp.CallToolRequest
+			request.Params.Arguments = tt.arguments
+			result, err := SetRuntimeSettingHandler(ctx, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := resultText(result)
+			if tt.wantErr != "" {
+				if !result.IsError || !strings.Contains(out, tt.wantErr) {
+					t.Fatalf("result = %q, want error %q", out, tt.wantErr)
+				}
+				return
+			}
+			if result.IsError || out != tt.want {
+				t.Fatalf("result = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuntimeControlRevert(t *testing.T) {
+	defer runtime.SetMutexProfileFraction(runtime.SetMutexProfileFraction(-1))
+	runtime.SetMutexProfileFraction(0)
+	s := runtimeSettings["mutex_profile_fraction"]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, a := newPprofServer(newConfig(WithContext(ctx), WithRuntimeControl(), WithAuditSink(NewJSONLinesAuditSink(&strings.Builder{}))))
+	c := a.control
+
+	// A second change with a TTL keeps the value to revert to.
+	if _, err := c.set(a, "alice", "set-runtime-setting", s, 5, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.set(a, "alice", "set-runtime-setting", s, 10, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := c.pending(s.name); !ok || p.original != 0 {
+		t.Fatalf("pending revert = %+v, %t; want a revert to 0", p, ok)
+	}
+	waitFor(t, func() bool { return s.get() == 0 })
+	if _, ok := c.pending(s.name); ok {
+		t.Error("revert is still pending after it was applied")
+	}
+
+	// A change without a TTL cancels the pending revert.
+	if _, err := c.set(a, "alice", "set-runtime-setting", s, 5, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.set(a, "alice", "set-runtime-setting", s, 7, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := s.get(); got != 7 {
+		t.Errorf("%s = %d after a cancelled revert, want 7", s.name, got)
+	}
+
+	// Cancelling the context applies pending reverts.
+	if _, err := c.set(a, "alice", "set-runtime-setting", s, 20, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	all := func(AuditEntry) bool { return true }
+	waitFor(t, func() bool { return len(a.auditLog.list(10, all)) == 7 })
+	if got := s.get(); got != 7 {
+		t.Errorf("%s = %d after the context was cancelled, want 7", s.name, got)
+	}
+
+	var actions []string
+	for _, e := range a.auditLog.list(10, all) {
+		actions = append([]string{e.Tool + " " + e.Action + ": " + e.Detail}, actions...)
+	}
+	want := []string{
+		"set-runtime-setting set mutex_profile_fraction: 0 -> 5, reverts to 0 in 1h0m0s",
+		"set-runtime-setting set mutex_profile_fraction: 5 -> 10, reverts to 0 in 50ms",
+		"ttl revert mutex_profile_fraction: 10 -> 0",
+		"set-runtime-setting set mutex_profile_fraction: 0 -> 5, reverts to 0 in 50ms",
+		"set-runtime-setting set mutex_profile_fraction: 5 -> 7, pending revert cancelled",
+		"set-runtime-setting set mutex_profile_fraction: 7 -> 20, reverts to 7 in 1h0m0s",
+		"ttl revert mutex_profile_fraction: 20 -> 7",
+	}
+	if strings.Join(actions, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audit entries:\n%s\nwant:\n%s", strings.Join(actions, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRuntimeControlShared(t *testing.T) {
+	defer runtime.SetMutexProfileFraction(runtime.SetMutexProfileFraction(-1))
+	runtime.SetMutexProfileFraction(0)
+	s := runtimeSettings["mutex_profile_fraction"]
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	_, a1 := newPprofServer(newConfig(WithContext(ctx1), WithRuntimeControl(), WithAuditSink(NewJSONLinesAuditSink(&strings.Builder{}))))
+	_, a2 := newPprofServer(newConfig(WithContext(ctx2), WithRuntimeControl(), WithAuditSink(NewJSONLinesAuditSink(&strings.Builder{}))))
+
+	if _, err := a1.control.set(a1, "alice", "set-runtime-setting", s, 5, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	result, err := RuntimeSettingsHandler(context.WithValue(context.Background(), agentKey{}, a2), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := resultText(result); !strings.Contains(out, "mutex_profile_fraction: 5 (reverts to 0 in ") {
+		t.Errorf("runtime settings of another agent do not show the pending revert:\n%s", out)
+	}
+
+	// Cancelling the context of another agent leaves the change alone.
+	cancel2()
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := a1.control.pending(s.name); !ok || s.get() != 5 {
+		t.Errorf("%s = %d, pending revert %t after another agent stopped; want 5 with a pending revert", s.name, s.get(), ok)
+	}
+
+	// A change through another agent cancels the pending revert.
+	_, a3 := newPprofServer(newConfig(WithRuntimeControl(), WithAuditSink(NewJSONLinesAuditSink(&strings.Builder{}))))
+	if _, err := a3.control.set(a3, "bob", "set-runtime-setting", s, 7, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a1.control.pending(s.name); ok {
+		t.Error("revert is still pending after another agent changed the setting")
+	}
+	entries := a3.auditLog.list(10, func(AuditEntry) bool { return true })
+	if len(entries) != 1 || entries[0].Detail != "5 -> 7, pending revert cancelled" {
+		t.Errorf("audit entries of the other agent = %+v", entries)
+	}
+}
+
+func TestBlockProfileRateTTL(t *testing.T) {
+	blockProfileRateKnown.Store(false)
+	defer blockProfileRateKnown.Store(false)
+	defer runtime.SetBlockProfileRate(0)
+	s := runtimeSettings["block_profile_rate"]
+
+	_, a := newPprofServer(newConfig(WithRuntimeControl(), WithAuditSink(NewJSONLinesAuditSink(&strings.Builder{}))))
+	result, err := RuntimeSettingsHandler(context.WithValue(context.Background(), agentKey{}, a), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := resultText(result); !strings.Contains(out, "block_profile_rate: unknown\n") {
+		t.Errorf("runtime settings do not show the rate as unknown:\n%s", out)
+	}
+	want := "cannot change block_profile_rate with a ttl: the runtime does not report the current rate"
+	if _, err := a.control.set(a, "alice", "set-runtime-setting", s, 100, time.Hour); err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("change with a ttl: error = %v, want %q", err, want)
+	}
+
+	// With the rate recorded at startup, a change with a TTL reverts to it.
+	_, a = newPprofServer(newConfig(WithBlockProfileRate(1), WithRuntimeControl(), WithAuditSink(NewJSONLinesAuditSink(&strings.Builder{}))))
+	if _, err := a.control.set(a, "alice", "set-runtime-setting", s, 100, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return s.get() == 1 })
+}
+
+// waitFor waits up to a few seconds for cond to become true.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("condition not met in time")
+}
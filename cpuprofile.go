@@ -0,0 +1,55 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// cpuProfiler coordinates CPU profile captures. The runtime supports only one
+// CPU profile at a time, so a capture requested while another one is running
+// joins it and receives its result instead of failing with
+// "cpu profiling already in use".
+type cpuProfiler struct {
+	mu      sync.Mutex
+	current *cpuCapture
+}
+
+// cpuCapture is a running CPU profile capture.
+type cpuCapture struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// processCPUProfiler coordinates the CPU profile captures of all agents in the process:
+// tool calls, continuous profiling and threshold triggers.
+var processCPUProfiler = &cpuProfiler{}
+
+// capture samples CPU usage for d, or waits for the running capture and returns its profile.
+// A joined capture covers the running capture's time window rather than d.
+func (c *cpuProfiler) capture(ctx context.Context, request mcp.CallToolRequest, d time.Duration) ([]byte, error) {
+	c.mu.Lock()
+	if running := c.current; running != nil {
+		c.mu.Unlock()
+		select {
+		case <-running.done:
+			return running.data, running.err
+		case <-ctx.Done():
+			return nil, &ProfileError{ProfileType: ProfileTypeCPU, Err: ctx.Err()}
+		}
+	}
+	capture := &cpuCapture{done: make(chan struct{})}
+	c.current = capture
+	c.mu.Unlock()
+
+	capture.data, capture.err = captureCPUProfile(ctx, request, d)
+
+	c.mu.Lock()
+	c.current = nil
+	c.mu.Unlock()
+	close(capture.done)
+	return capture.data, capture.err
+}
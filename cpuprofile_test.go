@@ -0,0 +1,73 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestCPUProfilerConcurrentCaptures(t *testing.T) {
+	cpu := &cpuProfiler{}
+	source := localSource{cpu: cpu}
+	collector := newContinuousCollector(ContinuousProfilingConfig{
+		Interval:     time.Second,
+		CPUDuration:  300 * time.Millisecond,
+		ProfileTypes: []string{ProfileTypeCPU},
+		Capacity:     10,
+	}, source)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		collector.collect(context.Background())
+	}()
+
+	// Start the on-demand capture while the continuous one is running
+	time.Sleep(50 * time.Millisecond)
+	data, err := source.Profile(context.Background(), mcp.CallToolRequest{}, ProfileTypeCPU, 300*time.Millisecond)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("on-demand capture failed: %v", err)
+	}
+	if _, err := profile.ParseData(data); err != nil {
+		t.Fatalf("on-demand capture returned an invalid profile: %v", err)
+	}
+	if n := len(collector.ring.List(ProfileTypeCPU)); n != 1 {
+		t.Fatalf("continuous collection stored %d CPU profiles, want 1", n)
+	}
+}
+
+func TestCPUProfilerSequentialCaptures(t *testing.T) {
+	cpu := &cpuProfiler{}
+	for i := 0; i < 2; i++ {
+		data, err := cpu.capture(context.Background(), mcp.CallToolRequest{}, 50*time.Millisecond)
+		if err != nil {
+			t.Fatalf("capture %d failed: %v", i, err)
+		}
+		if _, err := profile.ParseData(data); err != nil {
+			t.Fatalf("capture %d returned an invalid profile: %v", i, err)
+		}
+	}
+}
+
+func TestCPUProfilerJoinCancelled(t *testing.T) {
+	cpu := &cpuProfiler{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = cpu.capture(context.Background(), mcp.CallToolRequest{}, 300*time.Millisecond)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cpu.capture(ctx, mcp.CallToolRequest{}, time.Second); err == nil {
+		t.Error("joining capture with a cancelled context succeeded")
+	}
+	<-done
+}
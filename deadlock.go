@@ -0,0 +1,561 @@
+package pprofmcpagent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxDeadlockStackFrames is the number of application frames shown per group of blocked goroutines.
+const maxDeadlockStackFrames = 6
+
+// Kinds of blocking operations.
+const (
+	blockMutex     = "mutex"
+	blockRWMutex   = "rwmutex"
+	blockWaitGroup = "waitgroup"
+	blockCond      = "cond"
+	blockChannel   = "channel"
+	blockSelect    = "select"
+	blockSema      = "semaphore"
+)
+
+// goroutineHeader matches the first line of a goroutine in a debug=2 dump,
+// e.g. "goroutine 6 [sync.Mutex.Lock, 2 minutes]:".
+var goroutineHeader = regexp.MustCompile(`^goroutine (\d+)(?: gp=\S+ m=\S+(?: mp=\S+)?)? \[([^\]]*)\]:$`)
+
+// stackFrame is a function call in a goroutine stack.
+type stackFrame struct {
+	Function string
+	Args     []string
+	File     string
+	Line     int
+}
+
+func (f stackFrame) String() string {
+	return fmt.Sprintf("%s (%s:%d)", f.Function, f.File, f.Line)
+}
+
+// goroutineStack is a goroutine parsed from a debug=2 dump.
+type goroutineStack struct {
+	ID      int
+	State   string
+	Minutes int
+	Frames  []stackFrame // ordered from leaf to root
+}
+
+// parseGoroutineDump parses the stacks of a goroutine dump in the text format
+// of the goroutine profile with debug=2, or of a panic or SIGQUIT dump.
+func parseGoroutineDump(data []byte) ([]*goroutineStack, error) {
+	var result []*goroutineStack
+	var g *goroutineStack
+	var pending *stackFrame
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := goroutineHeader.FindStringSubmatch(line); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			g = &goroutineStack{ID: id}
+			g.State, g.Minutes = parseGoroutineState(m[2])
+			result = append(result, g)
+			pending = nil
+			continue
+		}
+		if g == nil || strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "\t") {
+			// The file and line of the preceding call.
+			if pending == nil {
+				continue
+			}
+			loc := strings.TrimSpace(line)
+			if i := strings.LastIndex(loc, " +0x"); i >= 0 {
+				loc = loc[:i]
+			}
+			if i := strings.LastIndex(loc, ":"); i >= 0 {
+				pending.File = loc[:i]
+				pending.Line, _ = strconv.Atoi(loc[i+1:])
+			}
+			g.Frames = append(g.Frames, *pending)
+			pending = nil
+			continue
+		}
+
+		if strings.HasPrefix(line, "created by ") {
+			// The creating call site is not part of the goroutine's own stack.
+			pending = nil
+			continue
+		}
+		// A call such as "main.(*T).transfer(0x0?, 0xc000012130)"; arguments never contain parentheses.
+		if i := strings.LastIndex(line, "("); i > 0 && strings.HasSuffix(line, ")") {
+			frame := stackFrame{Function: line[:i]}
+			if args := line[i+1 : len(line)-1]; args != "" && args != "..." {
+				for _, arg := range strings.Split(args, ",") {
+					frame.Args = append(frame.Args, strings.Trim(strings.TrimSpace(arg), "{}"))
+				}
+			}
+			pending = &frame
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read goroutine dump: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no goroutines found; expected a goroutine dump in debug=2 format")
+	}
+	return result, nil
+}
+
+// parseGoroutineState splits a goroutine status such as "chan receive, 5 minutes, locked to thread"
+// into the wait reason and the number of minutes the goroutine has been waiting.
+func parseGoroutineState(status string) (string, int) {
+	parts := strings.Split(status, ", ")
+	minutes := 0
+	for _, part := range parts[1:] {
+		if n, ok := strings.CutSuffix(part, " minutes"); ok {
+			minutes, _ = strconv.Atoi(n)
+		}
+	}
+	return parts[0], minutes
+}
+
+// blockKind classifies what a goroutine is blocked on, or returns "" if it
+// is not blocked on a synchronization primitive.
+func (g *goroutineStack) blockKind() string {
+	switch {
+	case g.State == "sync.Mutex.Lock":
+		return blockMutex
+	case strings.HasPrefix(g.State, "sync.RWMutex."):
+		return blockRWMutex
+	case g.State == "sync.WaitGroup.Wait":
+		return blockWaitGroup
+	case g.State == "sync.Cond.Wait":
+		return blockCond
+	case strings.HasPrefix(g.State, "chan send"), strings.HasPrefix(g.State, "chan receive"):
+		return blockChannel
+	case strings.HasPrefix(g.State, "select"):
+		return blockSelect
+	case g.State == "semacquire":
+		// Older Go versions report all sync primitives as semacquire.
+		for _, f := range g.Frames {
+			switch {
+			case strings.Contains(f.Function, "(*RWMutex)."):
+				return blockRWMutex
+			case strings.Contains(f.Function, "(*Mutex)."):
+				return blockMutex
+			case strings.Contains(f.Function, "(*WaitGroup)."):
+				return blockWaitGroup
+			case strings.Contains(f.Function, "(*Cond)."):
+				return blockCond
+			}
+		}
+		return blockSema
+	}
+	return ""
+}
+
+// active reports whether the goroutine is running or can run.
+func (g *goroutineStack) active() bool {
+	return g.State == "running" || g.State == "runnable" || g.State == "syscall"
+}
+
+// isDumper reports whether the goroutine is the one writing the dump.
+func (g *goroutineStack) isDumper() bool {
+	for _, f := range g.Frames {
+		if strings.HasPrefix(f.Function, "runtime/pprof.writeGoroutine") {
+			return true
+		}
+	}
+	return false
+}
+
+// waitSite returns the first frame outside of the runtime and sync packages,
+// which is the code that performed the blocking operation.
+func (g *goroutineStack) waitSite() (stackFrame, int) {
+	for i, f := range g.Frames {
+		if !isSyncInternal(f.Function) {
+			return f, i
+		}
+	}
+	if len(g.Frames) > 0 {
+		return g.Frames[len(g.Frames)-1], len(g.Frames) - 1
+	}
+	return stackFrame{Function: "(no stack)"}, 0
+}
+
+// lockAddress returns the address of the mutex the goroutine waits for,
+// taken from the receiver of the outermost mutex method with a known argument.
+func (g *goroutineStack) lockAddress() string {
+	addr := ""
+	for _, f := range g.Frames {
+		if !strings.Contains(f.Function, "(*Mutex).") && !strings.Contains(f.Function, "(*RWMutex).") {
+			continue
+		}
+		if len(f.Args) > 0 && isAddress(f.Args[0]) {
+			addr = f.Args[0]
+		}
+	}
+	return addr
+}
+
+// referencedAddresses returns the pointer arguments of the frames from index start on.
+// A goroutine that references the address of a mutex in its callers may be holding it,
+// as mutexes are often the first field of the struct whose methods lock them.
+func (g *goroutineStack) referencedAddresses(start int) map[string]bool {
+	refs := make(map[string]bool)
+	for _, f := range g.Frames[start:] {
+		for _, arg := range f.Args {
+			arg = strings.TrimSuffix(arg, "?")
+			if isAddress(arg) {
+				refs[arg] = true
+			}
+		}
+	}
+	return refs
+}
+
+func isAddress(arg string) bool {
+	return strings.HasPrefix(arg, "0x") && !strings.HasSuffix(arg, "?") && len(arg) > 6
+}
+
+func isSyncInternal(function string) bool {
+	return strings.HasPrefix(function, "runtime.") ||
+		strings.HasPrefix(function, "sync.") ||
+		strings.HasPrefix(function, "internal/")
+}
+
+// blockedGroup is a set of goroutines blocked by the same kind of operation at the same call site.
+type blockedGroup struct {
+	kind       string
+	site       stackFrame
+	goroutines []*goroutineStack
+	maxMinutes int
+}
+
+// deadlockReport is the result of analyzing a goroutine dump.
+type deadlockReport struct {
+	total, active, blocked int
+	groups                 []*blockedGroup
+	locks                  []lockContention
+	cycles                 []string
+	// allAsleep is set when every goroutine but the dumper is blocked on synchronization.
+	allAsleep bool
+	// idle is set when no goroutine can run, but some wait for IO, timers or other events.
+	idle bool
+}
+
+// lockContention is a mutex that goroutines wait for, with its possible holders.
+type lockContention struct {
+	addr    string
+	waiters []*goroutineStack
+	holders []*goroutineStack
+}
+
+// analyzeGoroutineDump groups blocked goroutines, finds the mutexes they wait for
+// and their possible holders, and looks for lock-order cycles.
+func analyzeGoroutineDump(goroutines []*goroutineStack) *deadlockReport {
+	r := &deadlockReport{}
+	groups := make(map[string]*blockedGroup)
+	waiting := make(map[string][]*goroutineStack) // mutex address -> waiters
+	for _, g := range goroutines {
+		if g.isDumper() {
+			continue
+		}
+		r.total++
+		if g.active() {
+			r.active++
+		}
+		kind := g.blockKind()
+		if kind == "" {
+			continue
+		}
+		r.blocked++
+
+		site, _ := g.waitSite()
+		key := kind + "|" + site.String()
+		group, ok := groups[key]
+		if !ok {
+			group = &blockedGroup{kind: kind, site: site}
+			groups[key] = group
+			r.groups = append(r.groups, group)
+		}
+		group.goroutines = append(group.goroutines, g)
+		if g.Minutes > group.maxMinutes {
+			group.maxMinutes = g.Minutes
+		}
+
+		if kind == blockMutex || kind == blockRWMutex {
+			if addr := g.lockAddress(); addr != "" {
+				waiting[addr] = append(waiting[addr], g)
+			}
+		}
+	}
+	sort.SliceStable(r.groups, func(i, j int) bool {
+		return len(r.groups[i].goroutines) > len(r.groups[j].goroutines)
+	})
+
+	// Possible holders reference a contended mutex in a frame above their wait site.
+	holds := make(map[int]map[string]bool)
+	for addr, waiters := range waiting {
+		lc := lockContention{addr: addr, waiters: waiters}
+		for _, g := range goroutines {
+			if g.isDumper() || g.lockAddress() == addr {
+				continue
+			}
+			_, siteIndex := g.waitSite()
+			if g.referencedAddresses(siteIndex)[addr] {
+				lc.holders = append(lc.holders, g)
+				if holds[g.ID] == nil {
+					holds[g.ID] = make(map[string]bool)
+				}
+				holds[g.ID][addr] = true
+			}
+		}
+		r.locks = append(r.locks, lc)
+	}
+	sort.Slice(r.locks, func(i, j int) bool { return r.locks[i].addr < r.locks[j].addr })
+
+	r.cycles = findLockCycles(r.locks, holds)
+	r.cycles = append(r.cycles, findLockOrderInversions(r.groups)...)
+	// Goroutines waiting for IO, timers or other events can wake the blocked ones,
+	// so only a process whose goroutines are all blocked on synchronization is asleep.
+	r.allAsleep = r.total > 0 && r.blocked == r.total
+	r.idle = r.active == 0 && r.blocked > 0 && !r.allAsleep
+	return r
+}
+
+// findLockCycles looks for cycles in the wait-for graph built from the possible
+// holders of each contended mutex: goroutine A waits for a mutex possibly held by B,
+// which waits for a mutex possibly held by A.
+func findLockCycles(locks []lockContention, holds map[int]map[string]bool) []string {
+	waitsFor := make(map[int][]int) // waiter -> possible holders
+	for _, lc := range locks {
+		for _, w := range lc.waiters {
+			for _, h := range lc.holders {
+				waitsFor[w.ID] = append(waitsFor[w.ID], h.ID)
+			}
+		}
+	}
+
+	var cycles []string
+	seen := make(map[string]bool)
+	var ids []int
+	for id := range waitsFor {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, start := range ids {
+		var path []int
+		var visit func(id int) bool
+		visit = func(id int) bool {
+			for i, p := range path {
+				if p == id {
+					cycle := append([]int(nil), path[i:]...)
+					sort.Ints(cycle)
+					key := fmt.Sprint(cycle)
+					if !seen[key] {
+						seen[key] = true
+						cycles = append(cycles, fmt.Sprintf("goroutines %s wait for mutexes held by each other (based on mutex addresses referenced in their stacks)",
+							joinInts(path[i:])))
+					}
+					return true
+				}
+			}
+			path = append(path, id)
+			for _, next := range waitsFor[id] {
+				if visit(next) {
+					return true
+				}
+			}
+			path = path[:len(path)-1]
+			return false
+		}
+		visit(start)
+	}
+	return cycles
+}
+
+// findLockOrderInversions flags goroutines that wait at the same Lock call site for
+// different mutexes. This is the typical shape of a lock-order inversion, e.g.
+// transfer(a, b) and transfer(b, a) each holding the first lock and waiting for the second.
+func findLockOrderInversions(groups []*blockedGroup) []string {
+	var result []string
+	for _, group := range groups {
+		if group.kind != blockMutex && group.kind != blockRWMutex {
+			continue
+		}
+		addrs := make(map[string]bool)
+		for _, g := range group.goroutines {
+			if addr := g.lockAddress(); addr != "" {
+				addrs[addr] = true
+			}
+		}
+		if len(addrs) < 2 {
+			continue
+		}
+		var ids []int
+		for _, g := range group.goroutines {
+			ids = append(ids, g.ID)
+		}
+		result = append(result, fmt.Sprintf("goroutines %s wait at %s for %d different mutexes; "+
+			"if each holds a lock another one waits for, locks are acquired in inconsistent order",
+			joinInts(ids), group.site, len(addrs)))
+	}
+	return result
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// format renders the report.
+func (r *deadlockReport) format(limit int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Goroutines: %d (running or runnable: %d, blocked on synchronization: %d, other: %d)\n\n",
+		r.total, r.active, r.blocked, r.total-r.active-r.blocked)
+
+	if r.allAsleep {
+		b.WriteString("WARNING: every goroutine is blocked on mutexes, wait groups, condition variables or channels, ")
+		b.WriteString("and none waits for IO or a timer. Unless a timer fires for a goroutine receiving from a timer channel ")
+		b.WriteString("or selecting on one, the process is deadlocked (\"all goroutines are asleep\").\n\n")
+	}
+	if r.idle {
+		fmt.Fprintf(&b, "Hint: no goroutine is running or runnable, but %d goroutine(s) wait for IO, timers or other events ", r.total-r.blocked)
+		b.WriteString("and may wake the blocked ones. This is normal for an idle process; compare with a later dump ")
+		b.WriteString("to see whether the blocked goroutines make progress.\n\n")
+	}
+
+	if len(r.cycles) > 0 {
+		b.WriteString("Likely lock-order cycles:\n")
+		for _, c := range r.cycles {
+			fmt.Fprintf(&b, "- %s\n", c)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(r.locks) > 0 {
+		b.WriteString("Contended mutexes (holders are inferred from mutex addresses referenced in stacks and may be incomplete):\n")
+		for _, lc := range r.locks {
+			fmt.Fprintf(&b, "mutex %s\n", lc.addr)
+			for _, g := range lc.waiters {
+				site, _ := g.waitSite()
+				fmt.Fprintf(&b, "  waits: goroutine %d at %s\n", g.ID, site)
+			}
+			if len(lc.holders) == 0 {
+				b.WriteString("  holds: unknown\n")
+			}
+			for _, g := range lc.holders {
+				site, _ := g.waitSite()
+				fmt.Fprintf(&b, "  holds: goroutine %d [%s] at %s\n", g.ID, g.State, site)
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	if len(r.groups) == 0 {
+		b.WriteString("No goroutines are blocked on mutexes, wait groups, condition variables or channels.\n")
+		return b.String()
+	}
+	b.WriteString("Blocked goroutines by call site:\n")
+	for i, group := range r.groups {
+		if i >= limit {
+			fmt.Fprintf(&b, "... %d more call sites\n", len(r.groups)-limit)
+			break
+		}
+		fmt.Fprintf(&b, "[%s] %d goroutine(s) at %s", group.kind, len(group.goroutines), group.site)
+		if group.maxMinutes > 0 {
+			fmt.Fprintf(&b, ", waiting up to %d minutes", group.maxMinutes)
+		}
+		b.WriteString("\n")
+
+		var ids []int
+		for _, g := range group.goroutines {
+			ids = append(ids, g.ID)
+		}
+		if len(ids) > 20 {
+			fmt.Fprintf(&b, "  goroutines: %s, ...\n", joinInts(ids[:20]))
+		} else {
+			fmt.Fprintf(&b, "  goroutines: %s\n", joinInts(ids))
+		}
+
+		g := group.goroutines[0]
+		_, siteIndex := g.waitSite()
+		b.WriteString("  stack:\n")
+		for j, f := range g.Frames[siteIndex:] {
+			if j >= maxDeadlockStackFrames {
+				b.WriteString("    ...\n")
+				break
+			}
+			fmt.Fprintf(&b, "    %s\n", f)
+		}
+	}
+	return b.String()
+}
+
+// DeadlockHandler analyzes goroutine stacks for goroutines blocked on mutexes, wait groups,
+// condition variables and channels. It groups them by blocking call site, flags situations
+// where no goroutine can make progress, and reports likely lock-order cycles with the code
+// paths that hold and wait for contended mutexes.
+// The stacks come from the profiled process, or from a dump file in the profile directory.
+func DeadlockHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+	limit := 20
+	if limitParam, ok := request.Params.Arguments["limit"].(float64); ok {
+		limit = int(limitParam)
+	}
+
+	var data []byte
+	if name, _ := request.Params.Arguments["file"].(string); name != "" {
+		if a.files == nil {
+			return handleMCPError(fmt.Errorf("no profile directory is configured")), nil
+		}
+		path, err := a.files.resolve(name)
+		if err != nil {
+			return handleMCPError(err), nil
+		}
+		if info, err := os.Stat(path); err == nil && info.Size() > maxProfileFileBytes {
+			return handleMCPError(fmt.Errorf("%s is too large (%s)", name, formatValue(info.Size()))), nil
+		}
+		if data, err = os.ReadFile(path); err != nil {
+			return handleMCPError(err), nil
+		}
+	} else {
+		source, err := a.sourceFor(request)
+		if err != nil {
+			return handleMCPError(err), nil
+		}
+		if data, err = source.GoroutineDump(ctx); err != nil {
+			return handleMCPError(err), nil
+		}
+	}
+
+	goroutines, err := parseGoroutineDump(data)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+	if err := a.redactor.goroutines(goroutines); err != nil {
+		return handleMCPError(err), nil
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(analyzeGoroutineDump(goroutines).format(limit)),
+		},
+	}, nil
+}
@@ -0,0 +1,147 @@
+package pprofmcpagent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The goroutine dumps in testdata/goroutines were written with
+// pprof.Lookup("goroutine").WriteTo(w, 2) by small programs: an idle HTTP server
+// with a ticker and a sleeping goroutine, workers blocked sending to a channel
+// nobody receives from, and two transfers locking two accounts in opposite order.
+
+func TestAnalyzeGoroutineDump(t *testing.T) {
+	tests := []struct {
+		file       string
+		total      int
+		blocked    int
+		allAsleep  bool
+		idle       bool
+		cycles     int
+		groupKinds []string
+		contains   []string
+	}{
+		{
+			file:       "idle.txt",
+			total:      4,
+			blocked:    2,
+			idle:       true,
+			groupKinds: []string{blockChannel, blockChannel},
+			contains:   []string{"Hint: no goroutine is running or runnable, but 2 goroutine(s) wait for IO"},
+		},
+		{
+			file:       "deadlock.txt",
+			total:      4,
+			blocked:    4,
+			allAsleep:  true,
+			groupKinds: []string{blockChannel, blockWaitGroup},
+			contains: []string{
+				"WARNING: every goroutine is blocked",
+				"[channel] 3 goroutine(s) at main.worker",
+			},
+		},
+		{
+			file:       "cycle.txt",
+			total:      3,
+			blocked:    3,
+			allAsleep:  true,
+			cycles:     2,
+			groupKinds: []string{blockMutex, blockWaitGroup},
+			contains: []string{
+				"goroutines 7, 8 wait for mutexes held by each other",
+				"holds: goroutine 7",
+				"holds: goroutine 8",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", "goroutines", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			goroutines, err := parseGoroutineDump(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := analyzeGoroutineDump(goroutines)
+			if r.total != tt.total || r.blocked != tt.blocked {
+				t.Errorf("total, blocked = %d, %d; want %d, %d", r.total, r.blocked, tt.total, tt.blocked)
+			}
+			if r.active != 0 {
+				t.Errorf("active = %d, want 0 (the dumping goroutine is not counted)", r.active)
+			}
+			if r.allAsleep != tt.allAsleep || r.idle != tt.idle {
+				t.Errorf("allAsleep, idle = %v, %v; want %v, %v", r.allAsleep, r.idle, tt.allAsleep, tt.idle)
+			}
+			if len(r.cycles) != tt.cycles {
+				t.Errorf("cycles = %q, want %d", r.cycles, tt.cycles)
+			}
+			var kinds []string
+			for _, g := range r.groups {
+				kinds = append(kinds, g.kind)
+			}
+			if !reflect.DeepEqual(kinds, tt.groupKinds) {
+				t.Errorf("group kinds = %v, want %v", kinds, tt.groupKinds)
+			}
+
+			out := r.format(20)
+			for _, s := range tt.contains {
+				if !strings.Contains(out, s) {
+					t.Errorf("report does not contain %q:\n%s", s, out)
+				}
+			}
+			if !tt.allAsleep && strings.Contains(out, "all goroutines are asleep") {
+				t.Errorf("report claims all goroutines are asleep:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestParseGoroutineDump(t *testing.T) {
+	dump := `goroutine 7 [sync.Mutex.Lock, 3 minutes]:
+sync.(*Mutex).Lock(...)
+	/usr/local/go/src/sync/mutex.go:46
+main.transfer(0xc000012110, 0xc000012120, 0x1)
+	/app/main.go:19 +0x9c
+created by main.main in goroutine 1
+	/app/main.go:29 +0xde
+
+goroutine 1 gp=0xc000002380 m=nil [chan receive, locked to thread]:
+main.main()
+	/app/main.go:31 +0xdc
+`
+	goroutines, err := parseGoroutineDump([]byte(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*goroutineStack{
+		{
+			ID:      7,
+			State:   "sync.Mutex.Lock",
+			Minutes: 3,
+			Frames: []stackFrame{
+				{Function: "sync.(*Mutex).Lock", File: "/usr/local/go/src/sync/mutex.go", Line: 46},
+				{Function: "main.transfer", Args: []string{"0xc000012110", "0xc000012120", "0x1"}, File: "/app/main.go", Line: 19},
+			},
+		},
+		{
+			ID:     1,
+			State:  "chan receive",
+			Frames: []stackFrame{{Function: "main.main", File: "/app/main.go", Line: 31}},
+		},
+	}
+	if !reflect.DeepEqual(goroutines, want) {
+		for _, g := range goroutines {
+			t.Logf("%+v", *g)
+		}
+		t.Fatal("parsed goroutines differ")
+	}
+
+	if _, err := parseGoroutineDump([]byte("not a dump")); err == nil {
+		t.Error("parsing a non-dump succeeded")
+	}
+}
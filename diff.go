@@ -0,0 +1,39 @@
+package pprofmcpagent
+
+import (
+	"fmt"
+
+	"github.com/google/pprof/profile"
+)
+
+// diffSnapshots builds a delta profile holding current minus base values.
+// If normalize is true, the base is first scaled so that its totals match
+// the current profile, which compensates for different capture lengths.
+func diffSnapshots(base, current *Snapshot, normalize bool) (*profile.Profile, error) {
+	pb, err := base.Profile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base profile: %w", err)
+	}
+	pc, err := current.Profile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse current profile: %w", err)
+	}
+	return diffProfiles(pb, pc, normalize)
+}
+
+// diffProfiles merges current with the negated base profile.
+// The base profile is modified in place.
+func diffProfiles(base, current *profile.Profile, normalize bool) (*profile.Profile, error) {
+	if normalize {
+		if err := base.Normalize(current); err != nil {
+			return nil, fmt.Errorf("failed to normalize base profile: %w", err)
+		}
+	}
+	base.Scale(-1)
+
+	p, err := profile.Merge([]*profile.Profile{current, base})
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge profiles: %w", err)
+	}
+	return p, nil
+}
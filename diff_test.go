@@ -0,0 +1,131 @@
+package pprofmcpagent
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+var (
+	cpuSampleTypes  = []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}}
+	heapSampleTypes = []*profile.ValueType{
+		{Type: "alloc_objects", Unit: "count"}, {Type: "alloc_space", Unit: "bytes"},
+		{Type: "inuse_objects", Unit: "count"}, {Type: "inuse_space", Unit: "bytes"},
+	}
+)
+
+// flatProfile returns a profile with one sample per function, whose only frame is the function.
+func flatProfile(types []*profile.ValueType, values map[string][]int64) *profile.Profile {
+	p := &profile.Profile{SampleType: types, DefaultSampleType: types[len(types)-1].Type}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		fn := &profile.Function{ID: uint64(i + 1), Name: name}
+		loc := &profile.Location{ID: uint64(i + 1), Line: []profile.Line{{Function: fn}}}
+		p.Function = append(p.Function, fn)
+		p.Location = append(p.Location, loc)
+		p.Sample = append(p.Sample, &profile.Sample{Location: []*profile.Location{loc}, Value: values[name]})
+	}
+	return p
+}
+
+// cpuProfile returns a CPU profile with the given sample counts per function, 10ms each.
+func cpuProfile(samples map[string]int64) *profile.Profile {
+	values := make(map[string][]int64, len(samples))
+	for name, n := range samples {
+		values[name] = []int64{n, n * 10000000}
+	}
+	p := flatProfile(cpuSampleTypes, values)
+	p.PeriodType = &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	p.Period = 10000000
+	return p
+}
+
+// cpuRow formats the row of a function of cpuProfile with n samples in a flat view.
+func cpuRow(fn string, n int64) string {
+	return fn + ":0: " + formatValues([]int64{n, n * 10000000}, ProfileTypeCPU)
+}
+
+// heapProfile returns a heap profile with the given object counts per function, 1KB each.
+func heapProfile(objects map[string]int64) *profile.Profile {
+	values := make(map[string][]int64, len(objects))
+	for name, n := range objects {
+		values[name] = []int64{n, n * 1024, n, n * 1024}
+	}
+	p := flatProfile(heapSampleTypes, values)
+	p.PeriodType = &profile.ValueType{Type: "space", Unit: "bytes"}
+	p.Period = 512 * 1024
+	return p
+}
+
+func TestDiffProfiles(t *testing.T) {
+	line := func(sign, fn string, n int64) string {
+		return sign + " " + cpuRow(fn, n) + "\n"
+	}
+	tests := []struct {
+		name      string
+		base      map[string]int64
+		current   map[string]int64
+		normalize bool
+		want      string
+	}{
+		{
+			name:    "increases and decreases",
+			base:    map[string]int64{"main.a": 10, "main.b": 5, "main.c": 3},
+			current: map[string]int64{"main.a": 4, "main.b": 9, "main.c": 3, "main.d": 2},
+			want: "Increased (2 locations):\n" +
+				line("+", "main.b", 4) +
+				line("+", "main.d", 2) +
+				"\nDecreased (1 locations):\n" +
+				line("-", "main.a", -6),
+		},
+		{
+			name:    "sorted by magnitude",
+			base:    map[string]int64{"main.a": 1, "main.b": 20, "main.c": 5},
+			current: map[string]int64{"main.a": 31, "main.b": 2, "main.c": 4, "main.d": 11},
+			want: "Increased (2 locations):\n" +
+				line("+", "main.a", 30) +
+				line("+", "main.d", 11) +
+				"\nDecreased (2 locations):\n" +
+				line("-", "main.b", -18) +
+				line("-", "main.c", -1),
+		},
+		{
+			name:    "longer base capture",
+			base:    map[string]int64{"main.a": 40, "main.b": 40},
+			current: map[string]int64{"main.a": 10, "main.b": 30},
+			want: "Increased (0 locations):\n" +
+				"\nDecreased (2 locations):\n" +
+				line("-", "main.a", -30) +
+				line("-", "main.b", -10),
+		},
+		{
+			name:      "normalized",
+			base:      map[string]int64{"main.a": 40, "main.b": 40},
+			current:   map[string]int64{"main.a": 10, "main.b": 30},
+			normalize: true,
+			want: "Increased (1 locations):\n" +
+				line("+", "main.b", 10) +
+				"\nDecreased (1 locations):\n" +
+				line("-", "main.a", -10),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := diffProfiles(cpuProfile(tt.base), cpuProfile(tt.current), tt.normalize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := renderDiffView(p, viewOptions{limit: 10, mode: ViewModeFlat}, ProfileTypeCPU)
+			_, got, _ := strings.Cut(out, "\n\n")
+			if got != tt.want {
+				t.Errorf("diff view =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
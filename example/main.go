@@ -14,9 +14,6 @@ import (
 )
 
 func main() {
-	// Enable block profiling
-	runtime.SetBlockProfileRate(1)
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -30,7 +27,8 @@ func main() {
 	go heavyProcess(ctx)
 
 	log.Println("MCP server listening on :1239")
-	err := pprofmcpagent.ServeSSE(ctx, ":1239")
+	// Enable block profiling
+	err := pprofmcpagent.ServeSSE(ctx, ":1239", pprofmcpagent.WithBlockProfileRate(1))
 	if err != nil {
 		log.Printf("Error starting server: %v\n", err)
 		return
@@ -0,0 +1,324 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxProfileFileBytes limits the size of profile files loaded from the profile directory.
+const maxProfileFileBytes = 256 << 20
+
+// profileFileExts are the file extensions listed as profile files.
+var profileFileExts = []string{".pb.gz", ".pb", ".pprof", ".prof"}
+
+// dumpFileExts are the file extensions listed as goroutine dumps, which detect-deadlocks reads.
+var dumpFileExts = []string{".txt"}
+
+// WithProfileDir allows tools to load profile files (.pb.gz, .pprof, ...) from the
+// given directory for offline analysis. Paths passed to the tools are relative to
+// the directory and cannot refer to files outside of it.
+func WithProfileDir(dir string) Option {
+	return func(c *config) {
+		c.profileDir = dir
+	}
+}
+
+// profileFiles gives sandboxed access to the profile files below a root directory.
+type profileFiles struct {
+	root     string
+	redactor *redactor
+}
+
+// resolve returns the absolute path of a file below the root directory.
+// Absolute paths, paths escaping the root and symbolic links pointing
+// outside of the root are rejected.
+func (f *profileFiles) resolve(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	name = filepath.FromSlash(name)
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("path %q must be relative to the profile directory", name)
+	}
+
+	root, err := filepath.EvalSymlinks(f.root)
+	if err != nil {
+		return "", fmt.Errorf("profile directory unavailable: %w", err)
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("profile file %q not found", name)
+		}
+		return "", err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("path %q is outside of the profile directory", name)
+	}
+	return path, nil
+}
+
+// profileFileInfo describes a profile file or goroutine dump in the profile directory.
+type profileFileInfo struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Dump    bool
+}
+
+// List returns the profile files and goroutine dumps below the root directory, sorted by path.
+func (f *profileFiles) List() ([]profileFileInfo, error) {
+	var result []profileFileInfo
+	err := filepath.WalkDir(f.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != f.root {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		dump := hasExt(d.Name(), dumpFileExts)
+		if d.IsDir() || !dump && !isProfileFile(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(f.root, path)
+		if err != nil {
+			return nil
+		}
+		// Skip symbolic links that point outside of the root.
+		resolved, err := f.resolve(rel)
+		if err != nil {
+			return nil
+		}
+		info, err := os.Stat(resolved)
+		if err != nil {
+			return nil
+		}
+		result = append(result, profileFileInfo{
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Dump:    dump,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list profile directory: %w", err)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result, nil
+}
+
+// Load reads, parses and redacts a profile file below the root directory.
+func (f *profileFiles) Load(name string) (*profile.Profile, error) {
+	path, err := f.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	p, err := readProfileFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.redactor.profile(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// isProfileFile reports whether the file name has a profile file extension.
+func isProfileFile(name string) bool {
+	return hasExt(name, profileFileExts)
+}
+
+// hasExt reports whether the file name ends with one of the extensions.
+func hasExt(name string, exts []string) bool {
+	for _, ext := range exts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// readProfileFile reads and parses a gzipped or uncompressed protobuf profile file.
+func readProfileFile(path string) (*profile.Profile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", filepath.Base(path))
+	}
+	if info.Size() > maxProfileFileBytes {
+		return nil, fmt.Errorf("%s is too large (%s, limit %s)",
+			filepath.Base(path), formatValue(info.Size()), formatValue(maxProfileFileBytes))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := profile.ParseData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+	return p, nil
+}
+
+// detectProfileType infers the profile type from the profile's sample types,
+// so values of profile files are labeled like those of collected profiles.
+// name is the profile's file name, which tells block and mutex profiles apart.
+func detectProfileType(name string, p *profile.Profile) string {
+	var types []string
+	for _, st := range p.SampleType {
+		types = append(types, st.Type)
+	}
+	switch strings.Join(types, ",") {
+	case "samples,cpu":
+		return ProfileTypeCPU
+	case "alloc_objects,alloc_space,inuse_objects,inuse_space":
+		// Heap and allocs profiles share their sample types; the default sample type tells them apart.
+		if p.DefaultSampleType == "alloc_space" {
+			return ProfileTypeAllocs
+		}
+		return ProfileTypeHeap
+	case "contentions,delay":
+		// Block and mutex profiles have the same sample and period types.
+		base := strings.ToLower(filepath.Base(name))
+		switch {
+		case strings.Contains(base, ProfileTypeMutex):
+			return ProfileTypeMutex
+		case strings.Contains(base, ProfileTypeBlock):
+			return ProfileTypeBlock
+		case isMutexProfile(p):
+			return ProfileTypeMutex
+		}
+		return ProfileTypeBlock
+	case "goroutine":
+		return ProfileTypeGoroutine
+	case "threadcreate":
+		return ProfileTypeThreadCreate
+	}
+	return "file"
+}
+
+// mutexUnlockFunctions are the leaf functions of mutex profile samples: mutex
+// profiles record the stacks that release contended locks, while block profiles
+// record the stacks that wait for them.
+var mutexUnlockFunctions = []string{
+	"sync.(*Mutex).Unlock",
+	"sync.(*Mutex).unlockSlow",
+	"sync.(*RWMutex).Unlock",
+	"sync.(*RWMutex).RUnlock",
+	"sync.(*RWMutex).rUnlockSlow",
+	"internal/sync.(*Mutex).Unlock",
+	"internal/sync.(*Mutex).unlockSlow",
+	"runtime.unlock",
+	"runtime.unlock2",
+	"runtime._LostContendedRuntimeLock",
+}
+
+// isMutexProfile reports whether all samples of a contention profile end in a
+// function that releases a lock.
+func isMutexProfile(p *profile.Profile) bool {
+	found := false
+	for _, s := range p.Sample {
+		if len(s.Location) == 0 || len(s.Location[0].Line) == 0 || s.Location[0].Line[0].Function == nil {
+			continue
+		}
+		if !slices.Contains(mutexUnlockFunctions, s.Location[0].Line[0].Function.Name) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// RenderProfileFile parses a profile file, redacts it with the given rules and renders
+// it with the given view, like the profile tools do. It is used for offline analysis
+// outside of an MCP server.
+func RenderProfileFile(path string, limit int, viewMode ViewMode, rules ...RedactionRule) (string, error) {
+	p, err := readProfileFile(path)
+	if err != nil {
+		return "", err
+	}
+	if err := newRedactor(rules).profile(p); err != nil {
+		return "", err
+	}
+	return getTopSamples(p, limit, viewMode, detectProfileType(path, p)), nil
+}
+
+// ListProfileFilesHandler lists the profile files and goroutine dumps available for offline analysis.
+func ListProfileFilesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+	if a.files == nil {
+		return handleMCPError(fmt.Errorf("no profile directory is configured")), nil
+	}
+	files, err := a.files.List()
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Profile files (%d)\n\n", len(files)))
+	for _, file := range files {
+		result.WriteString(fmt.Sprintf("%s  %s  %s",
+			file.Path, file.ModTime.Format(time.RFC3339), formatValue(file.Size)))
+		if file.Dump {
+			result.WriteString("  goroutine dump for detect-deadlocks")
+		}
+		result.WriteString("\n")
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(result.String()),
+		},
+	}, nil
+}
+
+// OpenProfileFileHandler loads a profile file from the profile directory, stores it
+// as a snapshot and renders it with the usual views. The snapshot ID can be used
+// with get-snapshot and diff-profiles like any collected profile.
+func OpenProfileFileHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+	if a.files == nil {
+		return handleMCPError(fmt.Errorf("no profile directory is configured")), nil
+	}
+	name, _ := request.Params.Arguments["path"].(string)
+	p, err := a.files.Load(name)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+
+	profileType := detectProfileType(name, p)
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		return handleMCPError(&ProfileError{
+			ProfileType: profileType,
+			Err:         fmt.Errorf("failed to write profile: %w", err),
+		}), nil
+	}
+
+	result, err := renderSnapshot(ctx, profileType, buf.Bytes(), request)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+	header := mcp.NewTextContent(fmt.Sprintf("File: %s (%s profile)", name, profileType))
+	result.Content = append([]mcp.Content{header}, result.Content...)
+	return result, nil
+}
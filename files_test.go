@@ -0,0 +1,116 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+func TestDetectProfileType(t *testing.T) {
+	contentionTypes := []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}}
+	contention := func(leaf string) *profile.Profile {
+		p := flatProfile(contentionTypes, map[string][]int64{leaf: {3, 1000}})
+		p.DefaultSampleType = ""
+		return p
+	}
+	allocs := heapProfile(map[string]int64{"main.f": 1})
+	allocs.DefaultSampleType = "alloc_space"
+
+	tests := []struct {
+		name string
+		file string
+		p    *profile.Profile
+		want string
+	}{
+		{"cpu", "profile.pb.gz", cpuProfile(map[string]int64{"main.f": 1}), ProfileTypeCPU},
+		{"heap", "x.pb.gz", heapProfile(map[string]int64{"main.f": 1}), ProfileTypeHeap},
+		{"allocs", "x.pb.gz", allocs, ProfileTypeAllocs},
+		{"goroutine", "x.pb.gz", flatProfile([]*profile.ValueType{{Type: "goroutine", Unit: "count"}}, map[string][]int64{"main.f": {1}}), ProfileTypeGoroutine},
+		{"mutex by file name", "prod/Mutex-2024.pb.gz", contention("sync.(*Mutex).Lock"), ProfileTypeMutex},
+		{"block by file name", "block.pb.gz", contention("sync.(*Mutex).Unlock"), ProfileTypeBlock},
+		{"mutex by stacks", "contention.pb.gz", contention("sync.(*RWMutex).Unlock"), ProfileTypeMutex},
+		{"block by stacks", "contention.pb.gz", contention("runtime.chanrecv1"), ProfileTypeBlock},
+		{"unknown", "x.pb.gz", flatProfile([]*profile.ValueType{{Type: "widgets", Unit: "count"}}, map[string][]int64{"main.f": {1}}), "file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectProfileType(tt.file, tt.p); got != tt.want {
+				t.Errorf("detectProfileType(%q) = %q, want %q", tt.file, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectRuntimeContentionProfiles(t *testing.T) {
+	runtime.SetBlockProfileRate(1)
+	prevFraction := runtime.SetMutexProfileFraction(1)
+	defer runtime.SetBlockProfileRate(0)
+	defer runtime.SetMutexProfileFraction(prevFraction)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				mu.Lock()
+				time.Sleep(10 * time.Microsecond)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, name := range []string{ProfileTypeBlock, ProfileTypeMutex} {
+		var buf bytes.Buffer
+		if err := pprof.Lookup(name).WriteTo(&buf, 0); err != nil {
+			t.Fatal(err)
+		}
+		p, err := profile.Parse(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Sample) == 0 {
+			t.Fatalf("%s profile has no samples", name)
+		}
+		if got := detectProfileType("contention.pb.gz", p); got != name {
+			t.Errorf("%s profile detected as %q", name, got)
+		}
+	}
+}
+
+func TestListProfileFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"cpu.pb.gz", "stuck/goroutines.txt", "notes.md", ".hidden/heap.pb.gz"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := (&profileFiles{root: dir}).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, file := range files {
+		got = append(got, fmt.Sprintf("%s dump=%t", file.Path, file.Dump))
+	}
+	want := []string{"cpu.pb.gz dump=false", "stuck/goroutines.txt dump=true"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
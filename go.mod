@@ -1,15 +1,16 @@
 module github.com/yudppp/pprof-mcp-agent
 
-go 1.23.5
+go 1.24.0
 
 require (
 	github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/pmezard/go-difflib v1.0.1-0.20181226105442-5d4384ee4fb2 // indirect
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
 )
 
 require (
 	github.com/google/pprof v0.0.0-20240320155624-b11c3daa6f07
+	github.com/google/uuid v1.6.0
 	github.com/mark3labs/mcp-go v0.20.1
+	golang.org/x/exp v0.0.0-20260209203927-2842357ff358
 )
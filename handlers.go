@@ -3,12 +3,13 @@ package pprofmcpagent
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"runtime/pprof"
+	"strings"
 	"time"
 
-	"github.com/google/pprof/profile"
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
@@ -23,6 +24,7 @@ const (
 	ProfileTypeBlock        = "block"
 	ProfileTypeAllocs       = "allocs"
 	ProfileTypeCPU          = "cpu"
+	ProfileTypeMutex        = "mutex"
 )
 
 // Profile error definitions
@@ -37,7 +39,92 @@ func (e *ProfileError) Error() string {
 
 // handleProfile is a common function that processes various types of runtime profiles.
 // It handles profile data collection, parsing, and formatting the results.
-func handleProfile(profileName string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+// The collected profile is kept in the snapshot store and its ID is included in the result.
+// When several targets are selected and breakdown is set, each target's profile is rendered separately.
+func handleProfile(ctx context.Context, profileName string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+	if err := a.checkCapture(ctx, profileName); err != nil {
+		return nil, err
+	}
+	targets, err := a.requestTargets(request)
+	if err != nil {
+		return nil, &ProfileError{ProfileType: profileName, Err: err}
+	}
+	if len(targets) == 0 {
+		data, err := a.source.Profile(ctx, request, profileName, cpuProfileDuration(request))
+		if err != nil {
+			return nil, err
+		}
+		return renderSnapshot(ctx, profileName, data, request)
+	}
+
+	fetched, data, failures, err := a.fetchTargets(ctx, request, targets, profileName, cpuProfileDuration(request))
+	if err != nil {
+		return nil, err
+	}
+	var result *mcp.CallToolResult
+	if breakdown, _ := request.Params.Arguments["breakdown"].(bool); breakdown && len(targets) > 1 {
+		if result, err = renderTargetBreakdown(ctx, profileName, fetched, data, request); err != nil {
+			return nil, err
+		}
+	} else {
+		merged := data[0]
+		if len(data) > 1 {
+			if merged, err = mergeTargetProfiles(profileName, fetched, data); err != nil {
+				return nil, err
+			}
+		}
+		if result, err = renderSnapshot(ctx, profileName, merged, request); err != nil {
+			return nil, err
+		}
+		if len(targets) > 1 {
+			header := fmt.Sprintf("Merged profile of %d targets: %s", len(fetched), targetNames(fetched))
+			if len(failures) > 0 {
+				header = fmt.Sprintf("Merged profile of %d of %d targets: %s", len(fetched), len(targets), targetNames(fetched))
+			}
+			result.Content = append([]mcp.Content{mcp.NewTextContent(header)}, result.Content...)
+		}
+	}
+	if len(failures) > 0 {
+		result.Content = append([]mcp.Content{targetFailures(failures)}, result.Content...)
+	}
+	return result, nil
+}
+
+// collectProfile captures the named profile as gzipped protobuf data from the
+// agent's profile source (this process or a remote target), or from the targets
+// selected by the target and targets request parameters, merging their profiles.
+// CPU profiles are sampled over the duration request parameter.
+// Unlike the profile tools, it fails if any target fails: the profile is compared
+// against others, and a merge of fewer targets would look like a change.
+func collectProfile(ctx context.Context, profileName string, request mcp.CallToolRequest) ([]byte, error) {
+	a := agentFromContext(ctx)
+	if err := a.checkCapture(ctx, profileName); err != nil {
+		return nil, err
+	}
+	targets, err := a.requestTargets(request)
+	if err != nil {
+		return nil, &ProfileError{ProfileType: profileName, Err: err}
+	}
+	d := cpuProfileDuration(request)
+	if len(targets) == 0 {
+		return a.source.Profile(ctx, request, profileName, d)
+	}
+	fetched, data, failures, err := a.fetchTargets(ctx, request, targets, profileName, d)
+	if err != nil {
+		return nil, err
+	}
+	if len(failures) > 0 {
+		return nil, &ProfileError{ProfileType: profileName, Err: errors.New(strings.Join(failures, "; "))}
+	}
+	if len(data) == 1 {
+		return data[0], nil
+	}
+	return mergeTargetProfiles(profileName, fetched, data)
+}
+
+// lookupProfile writes the named runtime/pprof profile as gzipped protobuf data.
+func lookupProfile(profileName string) ([]byte, error) {
 	prof := pprof.Lookup(profileName)
 	if prof == nil {
 		return nil, &ProfileError{
@@ -46,18 +133,6 @@ func handleProfile(profileName string, request mcp.CallToolRequest) (*mcp.CallTo
 		}
 	}
 
-	// Get limit from request parameters
-	limit := 100
-	if limitParam, ok := request.Params.Arguments["limit"].(float64); ok {
-		limit = int(limitParam)
-	}
-
-	// Get view mode from request parameters
-	viewMode := ViewModeFlat
-	if viewParam, ok := request.Params.Arguments["view"].(string); ok {
-		viewMode = ViewMode(viewParam)
-	}
-
 	// Write profile data to buffer
 	var buf bytes.Buffer
 	if err := prof.WriteTo(&buf, 0); err != nil {
@@ -66,9 +141,46 @@ func handleProfile(profileName string, request mcp.CallToolRequest) (*mcp.CallTo
 			Err:         fmt.Errorf("failed to write profile: %w", err),
 		}
 	}
+	return buf.Bytes(), nil
+}
+
+// cpuProfileDuration returns the duration request parameter (default: 10 seconds).
+func cpuProfileDuration(request mcp.CallToolRequest) time.Duration {
+	duration, ok := request.Params.Arguments["duration"].(float64)
+	if !ok {
+		duration = 10
+	}
+	return time.Duration(duration * float64(time.Second))
+}
+
+// captureCPUProfile samples CPU usage for the given duration,
+// sending progress notifications for the request while the profile is being captured.
+func captureCPUProfile(ctx context.Context, request mcp.CallToolRequest, d time.Duration) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		return nil, &ProfileError{
+			ProfileType: ProfileTypeCPU,
+			Err:         err,
+		}
+	}
+	err := waitWithProgress(ctx, request, d)
+	pprof.StopCPUProfile()
+	if err != nil {
+		return nil, &ProfileError{
+			ProfileType: ProfileTypeCPU,
+			Err:         err,
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// renderSnapshot stores gzipped protobuf profile data as a snapshot, parses it
+// and renders it according to the limit and view request parameters.
+func renderSnapshot(ctx context.Context, profileName string, data []byte, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	snap := agentFromContext(ctx).snapshots.Add(profileName, data)
 
 	// Parse the profile
-	p, err := profile.Parse(&buf)
+	p, err := snap.Profile()
 	if err != nil {
 		return nil, &ProfileError{
 			ProfileType: profileName,
@@ -76,35 +188,74 @@ func handleProfile(profileName string, request mcp.CallToolRequest) (*mcp.CallTo
 		}
 	}
 
-	result := getTopSamples(p, limit, viewMode, profileName)
+	result := renderView(p, viewParams(request), profileName)
 
 	return &mcp.CallToolResult{
 		Content: []mcp.Content{
-			mcp.NewTextContent(result),
+			mcp.NewTextContent(fmt.Sprintf("Snapshot ID: %s\n\n%s", snap.ID, result)),
 		},
 	}, nil
 }
 
+// viewParams extracts the limit, view mode, name trimming, frame skipping and output budget parameters shared by all profile tools.
+// max_tokens is converted to bytes; when both max_tokens and max_bytes are given, the smaller budget applies.
+// Budgets below minBudgetBytes are raised to it.
+func viewParams(request mcp.CallToolRequest) viewOptions {
+	// Get limit from request parameters
+	limit := 100
+	if limitParam, ok := request.Params.Arguments["limit"].(float64); ok {
+		limit = int(limitParam)
+	}
+
+	// Get view mode from request parameters
+	viewMode := ViewModeFlat
+	if viewParam, ok := request.Params.Arguments["view"].(string); ok {
+		viewMode = ViewMode(viewParam)
+	}
+
+	opts := viewOptions{limit: limit, mode: viewMode}
+	opts.trimNames, _ = request.Params.Arguments["trim_names"].(bool)
+	opts.byModule, _ = request.Params.Arguments["by_module"].(bool)
+	if skip, _ := request.Params.Arguments["skip_runtime"].(bool); skip {
+		opts.skipPackages = stringsParam(request, "skip_packages")
+		if len(opts.skipPackages) == 0 {
+			opts.skipPackages = defaultSkipPackages
+		}
+	}
+	if maxBytes, ok := request.Params.Arguments["max_bytes"].(float64); ok && maxBytes > 0 {
+		opts.maxBytes = int(maxBytes)
+	}
+	if maxTokens, ok := request.Params.Arguments["max_tokens"].(float64); ok && maxTokens > 0 {
+		if b := int(maxTokens) * bytesPerToken; opts.maxBytes == 0 || b < opts.maxBytes {
+			opts.maxBytes = b
+		}
+	}
+	if opts.maxBytes > 0 {
+		opts.maxBytes = max(opts.maxBytes, minBudgetBytes)
+	}
+	return opts
+}
+
 // HeapHandler processes heap profile requests.
 // It provides aggregated memory allocation statistics from the heap,
 // showing memory usage by location in the code.
 // The results include both in-use and allocated memory statistics.
 func HeapHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	return handleProfile(ProfileTypeHeap, request)
+	return handleProfile(ctx, ProfileTypeHeap, request)
 }
 
 // GoroutineHandler processes goroutine profile requests.
 // It provides aggregated statistics about currently running goroutines,
 // including their current state (running, waiting, blocked) and stack traces.
 func GoroutineHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	return handleProfile(ProfileTypeGoroutine, request)
+	return handleProfile(ctx, ProfileTypeGoroutine, request)
 }
 
 // ThreadCreateHandler processes thread creation profile requests.
 // It provides aggregated statistics about OS thread creation,
 // showing locations where new OS threads are created and their frequency.
 func ThreadCreateHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	return handleProfile(ProfileTypeThreadCreate, request)
+	return handleProfile(ctx, ProfileTypeThreadCreate, request)
 }
 
 // BlockHandler processes block profile requests.
@@ -112,7 +263,7 @@ func ThreadCreateHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp
 // showing locations where goroutines block on synchronization primitives
 // (mutexes, channels, etc.) and the duration of blocking.
 func BlockHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	return handleProfile(ProfileTypeBlock, request)
+	return handleProfile(ctx, ProfileTypeBlock, request)
 }
 
 // AllocsHandler processes allocation profile requests.
@@ -120,42 +271,159 @@ func BlockHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallTo
 // showing locations where memory allocations occur and their frequency.
 // This includes both allocated and freed memory.
 func AllocsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	return handleProfile(ProfileTypeAllocs, request)
+	return handleProfile(ctx, ProfileTypeAllocs, request)
 }
 
 // CPUHandler processes CPU profile requests.
 // It collects and provides aggregated CPU usage statistics over a specified duration,
 // showing where the program spends its CPU time.
 // The duration can be configured through the request parameters (default: 10 seconds).
+// Progress notifications are sent while the profile is being captured
+// when the client supplies a progress token.
 func CPUHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	duration, ok := request.Params.Arguments["duration"].(float64)
-	if !ok {
-		duration = 10
+	result, err := handleProfile(ctx, ProfileTypeCPU, request)
+	if err != nil {
+		return handleMCPError(err), nil
 	}
+	return result, nil
+}
 
-	// Get limit from request parameters
-	limit := 100
-	if limitParam, ok := request.Params.Arguments["limit"].(float64); ok {
-		limit = int(limitParam)
+// ListSnapshotsHandler lists the profile snapshots kept in the snapshot store,
+// newest first, optionally filtered by profile type.
+func ListSnapshotsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	profileType, _ := request.Params.Arguments["type"].(string)
+	snapshots := agentFromContext(ctx).snapshots.List(profileType)
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Snapshots (%d)\n\n", len(snapshots)))
+	for _, snap := range snapshots {
+		result.WriteString(fmt.Sprintf("%s: type=%s, created=%s, size=%s\n",
+			snap.ID, snap.ProfileType, snap.CreatedAt.Format(time.RFC3339), formatValue(int64(snap.Size))))
 	}
 
-	var buf bytes.Buffer
-	if err := pprof.StartCPUProfile(&buf); err != nil {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(result.String()),
+		},
+	}, nil
+}
+
+// GetSnapshotHandler renders a previously captured snapshot with the requested view.
+func GetSnapshotHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, _ := request.Params.Arguments["id"].(string)
+	snap, err := agentFromContext(ctx).lookupSnapshot(id)
+	if err != nil {
 		return handleMCPError(err), nil
 	}
-	time.Sleep(time.Duration(duration) * time.Second)
-	pprof.StopCPUProfile()
 
-	// Parse the profile
-	p, err := profile.Parse(&buf)
+	p, err := snap.Profile()
+	if err != nil {
+		return handleMCPError(&ProfileError{
+			ProfileType: snap.ProfileType,
+			Err:         fmt.Errorf("failed to parse profile: %w", err),
+		}), nil
+	}
+
+	result := renderView(p, viewParams(request), snap.ProfileType)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(fmt.Sprintf("Snapshot ID: %s (captured %s)\n\n%s",
+				snap.ID, snap.CreatedAt.Format(time.RFC3339), result)),
+		},
+	}, nil
+}
+
+// NamedProfileHandler processes requests for any profile registered with runtime/pprof,
+// including custom profiles created with pprof.NewProfile. The profile is selected
+// by the name request parameter and rendered with the usual views.
+func NamedProfileHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, _ := request.Params.Arguments["name"].(string)
+	if name == "" {
+		return handleMCPError(fmt.Errorf("name is required")), nil
+	}
+	if name == ProfileTypeCPU {
+		return CPUHandler(ctx, request)
+	}
+	result, err := handleProfile(ctx, name, request)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+	return result, nil
+}
+
+// ListProfilesHandler lists the profiles registered with runtime/pprof and their
+// current sample counts, so the agent can discover custom profiles.
+func ListProfilesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	source, err := agentFromContext(ctx).sourceFor(request)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+	profiles, err := source.Profiles(ctx)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Registered profiles (%d)\n\n", len(profiles)))
+	for _, prof := range profiles {
+		result.WriteString(fmt.Sprintf("%s: %d\n", prof.Name, prof.Count))
+	}
+	result.WriteString(fmt.Sprintf("%s: sampled on demand\n", ProfileTypeCPU))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(result.String()),
+		},
+	}, nil
+}
+
+// DiffProfilesHandler compares two profiles of the same type, like `pprof -diff_base`.
+// The base must be a stored snapshot; the current profile is either another snapshot
+// or "now", in which case a fresh profile of the base's type is collected and stored.
+// Values in the result are current minus base, so positive values are regressions
+// and negative values are improvements.
+func DiffProfilesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+
+	baseID, _ := request.Params.Arguments["base"].(string)
+	base, err := a.lookupSnapshot(baseID)
 	if err != nil {
 		return handleMCPError(err), nil
 	}
-	result := getTopSamples(p, limit, ViewModeFlat, ProfileTypeCPU)
+
+	currentID, _ := request.Params.Arguments["current"].(string)
+	var current *Snapshot
+	if currentID == "" || currentID == "now" {
+		data, err := collectProfile(ctx, base.ProfileType, request)
+		if err != nil {
+			return handleMCPError(err), nil
+		}
+		current = a.snapshots.Add(base.ProfileType, data)
+	} else if current, err = a.lookupSnapshot(currentID); err != nil {
+		return handleMCPError(err), nil
+	}
+
+	if base.ProfileType != current.ProfileType {
+		return handleMCPError(fmt.Errorf("cannot diff %s snapshot %s against %s snapshot %s",
+			current.ProfileType, current.ID, base.ProfileType, base.ID)), nil
+	}
+
+	normalize, _ := request.Params.Arguments["normalize"].(bool)
+	p, err := diffSnapshots(base, current, normalize)
+	if err != nil {
+		return handleMCPError(&ProfileError{
+			ProfileType: base.ProfileType,
+			Err:         err,
+		}), nil
+	}
+
+	result := renderDiffView(p, viewParams(request), base.ProfileType)
 
 	return &mcp.CallToolResult{
 		Content: []mcp.Content{
-			mcp.NewTextContent(result),
+			mcp.NewTextContent(fmt.Sprintf("Diff of %s (current) against %s (base)\n\n%s",
+				current.ID, base.ID, result)),
 		},
 	}, nil
 }
@@ -0,0 +1,83 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestNamedProfileHandler(t *testing.T) {
+	// Profiles cannot be unregistered, so repeated runs reuse the profile.
+	conns := pprof.Lookup("example.com/test/open-conns")
+	if conns == nil {
+		conns = pprof.NewProfile("example.com/test/open-conns")
+	}
+	var conn1, conn2 int
+	conns.Add(&conn1, 0)
+	conns.Add(&conn2, 0)
+	defer conns.Remove(&conn1)
+	defer conns.Remove(&conn2)
+
+	a := newAgent(newConfig())
+	ctx := context.WithValue(context.Background(), agentKey{}, a)
+
+	tests := []struct {
+		name      string
+		handler   func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)
+		arguments map[string]interface{}
+		contains  []string
+		wantErr   string
+	}{
+		{
+			name:      "custom profile",
+			handler:   NamedProfileHandler,
+			arguments: map[string]interface{}{"name": "example.com/test/open-conns"},
+			contains:  []string{"Snapshot ID: example.com%2Ftest%2Fopen-conns-", "runtime/pprof.(*Profile).Add"},
+		},
+		{
+			name:      "missing name",
+			handler:   NamedProfileHandler,
+			arguments: map[string]interface{}{},
+			wantErr:   "name is required",
+		},
+		{
+			name:      "unknown profile",
+			handler:   NamedProfileHandler,
+			arguments: map[string]interface{}{"name": "no-such-profile"},
+			wantErr:   "no-such-profile",
+		},
+		{
+			name:     "list",
+			handler:  ListProfilesHandler,
+			contains: []string{"example.com/test/open-conns: 2\n", "heap: ", "cpu: sampled on demand\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request mcp.CallToolRequest
+			request.Params.Arguments = tt.arguments
+			result, err := tt.handler(ctx, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := resultText(result)
+			if tt.wantErr != "" {
+				if !result.IsError || !strings.Contains(out, tt.wantErr) {
+					t.Fatalf("result = %q, want error %q", out, tt.wantErr)
+				}
+				return
+			}
+			if result.IsError {
+				t.Fatalf("unexpected error: %s", out)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(out, s) {
+					t.Errorf("result does not contain %q:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,427 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// severity of an analysis finding.
+type severity string
+
+const (
+	severityHigh   severity = "high"
+	severityMedium severity = "medium"
+	severityLow    severity = "low"
+)
+
+// maxFindingCallSites is the number of call sites shown as evidence for a finding.
+const maxFindingCallSites = 3
+
+// detector is a rule that flags a known performance anti-pattern when the
+// functions it matches account for a large enough share of a profile.
+type detector struct {
+	id    string
+	title string
+	// profileTypes are the profile types the detector applies to.
+	profileTypes []string
+	// functions are function name prefixes; a sample matches if any frame matches.
+	functions []string
+	// excludes are the ids of detectors that claim matched frames they call into,
+	// so the same cost is not reported twice.
+	excludes []string
+	// low, medium and high are the minimum shares (0-1) of the profile total per severity.
+	low, medium, high float64
+	suggestion        string
+}
+
+// detectors are the rules run by the analyze tool.
+var detectors = []detector{
+	{
+		id:           "fmt-churn",
+		title:        "Heavy fmt/strconv formatting",
+		profileTypes: []string{ProfileTypeCPU, ProfileTypeAllocs},
+		functions:    []string{"fmt.Sprintf", "fmt.Sprint", "fmt.Fprintf", "fmt.Errorf", "fmt.(*pp)", "strconv."},
+		low:          0.05, medium: 0.10, high: 0.20,
+		suggestion: "Avoid fmt.Sprintf in hot paths: use strconv.AppendInt/AppendFloat into a reused []byte, " +
+			"strings.Builder with Grow, or precomputed strings. Build log and error messages lazily.",
+	},
+	{
+		id:           "regexp-compile",
+		title:        "Regular expressions compiled in a hot path",
+		profileTypes: []string{ProfileTypeCPU, ProfileTypeAllocs},
+		functions:    []string{"regexp.Compile", "regexp.MustCompile", "regexp.MatchString", "regexp.compile", "regexp/syntax.Parse", "regexp/syntax.Compile"},
+		low:          0.01, medium: 0.03, high: 0.10,
+		suggestion: "Compile regular expressions once, e.g. in a package-level var with regexp.MustCompile, " +
+			"and reuse the *regexp.Regexp; regexp.MatchString compiles its pattern on every call. " +
+			"Consider strings.Contains/HasPrefix for simple patterns.",
+	},
+	{
+		id:           "json-reflection",
+		title:        "Reflection-heavy encoding/json",
+		profileTypes: []string{ProfileTypeCPU, ProfileTypeAllocs},
+		functions:    []string{"encoding/json"},
+		low:          0.10, medium: 0.20, high: 0.35,
+		suggestion: "encoding/json walks values with reflection. Reuse encoders and buffers, decode into concrete " +
+			"structs instead of map[string]interface{}, avoid json.RawMessage round trips, or switch hot types " +
+			"to a code-generated or faster JSON library.",
+	},
+	{
+		id:           "map-growth",
+		title:        "Map growth and rehashing",
+		profileTypes: []string{ProfileTypeCPU, ProfileTypeAllocs, ProfileTypeHeap},
+		functions:    []string{"runtime.hashGrow", "runtime.growWork", "runtime.evacuate", "internal/runtime/maps.(*table).grow", "internal/runtime/maps.(*Map).growToTable", "internal/runtime/maps.(*table).rehash"},
+		low:          0.03, medium: 0.08, high: 0.15,
+		suggestion: "Preallocate maps with make(map[K]V, n) when the size is known or can be estimated, " +
+			"and reuse maps with clear() instead of recreating them.",
+	},
+	{
+		id:           "slice-growth",
+		title:        "Slice growth by append",
+		profileTypes: []string{ProfileTypeCPU, ProfileTypeAllocs},
+		functions:    []string{"runtime.growslice"},
+		low:          0.05, medium: 0.10, high: 0.20,
+		suggestion: "Preallocate slices with make([]T, 0, n) when the final length is known, " +
+			"and reuse slices across iterations with s = s[:0].",
+	},
+	{
+		id:           "string-conversion",
+		title:        "[]byte/string conversions and concatenation",
+		profileTypes: []string{ProfileTypeCPU, ProfileTypeAllocs},
+		functions:    []string{"runtime.slicebytetostring", "runtime.stringtoslicebyte", "runtime.concatstrings", "runtime.concatstring2", "runtime.concatstring3", "runtime.concatstring4", "runtime.concatstring5", "runtime.rawstring", "runtime.rawbyteslice"},
+		low:          0.03, medium: 0.08, high: 0.15,
+		suggestion: "Keep data in one representation: use bytes functions on []byte and strings functions on strings, " +
+			"write into a bytes.Buffer or strings.Builder instead of concatenating with +, " +
+			"and look up map[string] keys with m[string(b)], which does not allocate.",
+	},
+	{
+		id:           "defer-in-loop",
+		title:        "Heap-allocated defers (defer in a loop)",
+		profileTypes: []string{ProfileTypeCPU, ProfileTypeAllocs},
+		functions:    []string{"runtime.deferproc", "runtime.newdefer", "runtime.deferreturn"},
+		low:          0.01, medium: 0.03, high: 0.08,
+		suggestion: "Defers inside loops cannot be open-coded and are pushed onto the defer chain at runtime. " +
+			"Move the loop body into a function with its own defer, or release resources explicitly.",
+	},
+	{
+		id:           "gc-pressure",
+		title:        "Garbage collection and allocation overhead",
+		profileTypes: []string{ProfileTypeCPU},
+		functions:    []string{"runtime.mallocgc", "runtime.gcBgMarkWorker", "runtime.gcAssistAlloc", "runtime.scanobject"},
+		low:          0.10, medium: 0.20, high: 0.35,
+		suggestion: "Reduce allocations on hot paths (check allocs-profile), reuse objects with sync.Pool, " +
+			"and consider raising GOGC or setting GOMEMLIMIT if memory allows.",
+	},
+	{
+		id:           "reflection",
+		title:        "Heavy use of reflection",
+		profileTypes: []string{ProfileTypeCPU, ProfileTypeAllocs},
+		functions:    []string{"reflect."},
+		excludes:     []string{"json-reflection"},
+		low:          0.08, medium: 0.15, high: 0.30,
+		suggestion: "Replace reflection on hot paths with type switches, generics or generated code, " +
+			"and cache reflect.Type lookups and struct field metadata.",
+	},
+}
+
+// finding is a performance issue detected in a profile.
+type finding struct {
+	Detector   string
+	Title      string
+	Severity   severity
+	Value      int64
+	Share      float64
+	CallSites  []callSite
+	Suggestion string
+}
+
+// callSite is a frame outside of the matched functions that leads into them.
+type callSite struct {
+	Location string
+	Value    int64
+}
+
+// analysisValueIndex returns the index of the sample value analyzed for the profile type:
+// CPU time, allocated or in-use bytes, or the profile's default sample type.
+func analysisValueIndex(p *profile.Profile, profileType string) int {
+	want := ""
+	switch profileType {
+	case ProfileTypeCPU:
+		want = "cpu"
+	case ProfileTypeAllocs:
+		want = "alloc_space"
+	case ProfileTypeHeap:
+		want = "inuse_space"
+	default:
+		want = p.DefaultSampleType
+	}
+	for i, st := range p.SampleType {
+		if st.Type == want {
+			return i
+		}
+	}
+	return len(p.SampleType) - 1
+}
+
+// analyzeProfile runs all detectors applicable to the profile type and returns
+// the findings, most severe and largest first.
+func analyzeProfile(p *profile.Profile, profileType string) []finding {
+	if len(p.SampleType) == 0 {
+		return nil
+	}
+	idx := analysisValueIndex(p, profileType)
+	var total int64
+	for _, s := range p.Sample {
+		total += s.Value[idx]
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	var findings []finding
+	for _, d := range detectors {
+		if !slices.Contains(d.profileTypes, profileType) {
+			continue
+		}
+		if f, ok := d.run(p, idx, total); ok {
+			findings = append(findings, f)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity != findings[j].Severity {
+			return severityRank(findings[i].Severity) > severityRank(findings[j].Severity)
+		}
+		return findings[i].Share > findings[j].Share
+	})
+	return findings
+}
+
+// run sums the values of the samples whose stack contains a matched function and
+// attributes them to the first frame that calls into the matched functions.
+func (d detector) run(p *profile.Profile, idx int, total int64) (finding, bool) {
+	var value int64
+	sites := make(map[string]int64)
+	for _, s := range p.Sample {
+		site, ok := d.callSite(s.Location)
+		if !ok {
+			continue
+		}
+		value += s.Value[idx]
+		sites[site] += s.Value[idx]
+	}
+
+	share := float64(value) / float64(total)
+	var sev severity
+	switch {
+	case share >= d.high:
+		sev = severityHigh
+	case share >= d.medium:
+		sev = severityMedium
+	case share >= d.low:
+		sev = severityLow
+	default:
+		return finding{}, false
+	}
+
+	var callSites []callSite
+	for loc, v := range sites {
+		callSites = append(callSites, callSite{Location: loc, Value: v})
+	}
+	sort.Slice(callSites, func(i, j int) bool {
+		if callSites[i].Value != callSites[j].Value {
+			return callSites[i].Value > callSites[j].Value
+		}
+		return callSites[i].Location < callSites[j].Location
+	})
+	if len(callSites) > maxFindingCallSites {
+		callSites = callSites[:maxFindingCallSites]
+	}
+
+	return finding{
+		Detector:   d.id,
+		Title:      d.title,
+		Severity:   sev,
+		Value:      value,
+		Share:      share,
+		CallSites:  callSites,
+		Suggestion: d.suggestion,
+	}, true
+}
+
+// callSite reports whether the stack contains a matched function and returns the
+// frame that calls into the matched functions: the first frame above the outermost
+// matched frame that belongs to application code, or else the first one outside
+// of the runtime. Inlined frames are taken into account.
+func (d detector) callSite(locs []*profile.Location) (string, bool) {
+	// Stacks and inlined lines are both ordered from leaf to root.
+	var lines []profile.Line
+	for _, loc := range locs {
+		for _, line := range loc.Line {
+			if line.Function != nil {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	// Frames called by the functions of excluding detectors belong to those detectors.
+	claimed := -1
+	for _, id := range d.excludes {
+		other, ok := detectorByID(id)
+		if !ok {
+			continue
+		}
+		for i, line := range lines {
+			if i > claimed && other.matches(line.Function.Name) {
+				claimed = i
+			}
+		}
+	}
+
+	outermost := -1
+	for i, line := range lines {
+		if i > claimed && d.matches(line.Function.Name) {
+			outermost = i
+		}
+	}
+	if outermost < 0 {
+		return "", false
+	}
+
+	var fallback *profile.Line
+	for i := outermost + 1; i < len(lines); i++ {
+		name := lines[i].Function.Name
+		if d.matches(name) || strings.HasPrefix(name, "runtime.") {
+			continue
+		}
+		if moduleOf(packageOf(name)) != "std" {
+			return formatCallSite(lines[i]), true
+		}
+		if fallback == nil {
+			fallback = &lines[i]
+		}
+	}
+	if fallback != nil {
+		return formatCallSite(*fallback), true
+	}
+	return "(unknown caller)", true
+}
+
+func formatCallSite(line profile.Line) string {
+	return fmt.Sprintf("%s (%s:%d)", line.Function.Name, line.Function.Filename, line.Line)
+}
+
+// detectorByID returns the detector with the given id.
+func detectorByID(id string) (detector, bool) {
+	for _, d := range detectors {
+		if d.id == id {
+			return d, true
+		}
+	}
+	return detector{}, false
+}
+
+// matches reports whether the function name matches one of the detector's prefixes.
+func (d detector) matches(name string) bool {
+	for _, prefix := range d.functions {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func severityRank(s severity) int {
+	switch s {
+	case severityHigh:
+		return 3
+	case severityMedium:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// formatAnalysisValue formats a sample value according to its unit.
+func formatAnalysisValue(v int64, st *profile.ValueType) string {
+	switch st.Unit {
+	case "nanoseconds":
+		return time.Duration(v).String()
+	case "bytes":
+		return formatValue(v)
+	default:
+		return fmt.Sprintf("%d %s", v, st.Unit)
+	}
+}
+
+// formatFindings renders the findings of one profile.
+func formatFindings(snap *Snapshot, p *profile.Profile, findings []finding) string {
+	var b strings.Builder
+	st := p.SampleType[analysisValueIndex(p, snap.ProfileType)]
+	fmt.Fprintf(&b, "Analysis of %s (%s profile, %s)\n\n", snap.ID, snap.ProfileType, st.Type)
+	if len(findings) == 0 {
+		b.WriteString("No known anti-patterns above their thresholds.\n")
+		return b.String()
+	}
+	for _, f := range findings {
+		fmt.Fprintf(&b, "[%s] %s (%s)\n", strings.ToUpper(string(f.Severity)), f.Title, f.Detector)
+		fmt.Fprintf(&b, "  Evidence: %.1f%% of %s (%s)\n", f.Share*100, st.Type, formatAnalysisValue(f.Value, st))
+		if len(f.CallSites) > 0 {
+			b.WriteString("  Hot call sites:\n")
+			for _, site := range f.CallSites {
+				fmt.Fprintf(&b, "    %s: %s\n", site.Location, formatAnalysisValue(site.Value, st))
+			}
+		}
+		fmt.Fprintf(&b, "  Suggestion: %s\n\n", f.Suggestion)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// AnalyzeHandler runs rule-based detectors for known performance anti-patterns
+// (formatting churn, regexp compilation, reflection, map and slice growth,
+// string conversions, defers in loops, GC pressure) and reports findings with
+// severity, evidence and a suggested fix.
+// It analyzes the given snapshot, or collects fresh CPU and allocation profiles.
+func AnalyzeHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+
+	var snapshots []*Snapshot
+	if id, _ := request.Params.Arguments["snapshot"].(string); id != "" {
+		snap, err := a.lookupSnapshot(id)
+		if err != nil {
+			return handleMCPError(err), nil
+		}
+		snapshots = append(snapshots, snap)
+	} else {
+		for _, profileType := range []string{ProfileTypeCPU, ProfileTypeAllocs} {
+			data, err := collectProfile(ctx, profileType, request)
+			if err != nil {
+				return handleMCPError(err), nil
+			}
+			snapshots = append(snapshots, a.snapshots.Add(profileType, data))
+		}
+	}
+
+	var sections []string
+	for _, snap := range snapshots {
+		p, err := snap.Profile()
+		if err != nil {
+			return handleMCPError(&ProfileError{
+				ProfileType: snap.ProfileType,
+				Err:         fmt.Errorf("failed to parse profile: %w", err),
+			}), nil
+		}
+		sections = append(sections, formatFindings(snap, p, analyzeProfile(p, snap.ProfileType)))
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(strings.Join(sections, "\n")),
+		},
+	}, nil
+}
@@ -0,0 +1,69 @@
+package pprofmcpagent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeReflection(t *testing.T) {
+	jsonStack := []string{"reflect.Value.Field", "encoding/json.(*encodeState).reflectValue", "encoding/json.Marshal", "main.writeResponse", "main.main"}
+	callStack := []string{"reflect.Value.Call", "main.dispatch", "main.main"}
+	// An RPC dispatcher that calls a handler through reflection, which encodes JSON.
+	nestedStack := []string{"reflect.Value.Field", "encoding/json.Marshal", "main.handler", "reflect.Value.Call", "main.rpc", "main.main"}
+	idle := []string{"main.idle", "main.main"}
+
+	type result struct {
+		severity severity
+		share    float64
+		site     string
+	}
+	tests := []struct {
+		name    string
+		samples []stackSample
+		want    map[string]result
+	}{
+		{
+			name:    "reflection inside encoding/json",
+			samples: []stackSample{{jsonStack, 40}, {idle, 60}},
+			want: map[string]result{
+				"json-reflection": {severityHigh, 0.4, "main.writeResponse"},
+			},
+		},
+		{
+			name:    "direct reflection",
+			samples: []stackSample{{callStack, 20}, {idle, 80}},
+			want: map[string]result{
+				"reflection": {severityMedium, 0.2, "main.dispatch"},
+			},
+		},
+		{
+			name:    "both",
+			samples: []stackSample{{jsonStack, 30}, {callStack, 10}, {idle, 60}},
+			want: map[string]result{
+				"json-reflection": {severityMedium, 0.3, "main.writeResponse"},
+				"reflection":      {severityLow, 0.1, "main.dispatch"},
+			},
+		},
+		{
+			name:    "reflection calling encoding/json",
+			samples: []stackSample{{nestedStack, 20}, {idle, 80}},
+			want: map[string]result{
+				"json-reflection": {severityMedium, 0.2, "main.handler"},
+				"reflection":      {severityMedium, 0.2, "main.rpc"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[string]result)
+			for _, f := range analyzeProfile(stackProfile(tt.samples...), ProfileTypeCPU) {
+				site, _, _ := strings.Cut(f.CallSites[0].Location, " ")
+				got[f.Detector] = result{f.Severity, f.Share, site}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findings = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// MemStatsHandler summarizes runtime.MemStats and debug.GCStats.
+// Heap profiles are sampled and do not show GC behaviour, so this handler reports
+// heap sizes, GC settings, pause percentiles and GC CPU usage, followed by a
+// plain-language interpretation of the numbers.
+func MemStatsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	// Quantiles: min, p25, p50, p75, max
+	gc := debug.GCStats{PauseQuantiles: make([]time.Duration, 5)}
+	debug.ReadGCStats(&gc)
+
+	gogc := readGOGC()
+	memLimit := debug.SetMemoryLimit(-1)
+	liveHeap := readLiveHeap()
+
+	var result strings.Builder
+	result.WriteString("Memory statistics\n\n")
+
+	result.WriteString("Heap:\n")
+	result.WriteString(fmt.Sprintf("  in use: %s (%d objects)\n", formatValue(int64(ms.HeapInuse)), ms.HeapObjects))
+	result.WriteString(fmt.Sprintf("  allocated: %s (live plus not yet collected)\n", formatValue(int64(ms.HeapAlloc))))
+	result.WriteString(fmt.Sprintf("  live after the last GC: %s\n", formatValue(liveHeap)))
+	result.WriteString(fmt.Sprintf("  idle: %s (released to OS: %s)\n", formatValue(int64(ms.HeapIdle)), formatValue(int64(ms.HeapReleased))))
+	result.WriteString(fmt.Sprintf("  next GC target: %s\n", formatValue(int64(ms.NextGC))))
+	result.WriteString(fmt.Sprintf("  total allocated since start: %s (%d objects)\n", formatValue(int64(ms.TotalAlloc)), ms.Mallocs))
+	result.WriteString(fmt.Sprintf("  stacks: %s, runtime metadata: %s\n",
+		formatValue(int64(ms.StackInuse)), formatValue(int64(ms.MSpanInuse+ms.MCacheInuse+ms.GCSys+ms.OtherSys))))
+	result.WriteString(fmt.Sprintf("  obtained from OS: %s\n", formatValue(int64(ms.Sys))))
+
+	result.WriteString("\nGC settings:\n")
+	if gogc < 0 {
+		result.WriteString("  GOGC: off\n")
+	} else {
+		result.WriteString(fmt.Sprintf("  GOGC: %d\n", gogc))
+	}
+	if memLimit == math.MaxInt64 {
+		result.WriteString("  GOMEMLIMIT: unlimited\n")
+	} else {
+		result.WriteString(fmt.Sprintf("  GOMEMLIMIT: %s\n", formatValue(memLimit)))
+	}
+
+	result.WriteString("\nGC activity:\n")
+	result.WriteString(fmt.Sprintf("  cycles: %d (forced: %d)\n", ms.NumGC, ms.NumForcedGC))
+	if gc.NumGC > 0 {
+		result.WriteString(fmt.Sprintf("  last GC: %s ago\n", time.Since(gc.LastGC).Round(time.Millisecond)))
+	}
+	result.WriteString(fmt.Sprintf("  CPU fraction since start: %.2f%%\n", ms.GCCPUFraction*100))
+	result.WriteString(fmt.Sprintf("  total pause: %s\n", gc.PauseTotal))
+	if gc.NumGC > 0 {
+		result.WriteString(fmt.Sprintf("  pause min/p25/p50/p75/max: %s / %s / %s / %s / %s\n",
+			gc.PauseQuantiles[0], gc.PauseQuantiles[1], gc.PauseQuantiles[2], gc.PauseQuantiles[3], gc.PauseQuantiles[4]))
+	}
+
+	result.WriteString("\nInterpretation:\n")
+	result.WriteString(interpretMemStats(&ms, &gc, gogc, memLimit, liveHeap))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(result.String()),
+		},
+	}, nil
+}
+
+// readGOGC returns the current GOGC value without changing it, or -1 if the GC is off.
+func readGOGC() int64 {
+	sample := []metrics.Sample{{Name: "/gc/gogc:percent"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 100
+	}
+	v := sample[0].Value.Uint64()
+	if v > math.MaxInt32 {
+		return -1
+	}
+	return int64(v)
+}
+
+// readLiveHeap returns the heap memory marked live by the last GC cycle.
+func readLiveHeap() int64 {
+	sample := []metrics.Sample{{Name: "/gc/heap/live:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(sample[0].Value.Uint64())
+}
+
+// interpretMemStats explains the memory and GC statistics in plain language.
+// liveHeap is the heap memory marked live by the last GC cycle.
+func interpretMemStats(ms *runtime.MemStats, gc *debug.GCStats, gogc, memLimit, liveHeap int64) string {
+	var notes []string
+
+	switch {
+	case ms.NumGC == 0:
+		notes = append(notes, "No garbage collection has run yet, so the process has allocated little memory or just started.")
+	case ms.GCCPUFraction >= 0.25:
+		notes = append(notes, fmt.Sprintf("The GC has used %.1f%% of the available CPU since start, which is very high; reducing allocations (see allocs-profile) or raising GOGC/GOMEMLIMIT will help.", ms.GCCPUFraction*100))
+	case ms.GCCPUFraction >= 0.05:
+		notes = append(notes, fmt.Sprintf("The GC has used %.1f%% of the available CPU since start, which is noticeable; allocation hot spots in allocs-profile are worth checking.", ms.GCCPUFraction*100))
+	default:
+		notes = append(notes, fmt.Sprintf("The GC has used %.1f%% of the available CPU since start, which is low.", ms.GCCPUFraction*100))
+	}
+
+	if gc.NumGC > 0 {
+		if maxPause := gc.PauseQuantiles[len(gc.PauseQuantiles)-1]; maxPause > 10*time.Millisecond {
+			notes = append(notes, fmt.Sprintf("The longest recent stop-the-world pause was %s, long enough to show up in tail latency.", maxPause))
+		} else {
+			notes = append(notes, "Stop-the-world pauses are short and unlikely to affect latency.")
+		}
+	}
+
+	if ms.NumForcedGC > 0 {
+		notes = append(notes, fmt.Sprintf("%d GC cycles were forced by runtime.GC or debug.FreeOSMemory calls; explicit collections are rarely needed.", ms.NumForcedGC))
+	}
+
+	if memLimit != math.MaxInt64 && float64(ms.HeapInuse) > 0.9*float64(memLimit) {
+		notes = append(notes, fmt.Sprintf("The heap is within 10%% of GOMEMLIMIT (%s); the GC will run very frequently and may thrash if live memory keeps growing.", formatValue(memLimit)))
+	}
+	if gogc < 0 && memLimit == math.MaxInt64 {
+		notes = append(notes, "GOGC is off and no GOMEMLIMIT is set, so the heap can grow without bound.")
+	}
+
+	if retained := int64(ms.HeapIdle) - int64(ms.HeapReleased); retained > 64<<20 && retained > int64(ms.HeapInuse) {
+		notes = append(notes, fmt.Sprintf("%s of idle heap has not been returned to the OS; RSS will look larger than the live heap until the scavenger releases it.", formatValue(retained)))
+	}
+
+	if ms.TotalAlloc > 0 && ms.NumGC > 0 {
+		perCycle := ms.TotalAlloc / uint64(ms.NumGC)
+		notes = append(notes, fmt.Sprintf("On average %s is allocated per GC cycle; the live heap after the last cycle is %s.",
+			formatValue(int64(perCycle)), formatValue(liveHeap)))
+	}
+
+	return strings.Join(notes, " ") + "\n"
+}
@@ -0,0 +1,107 @@
+package pprofmcpagent
+
+import (
+	"math"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterpretMemStats(t *testing.T) {
+	pauses := func(maxPause time.Duration) *debug.GCStats {
+		return &debug.GCStats{NumGC: 10, PauseQuantiles: []time.Duration{0, 0, 0, 0, maxPause}}
+	}
+	tests := []struct {
+		name     string
+		ms       runtime.MemStats
+		gc       *debug.GCStats
+		gogc     int64
+		memLimit int64
+		liveHeap int64
+		contains []string
+		absent   []string
+	}{
+		{
+			name:     "no GC yet",
+			gc:       &debug.GCStats{},
+			gogc:     100,
+			memLimit: math.MaxInt64,
+			contains: []string{"No garbage collection has run yet"},
+			absent:   []string{"pause", "allocated per GC cycle"},
+		},
+		{
+			name:     "healthy",
+			ms:       runtime.MemStats{NumGC: 10, GCCPUFraction: 0.01, TotalAlloc: 100 << 20, HeapAlloc: 6 << 20},
+			gc:       pauses(time.Millisecond),
+			gogc:     100,
+			memLimit: math.MaxInt64,
+			liveHeap: 4 << 20,
+			contains: []string{"1.0% of the available CPU since start, which is low", "pauses are short", "On average 10.00MB is allocated per GC cycle; the live heap after the last cycle is 4.00MB"},
+		},
+		{
+			name:     "noticeable GC",
+			ms:       runtime.MemStats{NumGC: 10, GCCPUFraction: 0.1},
+			gc:       pauses(time.Millisecond),
+			gogc:     100,
+			memLimit: math.MaxInt64,
+			contains: []string{"10.0% of the available CPU since start, which is noticeable"},
+		},
+		{
+			name:     "heavy GC with long pauses",
+			ms:       runtime.MemStats{NumGC: 10, GCCPUFraction: 0.3, NumForcedGC: 3},
+			gc:       pauses(25 * time.Millisecond),
+			gogc:     100,
+			memLimit: math.MaxInt64,
+			contains: []string{"30.0% of the available CPU since start, which is very high", "longest recent stop-the-world pause was 25ms", "3 GC cycles were forced"},
+		},
+		{
+			name:     "near the memory limit",
+			ms:       runtime.MemStats{NumGC: 10, HeapInuse: 95 << 20},
+			gc:       pauses(time.Millisecond),
+			gogc:     100,
+			memLimit: 100 << 20,
+			contains: []string{"within 10% of GOMEMLIMIT (100.00MB)"},
+		},
+		{
+			name:     "unbounded",
+			ms:       runtime.MemStats{NumGC: 10},
+			gc:       pauses(time.Millisecond),
+			gogc:     -1,
+			memLimit: math.MaxInt64,
+			contains: []string{"GOGC is off and no GOMEMLIMIT is set"},
+		},
+		{
+			name:     "GC off with a limit",
+			ms:       runtime.MemStats{NumGC: 10},
+			gc:       pauses(time.Millisecond),
+			gogc:     -1,
+			memLimit: 1 << 30,
+			absent:   []string{"without bound", "GOMEMLIMIT ("},
+		},
+		{
+			name:     "idle heap retained",
+			ms:       runtime.MemStats{NumGC: 10, HeapIdle: 200 << 20, HeapReleased: 50 << 20, HeapInuse: 20 << 20},
+			gc:       pauses(time.Millisecond),
+			gogc:     100,
+			memLimit: math.MaxInt64,
+			contains: []string{"150.00MB of idle heap has not been returned to the OS"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := interpretMemStats(&tt.ms, tt.gc, tt.gogc, tt.memLimit, tt.liveHeap)
+			for _, s := range tt.contains {
+				if !strings.Contains(got, s) {
+					t.Errorf("interpretation does not contain %q:\n%s", s, got)
+				}
+			}
+			for _, s := range tt.absent {
+				if strings.Contains(got, s) {
+					t.Errorf("interpretation contains %q:\n%s", s, got)
+				}
+			}
+		})
+	}
+}
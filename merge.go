@@ -0,0 +1,155 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/pprof/profile"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// mergeInput is a profile to be merged, with the name of its snapshot or file.
+type mergeInput struct {
+	name        string
+	profileType string
+	profile     *profile.Profile
+}
+
+// mergeProfiles scales each input by the corresponding factor and merges them
+// into one profile. Samples with the same stack are combined.
+// Inputs without a scale factor are left unscaled.
+func mergeProfiles(inputs []mergeInput, scales []float64) (*profile.Profile, error) {
+	profiles := make([]*profile.Profile, len(inputs))
+	for i, in := range inputs {
+		if i < len(scales) && scales[i] != 1 {
+			in.profile.Scale(scales[i])
+		}
+		profiles[i] = in.profile
+	}
+	p, err := profile.Merge(profiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge profiles: %w", err)
+	}
+	return p, nil
+}
+
+// mergeInputs loads the snapshots and profile files selected by the snapshots
+// and files request parameters.
+func mergeInputs(a *agent, request mcp.CallToolRequest) ([]mergeInput, error) {
+	var inputs []mergeInput
+	for _, id := range stringsParam(request, "snapshots") {
+		snap, err := a.lookupSnapshot(id)
+		if err != nil {
+			return nil, err
+		}
+		p, err := snap.Profile()
+		if err != nil {
+			return nil, &ProfileError{
+				ProfileType: snap.ProfileType,
+				Err:         fmt.Errorf("failed to parse snapshot %s: %w", id, err),
+			}
+		}
+		inputs = append(inputs, mergeInput{name: id, profileType: snap.ProfileType, profile: p})
+	}
+
+	files := stringsParam(request, "files")
+	if len(files) > 0 && a.files == nil {
+		return nil, fmt.Errorf("no profile directory is configured")
+	}
+	for _, path := range files {
+		p, err := a.files.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, mergeInput{name: path, profileType: detectProfileType(path, p), profile: p})
+	}
+	return inputs, nil
+}
+
+// stringsParam returns the string elements of an array request parameter.
+func stringsParam(request mcp.CallToolRequest, name string) []string {
+	values, _ := request.Params.Arguments[name].([]interface{})
+	var result []string
+	for _, v := range values {
+		if s, ok := v.(string); ok && s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// MergeProfilesHandler merges several snapshots and profile files of the same type
+// into one profile, e.g. to aggregate CPU profiles of several capture windows or replicas.
+// Each input can be scaled first, and average divides the merged values by the number of inputs.
+// The merged profile is stored as a new snapshot and rendered with the usual views.
+func MergeProfilesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+	inputs, err := mergeInputs(a, request)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+	if len(inputs) < 2 {
+		return handleMCPError(fmt.Errorf("at least two snapshots or files are required, got %d", len(inputs))), nil
+	}
+
+	profileType := inputs[0].profileType
+	for _, in := range inputs[1:] {
+		if in.profileType != profileType {
+			return handleMCPError(fmt.Errorf("cannot merge %s profile %s with %s profile %s",
+				in.profileType, in.name, profileType, inputs[0].name)), nil
+		}
+	}
+
+	scales := make([]float64, len(inputs))
+	values, _ := request.Params.Arguments["scales"].([]interface{})
+	if len(values) > len(inputs) {
+		return handleMCPError(fmt.Errorf("got %d scales for %d profiles", len(values), len(inputs))), nil
+	}
+	for i := range scales {
+		scales[i] = 1
+		if i < len(values) {
+			if v, ok := values[i].(float64); ok {
+				scales[i] = v
+			}
+		}
+	}
+
+	p, err := mergeProfiles(inputs, scales)
+	if err != nil {
+		return handleMCPError(&ProfileError{ProfileType: profileType, Err: err}), nil
+	}
+	// Averaging after merging avoids rounding each input's small values separately.
+	average, _ := request.Params.Arguments["average"].(bool)
+	if average {
+		p.Scale(1 / float64(len(inputs)))
+	}
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		return handleMCPError(&ProfileError{
+			ProfileType: profileType,
+			Err:         fmt.Errorf("failed to write merged profile: %w", err),
+		}), nil
+	}
+
+	result, err := renderSnapshot(ctx, profileType, buf.Bytes(), request)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+	var names []string
+	for i, in := range inputs {
+		if scales[i] != 1 {
+			names = append(names, fmt.Sprintf("%s (x%g)", in.name, scales[i]))
+		} else {
+			names = append(names, in.name)
+		}
+	}
+	title := "Merged"
+	if average {
+		title = "Averaged"
+	}
+	header := mcp.NewTextContent(fmt.Sprintf("%s %d %s profiles: %s", title, len(inputs), profileType, strings.Join(names, ", ")))
+	result.Content = append([]mcp.Content{header}, result.Content...)
+	return result, nil
+}
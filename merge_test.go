@@ -0,0 +1,94 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestMergeProfilesHandler(t *testing.T) {
+	a := newAgent(newConfig())
+	ctx := context.WithValue(context.Background(), agentKey{}, a)
+	add := func(profileType string, p *profile.Profile) string {
+		var buf bytes.Buffer
+		if err := p.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return a.snapshots.Add(profileType, buf.Bytes()).ID
+	}
+	cpu1 := add(ProfileTypeCPU, cpuProfile(map[string]int64{"main.a": 10, "main.b": 4}))
+	cpu2 := add(ProfileTypeCPU, cpuProfile(map[string]int64{"main.a": 20, "main.c": 8}))
+	heap := add(ProfileTypeHeap, heapProfile(map[string]int64{"main.a": 1}))
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		contains  []string
+		wantErr   string
+	}{
+		{
+			name:      "merged",
+			arguments: map[string]interface{}{"snapshots": []interface{}{cpu1, cpu2}},
+			contains:  []string{"Merged 2 cpu profiles: " + cpu1 + ", " + cpu2, cpuRow("main.a", 30), cpuRow("main.c", 8), cpuRow("main.b", 4)},
+		},
+		{
+			name:      "scaled",
+			arguments: map[string]interface{}{"snapshots": []interface{}{cpu1, cpu2}, "scales": []interface{}{2.0}},
+			contains:  []string{cpu1 + " (x2), " + cpu2, cpuRow("main.a", 40), cpuRow("main.b", 8)},
+		},
+		{
+			name:      "averaged",
+			arguments: map[string]interface{}{"snapshots": []interface{}{cpu1, cpu2}, "average": true},
+			contains:  []string{"Averaged 2 cpu profiles", cpuRow("main.a", 15), cpuRow("main.c", 4), cpuRow("main.b", 2)},
+		},
+		{
+			name:      "one input",
+			arguments: map[string]interface{}{"snapshots": []interface{}{cpu1}},
+			wantErr:   "at least two snapshots or files are required, got 1",
+		},
+		{
+			name:      "different types",
+			arguments: map[string]interface{}{"snapshots": []interface{}{cpu1, heap}},
+			wantErr:   "cannot merge heap profile " + heap + " with cpu profile " + cpu1,
+		},
+		{
+			name:      "too many scales",
+			arguments: map[string]interface{}{"snapshots": []interface{}{cpu1, cpu2}, "scales": []interface{}{1.0, 2.0, 3.0}},
+			wantErr:   "got 3 scales for 2 profiles",
+		},
+		{
+			name:      "files without a directory",
+			arguments: map[string]interface{}{"snapshots": []interface{}{cpu1}, "files": []interface{}{"cpu.pb.gz"}},
+			wantErr:   "no profile directory is configured",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request mcp.CallToolRequest
+			request.Params.Arguments = tt.arguments
+			result, err := MergeProfilesHandler(ctx, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := resultText(result)
+			if tt.wantErr != "" {
+				if !result.IsError || !strings.Contains(out, tt.wantErr) {
+					t.Fatalf("result = %q, want error %q", out, tt.wantErr)
+				}
+				return
+			}
+			if result.IsError {
+				t.Fatalf("unexpected error: %s", out)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(out, s) {
+					t.Errorf("result does not contain %q:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package pprofmcpagent
+
+import (
+	"regexp"
+	"strings"
+)
+
+// closureSuffix matches nested closure suffixes such as ".func1.2.3".
+var closureSuffix = regexp.MustCompile(`\.func(\d+)((?:\.\d+)+)`)
+
+// majorVersion matches a major version element of an import path, e.g. "v2".
+var majorVersion = regexp.MustCompile(`^v\d+$`)
+
+// trimFunctionName shortens a function name for display:
+//   - the import path is dropped (github.com/org/repo/internal/pkg.F becomes pkg.F)
+//   - generic instantiations are collapsed (pkg.Map[go.shape.int,go.shape.string] becomes pkg.Map[...])
+//   - nested closures are abbreviated to their outermost closure (pkg.F.func1.2.3 becomes pkg.F.func1…)
+func trimFunctionName(name string) string {
+	name = collapseBrackets(name)
+
+	// The last slash before the first parenthesis or bracket ends the import path.
+	end := strings.IndexAny(name, "([")
+	if end < 0 {
+		end = len(name)
+	}
+	if i := strings.LastIndex(name[:end], "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	return closureSuffix.ReplaceAllString(name, ".func$1…")
+}
+
+// collapseBrackets replaces the contents of top-level square brackets with "...".
+func collapseBrackets(name string) string {
+	if !strings.Contains(name, "[") {
+		return name
+	}
+	var b strings.Builder
+	depth := 0
+	for _, r := range name {
+		switch {
+		case r == '[':
+			if depth == 0 {
+				b.WriteString("[...")
+			}
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+			if depth == 0 {
+				b.WriteRune(']')
+			}
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// packageOf returns the import path of the package a function belongs to,
+// e.g. github.com/org/repo/pkg for github.com/org/repo/pkg.(*Type).Method.
+func packageOf(function string) string {
+	name := collapseBrackets(function)
+	slash := strings.LastIndex(name[:indexOrLen(name, "(")], "/")
+	rest := name[slash+1:]
+	dot := strings.Index(rest, ".")
+	if dot < 0 {
+		return name
+	}
+	// Versioned package names such as gopkg.in/yaml.v3 contain a dot.
+	if next := rest[dot+1:]; slash >= 0 {
+		if elem, _, ok := strings.Cut(next, "."); ok && majorVersion.MatchString(elem) {
+			dot += len(elem) + 1
+		}
+	}
+	return name[:slash+1+dot]
+}
+
+// moduleOf guesses the module of a package from its import path: "std" for the
+// standard library, the first three path elements for hosts such as github.com,
+// and the first two elsewhere. A major version suffix (/v2) is kept.
+func moduleOf(pkg string) string {
+	elems := strings.Split(pkg, "/")
+	if !strings.Contains(elems[0], ".") {
+		if pkg == "main" {
+			return pkg
+		}
+		return "std"
+	}
+	n := 2
+	switch elems[0] {
+	case "github.com", "gitlab.com", "bitbucket.org", "golang.org":
+		n = 3
+	}
+	if len(elems) > n && majorVersion.MatchString(elems[n]) {
+		n++
+	}
+	if len(elems) < n {
+		n = len(elems)
+	}
+	return strings.Join(elems[:n], "/")
+}
+
+func indexOrLen(s, substr string) int {
+	if i := strings.Index(s, substr); i >= 0 {
+		return i
+	}
+	return len(s)
+}
@@ -0,0 +1,71 @@
+package pprofmcpagent
+
+import "testing"
+
+func TestTrimFunctionName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"main.main", "main.main"},
+		{"github.com/org/repo/internal/pkg.F", "pkg.F"},
+		{"github.com/org/repo/pkg.(*Server).ServeHTTP", "pkg.(*Server).ServeHTTP"},
+		{"github.com/org/repo/pkg.(*T).M:42", "pkg.(*T).M:42"},
+		{"github.com/org/repo/pkg.Map[go.shape.int,go.shape.string]", "pkg.Map[...]"},
+		{"github.com/org/repo/pkg.Map[go.shape.*github.com/x/y.T]", "pkg.Map[...]"},
+		{"github.com/org/repo/pkg.F.func1.2.3", "pkg.F.func1…"},
+		{"github.com/org/repo/pkg.F.func2", "pkg.F.func2"},
+		{"net/http.(*conn).serve.func1", "http.(*conn).serve.func1"},
+	}
+	for _, tt := range tests {
+		if got := trimFunctionName(tt.name); got != tt.want {
+			t.Errorf("trimFunctionName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPackageOf(t *testing.T) {
+	tests := []struct {
+		function string
+		want     string
+	}{
+		{"main.main", "main"},
+		{"runtime.mallocgc", "runtime"},
+		{"net/http.(*conn).serve", "net/http"},
+		{"github.com/org/repo/pkg.(*Type).Method", "github.com/org/repo/pkg"},
+		{"github.com/org/repo/pkg.F.func1", "github.com/org/repo/pkg"},
+		{"gopkg.in/yaml.v3.Unmarshal", "gopkg.in/yaml.v3"},
+		{"gopkg.in/yaml.v3.(*parser).parse", "gopkg.in/yaml.v3"},
+		{"github.com/org/repo/pkg.Map[go.shape.*github.com/x/y.T]", "github.com/org/repo/pkg"},
+		{"noPackage", "noPackage"},
+	}
+	for _, tt := range tests {
+		if got := packageOf(tt.function); got != tt.want {
+			t.Errorf("packageOf(%q) = %q, want %q", tt.function, got, tt.want)
+		}
+	}
+}
+
+func TestModuleOf(t *testing.T) {
+	tests := []struct {
+		pkg  string
+		want string
+	}{
+		{"main", "main"},
+		{"runtime", "std"},
+		{"net/http", "std"},
+		{"github.com/org/repo", "github.com/org/repo"},
+		{"github.com/org/repo/internal/pkg", "github.com/org/repo"},
+		{"github.com/org/repo/v2/pkg", "github.com/org/repo/v2"},
+		{"golang.org/x/net/http2", "golang.org/x/net"},
+		{"gopkg.in/yaml.v3", "gopkg.in/yaml.v3"},
+		{"example.com/mod/pkg", "example.com/mod"},
+		{"example.com/mod/v3/pkg", "example.com/mod/v3"},
+		{"github.com/org", "github.com/org"},
+	}
+	for _, tt := range tests {
+		if got := moduleOf(tt.pkg); got != tt.want {
+			t.Errorf("moduleOf(%q) = %q, want %q", tt.pkg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Default snapshot retention limits
+const (
+	DefaultSnapshotMaxCount = 64
+	DefaultSnapshotMaxBytes = 64 << 20
+)
+
+// Option configures the pprof MCP server created by NewPprofServer or ServeSSE.
+type Option func(*config)
+
+// config holds the settings collected from Options.
+type config struct {
+	snapshotMaxCount int
+	snapshotMaxBytes int64
+	snapshotDir      string
+	ctx              context.Context
+	continuous       *ContinuousProfilingConfig
+	triggers         []Trigger
+	triggerInterval  time.Duration
+	remoteTarget     string
+	noLocalProcess   bool
+	httpClient       *http.Client
+	targets          []Target
+	targetsFile      string
+	targetsDir       string
+	profileDir       string
+	baselineDir      string
+	moduleDir        string
+	runtimeControl   bool
+	blockProfileRate *int
+	policies         []Policy
+	authenticator    Authenticator
+	auditSinks       []AuditSink
+	redactionRules   []RedactionRule
+}
+
+func newConfig(opts ...Option) *config {
+	cfg := &config{
+		snapshotMaxCount: DefaultSnapshotMaxCount,
+		snapshotMaxBytes: DefaultSnapshotMaxBytes,
+		ctx:              context.Background(),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithSnapshotRetention bounds the snapshot store by number of snapshots and total bytes.
+// The oldest snapshots are evicted first. A non-positive value disables that bound.
+func WithSnapshotRetention(maxCount int, maxBytes int64) Option {
+	return func(c *config) {
+		c.snapshotMaxCount = maxCount
+		c.snapshotMaxBytes = maxBytes
+	}
+}
+
+// WithSnapshotDir persists snapshots as .pb.gz files in the given directory,
+// so they survive restarts. Existing snapshot files in the directory are loaded on startup.
+func WithSnapshotDir(dir string) Option {
+	return func(c *config) {
+		c.snapshotDir = dir
+	}
+}
+
+// WithContext sets the context that bounds the lifetime of background work
+// such as continuous profiling. ServeSSE sets it to its own context.
+func WithContext(ctx context.Context) Option {
+	return func(c *config) {
+		c.ctx = ctx
+	}
+}
+
+// WithRemoteTarget makes the server fetch profiles from a remote net/http/pprof
+// endpoint (e.g. "http://host:6060" or "http://host:6060/debug/pprof") instead of
+// profiling the current process. Tools that read the local runtime directly,
+// such as runtime-metrics and memstats, and threshold triggers are not available in this mode.
+func WithRemoteTarget(target string) Option {
+	return func(c *config) {
+		c.remoteTarget = target
+	}
+}
+
+// WithoutLocalProcess keeps the server from profiling the current process when no
+// remote target is set, for servers that only profile the targets registered with
+// WithTargets, WithTargetsFile or WithTargetsDir, or only analyze files. Tools that
+// collect profiles then fail unless a target is selected through their target and
+// targets arguments, and tools that read the local runtime are not available.
+func WithoutLocalProcess() Option {
+	return func(c *config) {
+		c.noLocalProcess = true
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to fetch remote profiles (default: http.DefaultClient).
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) {
+		c.httpClient = client
+	}
+}
+
+// agent holds the state shared by all tool handlers of one server.
+type agent struct {
+	source     profileSource
+	remote     bool
+	snapshots  *snapshotStore
+	traces     *snapshotStore
+	continuous *continuousCollector
+	triggers   *triggerWatcher
+	targets    *targetRegistry
+	files      *profileFiles
+	baselines  *baselineStore
+	bench      *benchmarkRunner
+	control    *runtimeControl
+	// policies restrict tool calls per identity; see checkPolicy.
+	policies      []Policy
+	authenticator Authenticator
+	auditLog      *auditLog
+	redactor      *redactor
+	// tools are the registered tools by name, for their argument defaults.
+	tools      map[string]mcp.Tool
+	httpClient *http.Client
+	// configErr is an invalid configuration found at startup; ServeSSE and ServeStdio return it.
+	configErr error
+}
+
+func newAgent(cfg *config) *agent {
+	r := newRedactor(cfg.redactionRules)
+	a := &agent{
+		source:        localSource{cpu: processCPUProfiler},
+		snapshots:     newSnapshotStore(cfg.snapshotMaxCount, cfg.snapshotMaxBytes, cfg.snapshotDir, r),
+		traces:        newSnapshotStore(maxStoredTraces, maxStoredTraceBytes, "", nil),
+		baselines:     newBaselineStore(cfg.baselineDir, r),
+		httpClient:    cfg.httpClient,
+		policies:      cfg.policies,
+		authenticator: cfg.authenticator,
+		auditLog:      newAuditLog(cfg.auditSinks),
+		redactor:      r,
+		tools:         make(map[string]mcp.Tool),
+	}
+	if cfg.remoteTarget != "" {
+		a.source = newRemoteSource(cfg.remoteTarget, cfg.httpClient)
+		a.remote = true
+	} else if cfg.noLocalProcess {
+		a.source = noProcessSource{}
+		a.remote = true
+	}
+	a.source = a.redactor.source(a.source)
+	targets, err := newTargetRegistry(cfg)
+	if err != nil {
+		log.Printf("invalid configuration: %v", err)
+		a.configErr = err
+	}
+	a.targets = targets
+	if cfg.profileDir != "" {
+		a.files = &profileFiles{root: cfg.profileDir, redactor: a.redactor}
+	}
+	if cfg.moduleDir != "" {
+		a.bench = &benchmarkRunner{dir: cfg.moduleDir}
+	}
+	if cfg.continuous != nil {
+		a.continuous = newContinuousCollector(*cfg.continuous, a.source)
+		go a.continuous.run(cfg.ctx)
+	}
+	if cfg.blockProfileRate != nil && a.remote {
+		log.Printf("the block profile rate is set in the local runtime and is ignored for remote targets")
+	} else if cfg.blockProfileRate != nil {
+		setBlockProfileRate(int64(*cfg.blockProfileRate))
+	}
+	if cfg.runtimeControl && a.remote {
+		log.Printf("runtime control changes the local runtime and is ignored for remote targets")
+	} else if cfg.runtimeControl {
+		a.control = enableRuntimeControl(cfg.ctx, a)
+	}
+	if len(cfg.triggers) > 0 && a.remote {
+		log.Printf("threshold triggers watch local runtime metrics and are ignored for remote targets")
+	} else if len(cfg.triggers) > 0 {
+		triggers, err := newTriggerWatcher(cfg.triggers, cfg.triggerInterval, a.source, a.snapshots)
+		if err != nil {
+			log.Printf("invalid configuration: %v", err)
+			a.configErr = err
+		} else {
+			a.triggers = triggers
+			go a.triggers.run(cfg.ctx)
+		}
+	}
+	return a
+}
+
+// lookupSnapshot finds a snapshot by ID in the snapshot store
+// or in the continuous profiling ring buffer.
+func (a *agent) lookupSnapshot(id string) (*Snapshot, error) {
+	snap, err := a.snapshots.Get(id)
+	if err != nil && a.continuous != nil {
+		if bgSnap, bgErr := a.continuous.ring.Get(id); bgErr == nil {
+			return bgSnap, nil
+		}
+	}
+	return snap, err
+}
+
+// defaultAgent is used when handlers are called outside of a server created by NewPprofServer.
+var defaultAgent = newAgent(newConfig())
+
+type agentKey struct{}
+
+// agentFromContext returns the agent attached to the context, or the default agent.
+func agentFromContext(ctx context.Context) *agent {
+	if a, ok := ctx.Value(agentKey{}).(*agent); ok {
+		return a
+	}
+	return defaultAgent
+}
+
+// middleware attaches the agent to the context of every tool call and
+// denies calls that the policy of the caller's identity does not allow.
+func (a *agent) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if err := a.checkPolicy(ctx, request); err != nil {
+			identity, _ := identityFromContext(ctx)
+			a.audit(AuditEntry{
+				Identity:  identity,
+				Tool:      request.Params.Name,
+				Action:    AuditActionDeny,
+				Detail:    err.Error(),
+				Arguments: request.Params.Arguments,
+			})
+			return handleMCPError(fmt.Errorf("permission denied: %w", err)), nil
+		}
+		return a.auditCall(ctx, request, func() (*mcp.CallToolResult, error) {
+			return next(context.WithValue(ctx, agentKey{}, a), request)
+		})
+	}
+}
+
+// resourceMiddleware attaches the agent to the context of a resource read, records
+// the read in the audit log and denies reads that the policy of the caller's identity
+// does not allow for the tool that produced the resource.
+func (a *agent) resourceMiddleware(tool string, next server.ResourceTemplateHandlerFunc) server.ResourceTemplateHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		identity, _ := identityFromContext(ctx)
+		if len(a.policies) > 0 {
+			if _, _, err := a.checkToolAccess(ctx, tool); err != nil {
+				a.audit(AuditEntry{
+					Identity: identity,
+					Tool:     tool,
+					Action:   AuditActionDeny,
+					Detail:   fmt.Sprintf("%s: %v", request.Params.URI, err),
+				})
+				return nil, fmt.Errorf("permission denied: %w", err)
+			}
+		}
+
+		start := time.Now()
+		contents, err := next(context.WithValue(ctx, agentKey{}, a), request)
+		e := AuditEntry{
+			Time:     start,
+			Identity: identity,
+			Tool:     tool,
+			Action:   AuditActionRead,
+			Detail:   request.Params.URI,
+			Duration: time.Since(start),
+		}
+		for _, c := range contents {
+			switch c := c.(type) {
+			case mcp.BlobResourceContents:
+				e.ResultBytes += len(c.Blob)
+			case mcp.TextResourceContents:
+				e.ResultBytes += len(c.Text)
+			}
+		}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		a.audit(e)
+		return contents, err
+	}
+}
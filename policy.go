@@ -0,0 +1,257 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// mutatingTools are the tools denied by read-only policies: they change the
+// profiled process, write files or run code.
+var mutatingTools = []string{
+	"set-runtime-setting",
+	"force-gc",
+	"save-baseline",
+	"run-benchmark",
+}
+
+// durationArguments are the arguments, in seconds, for which a tool call blocks
+// while it samples: the duration of CPU profiles, execution traces and other
+// sampled captures, the interval between the two samples of runtime-metrics,
+// and the timeout of run-benchmark.
+var durationArguments = []string{"duration", "interval", "timeout"}
+
+// privilegedTools are only allowed by policies that list them in Allow by name:
+// the audit log shows the calls and arguments of every identity.
+var privilegedTools = []string{
+	"recent-audit",
+}
+
+// captureTools are the tools that capture each profile type. Profiles of other
+// types are captured by named-profile.
+var captureTools = map[string]string{
+	ProfileTypeHeap:         "heap-profile",
+	ProfileTypeGoroutine:    "goroutine-profile",
+	ProfileTypeThreadCreate: "threadcreate-profile",
+	ProfileTypeBlock:        "block-profile",
+	ProfileTypeAllocs:       "allocs-profile",
+	ProfileTypeCPU:          "cpu-profile",
+}
+
+// Policy restricts the tools an identity may call and the arguments it may use.
+type Policy struct {
+	// Identity is the authenticated identity the policy applies to, or "*" for
+	// identities without a policy of their own, including unauthenticated clients.
+	Identity string
+	// Allow lists the tools the identity may call, by name or pattern (e.g. "*-profile").
+	// An empty list allows all tools except recent-audit, which must be listed by name.
+	Allow []string
+	// Deny lists tools the identity may not call, by name or pattern. Deny takes precedence over Allow.
+	// Tools that capture a profile, such as named-profile, diff-profiles and analyze,
+	// may only capture the profile types whose tool (e.g. cpu-profile) is allowed.
+	Deny []string
+	// ReadOnly denies tools that change the process, write files or run code
+	// (set-runtime-setting, force-gc, save-baseline, run-benchmark).
+	ReadOnly bool
+	// MaxDuration caps the duration argument of CPU profiles, execution traces and
+	// other sampled captures, the interval argument of runtime-metrics and the
+	// timeout argument of run-benchmark, including the tool's default when it is
+	// not given. Zero means no cap.
+	MaxDuration time.Duration
+	// MaxLimit caps the limit argument, including the tool's default. Zero means no cap.
+	MaxLimit int
+}
+
+// WithPolicies restricts tool calls per authenticated identity. Each call is
+// checked against the policy of its identity, or the "*" policy; calls from
+// identities without a matching policy are denied. Without policies, all calls are allowed.
+// Identities are set by WithAuthenticator, WithBearerTokens or ContextWithIdentity.
+func WithPolicies(policies ...Policy) Option {
+	return func(c *config) {
+		c.policies = append(c.policies, policies...)
+	}
+}
+
+// Authenticator returns the identity of the client that sent an HTTP request.
+type Authenticator func(r *http.Request) (string, error)
+
+// WithAuthenticator authenticates the requests of SSE clients. The identity it
+// returns selects the policy applied to the client's tool calls. Requests that fail
+// authentication are handled as unauthenticated, so only the "*" policy applies to them.
+func WithAuthenticator(auth Authenticator) Option {
+	return func(c *config) {
+		c.authenticator = auth
+	}
+}
+
+// WithBearerTokens authenticates SSE clients by the bearer token in their
+// Authorization header. tokens maps each token to the identity it authenticates.
+func WithBearerTokens(tokens map[string]string) Option {
+	return WithAuthenticator(func(r *http.Request) (string, error) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return "", fmt.Errorf("missing bearer token")
+		}
+		identity, ok := tokens[token]
+		if !ok {
+			return "", fmt.Errorf("unknown bearer token")
+		}
+		return identity, nil
+	})
+}
+
+type identityKey struct{}
+
+// identityInfo is the result of authenticating a client.
+type identityInfo struct {
+	identity string
+	err      error
+}
+
+// ContextWithIdentity returns a context whose tool calls are made on behalf of identity.
+// It is used by transports other than ServeSSE to apply per-identity policies.
+func ContextWithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identityInfo{identity: identity})
+}
+
+// identityFromContext returns the identity of a tool call and the authentication error, if any.
+// Unauthenticated calls have an empty identity.
+func identityFromContext(ctx context.Context) (string, error) {
+	info, _ := ctx.Value(identityKey{}).(identityInfo)
+	return info.identity, info.err
+}
+
+// authenticate attaches the identity of an HTTP request's client to the context.
+func (a *agent) authenticate(ctx context.Context, r *http.Request) context.Context {
+	if a.authenticator == nil {
+		return ctx
+	}
+	identity, err := a.authenticator(r)
+	if err != nil {
+		identity = ""
+	}
+	return context.WithValue(ctx, identityKey{}, identityInfo{identity: identity, err: err})
+}
+
+// policyFor returns the policy of an identity: its own, or the "*" policy.
+func (a *agent) policyFor(identity string) (Policy, bool) {
+	var fallback *Policy
+	for i, p := range a.policies {
+		if identity != "" && p.Identity == identity {
+			return p, true
+		}
+		if p.Identity == "*" && fallback == nil {
+			fallback = &a.policies[i]
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return Policy{}, false
+}
+
+// checkPolicy returns an error explaining why a tool call is denied, or nil if it is allowed.
+func (a *agent) checkPolicy(ctx context.Context, request mcp.CallToolRequest) error {
+	if len(a.policies) == 0 {
+		return nil
+	}
+	tool := request.Params.Name
+	p, who, err := a.checkToolAccess(ctx, tool)
+	if err != nil {
+		return err
+	}
+
+	if p.MaxDuration > 0 {
+		for _, name := range durationArguments {
+			if d, ok := a.numberArgument(request, name); ok && time.Duration(d*float64(time.Second)) > p.MaxDuration {
+				return fmt.Errorf("%s may not set %s above %s for %s (requested %s)",
+					who, name, p.MaxDuration, tool, time.Duration(d*float64(time.Second)))
+			}
+		}
+	}
+	if p.MaxLimit > 0 {
+		if l, ok := a.numberArgument(request, "limit"); ok && int(l) > p.MaxLimit {
+			return fmt.Errorf("%s may not use a limit above %d for %s (requested %d)", who, p.MaxLimit, tool, int(l))
+		}
+	}
+	return nil
+}
+
+// checkToolAccess returns the caller's policy and description if the policy lets it
+// use the tool, or an error explaining why it may not. Resources are checked against
+// the tool that produced them.
+func (a *agent) checkToolAccess(ctx context.Context, tool string) (Policy, string, error) {
+	identity, authErr := identityFromContext(ctx)
+	who := fmt.Sprintf("identity %q", identity)
+	if identity == "" {
+		who = "an unauthenticated client"
+		if authErr != nil {
+			who = fmt.Sprintf("an unauthenticated client (%v)", authErr)
+		}
+	}
+
+	p, ok := a.policyFor(identity)
+	if !ok {
+		return p, who, fmt.Errorf("no policy allows %s to call tools", who)
+	}
+	if len(p.Allow) > 0 && !matchesAny(p.Allow, tool) {
+		return p, who, fmt.Errorf("%s may not call %s (allowed: %s)", who, tool, strings.Join(p.Allow, ", "))
+	}
+	if matchesAny(p.Deny, tool) {
+		return p, who, fmt.Errorf("%s may not call %s", who, tool)
+	}
+	if p.ReadOnly && matchesAny(mutatingTools, tool) {
+		return p, who, fmt.Errorf("%s has read-only access and may not call %s", who, tool)
+	}
+	if slices.Contains(privilegedTools, tool) && !slices.Contains(p.Allow, tool) {
+		return p, who, fmt.Errorf("%s may not call %s unless its policy allows it by name", who, tool)
+	}
+	return p, who, nil
+}
+
+// checkCapture returns an error if the caller's policy denies the tool that captures
+// profileType, so the profile cannot be captured through another tool either.
+func (a *agent) checkCapture(ctx context.Context, profileType string) error {
+	if len(a.policies) == 0 {
+		return nil
+	}
+	tool, ok := captureTools[profileType]
+	if !ok {
+		tool = "named-profile"
+	}
+	if _, _, err := a.checkToolAccess(ctx, tool); err != nil {
+		return fmt.Errorf("permission denied: %w", err)
+	}
+	return nil
+}
+
+// numberArgument returns a numeric argument of a tool call, or the tool's default
+// when the argument is not given.
+func (a *agent) numberArgument(request mcp.CallToolRequest, name string) (float64, bool) {
+	if v, ok := request.Params.Arguments[name].(float64); ok {
+		return v, true
+	}
+	tool, ok := a.tools[request.Params.Name]
+	if !ok {
+		return 0, false
+	}
+	prop, _ := tool.InputSchema.Properties[name].(map[string]interface{})
+	v, ok := prop["default"].(float64)
+	return v, ok
+}
+
+// matchesAny reports whether the tool name matches any of the names or patterns.
+func matchesAny(patterns []string, tool string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, tool); ok && err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestCheckPolicy(t *testing.T) {
+	policies := []Policy{
+		{Identity: "dev", Allow: []string{"*-profile", "analyze"}, Deny: []string{"goroutine-profile"}},
+		{Identity: "ops", ReadOnly: true, MaxDuration: 5 * time.Second, MaxLimit: 200},
+		{Identity: "admin", Allow: []string{"*", "recent-audit"}},
+		{Identity: "viewer", Allow: []string{"recent-*"}},
+		{Identity: "*", Allow: []string{"list-*"}},
+	}
+	tests := []struct {
+		name      string
+		identity  string
+		tool      string
+		arguments map[string]interface{}
+		wantErr   string
+	}{
+		{name: "allowed by pattern", identity: "dev", tool: "heap-profile"},
+		{name: "allowed by name", identity: "dev", tool: "analyze"},
+		{name: "not allowed", identity: "dev", tool: "force-gc", wantErr: `identity "dev" may not call force-gc (allowed: *-profile, analyze)`},
+		{name: "deny takes precedence", identity: "dev", tool: "goroutine-profile", wantErr: `identity "dev" may not call goroutine-profile`},
+		{name: "read-only", identity: "ops", tool: "save-baseline", wantErr: "has read-only access and may not call save-baseline"},
+		{name: "read-only allows reads", identity: "ops", tool: "heap-profile"},
+		{name: "duration below cap", identity: "ops", tool: "cpu-profile", arguments: map[string]interface{}{"duration": float64(2)}},
+		{name: "duration above cap", identity: "ops", tool: "cpu-profile", arguments: map[string]interface{}{"duration": float64(30)}, wantErr: "may not set duration above 5s for cpu-profile (requested 30s)"},
+		{name: "default duration above cap", identity: "ops", tool: "cpu-profile", wantErr: "(requested 10s)"},
+		{name: "interval above cap", identity: "ops", tool: "runtime-metrics", arguments: map[string]interface{}{"interval": float64(60)}, wantErr: "may not set interval above 5s for runtime-metrics (requested 1m0s)"},
+		{name: "interval below cap", identity: "ops", tool: "runtime-metrics", arguments: map[string]interface{}{"interval": float64(1)}},
+		{name: "limit above cap", identity: "ops", tool: "heap-profile", arguments: map[string]interface{}{"limit": float64(500)}, wantErr: "may not use a limit above 200 for heap-profile (requested 500)"},
+		{name: "audit log by name", identity: "admin", tool: "recent-audit"},
+		{name: "audit log with empty allow", identity: "ops", tool: "recent-audit", wantErr: `identity "ops" may not call recent-audit unless its policy allows it by name`},
+		{name: "audit log by pattern", identity: "viewer", tool: "recent-audit", wantErr: `identity "viewer" may not call recent-audit unless`},
+		{name: "fallback policy", identity: "guest", tool: "list-profiles"},
+		{name: "unauthenticated", tool: "heap-profile", wantErr: "an unauthenticated client may not call heap-profile"},
+	}
+	_, a := newPprofServer(newConfig(WithPolicies(policies...)))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.identity != "" {
+				ctx = ContextWithIdentity(ctx, tt.identity)
+			}
+			var request mcp.CallToolRequest
+			request.Params.Name = tt.tool
+			request.Params.Arguments = tt.arguments
+			err := a.checkPolicy(ctx, request)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	_, a = newPprofServer(newConfig(WithModuleDir(t.TempDir()),
+		WithPolicies(Policy{Identity: "ci", Allow: []string{"run-benchmark"}, MaxDuration: time.Minute})))
+	ctx := ContextWithIdentity(context.Background(), "ci")
+	var request mcp.CallToolRequest
+	request.Params.Name = "run-benchmark"
+	if err := a.checkPolicy(ctx, request); err == nil || !strings.Contains(err.Error(), "may not set timeout above 1m0s for run-benchmark (requested 10m0s)") {
+		t.Errorf("default benchmark timeout above cap: error = %v", err)
+	}
+	request.Params.Arguments = map[string]interface{}{"timeout": float64(30)}
+	if err := a.checkPolicy(ctx, request); err != nil {
+		t.Errorf("benchmark timeout below cap: %v", err)
+	}
+
+	_, a = newPprofServer(newConfig(WithPolicies(Policy{Identity: "dev"})))
+	if err := a.checkPolicy(context.Background(), mcp.CallToolRequest{}); err == nil || !strings.Contains(err.Error(), "no policy allows") {
+		t.Errorf("call without a matching policy: error = %v", err)
+	}
+}
+
+func TestCapturePolicy(t *testing.T) {
+	policies := []Policy{
+		{Identity: "dev", Deny: []string{"cpu-profile"}},
+		{Identity: "ops", Allow: []string{"diff-profiles", "named-profile"}},
+	}
+	_, a := newPprofServer(newConfig(WithPolicies(policies...)))
+	cpu := a.snapshots.Add(ProfileTypeCPU, nil).ID
+	heap := a.snapshots.Add(ProfileTypeHeap, nil).ID
+
+	tests := []struct {
+		name      string
+		identity  string
+		handler   func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)
+		arguments map[string]interface{}
+		wantErr   string
+	}{
+		{
+			name:      "cpu through named-profile",
+			identity:  "dev",
+			handler:   NamedProfileHandler,
+			arguments: map[string]interface{}{"name": "cpu", "duration": 0.05},
+			wantErr:   `permission denied: identity "dev" may not call cpu-profile`,
+		},
+		{
+			name:      "cpu through diff-profiles",
+			identity:  "dev",
+			handler:   DiffProfilesHandler,
+			arguments: map[string]interface{}{"base": cpu, "current": "now", "duration": 0.05},
+			wantErr:   `permission denied: identity "dev" may not call cpu-profile`,
+		},
+		{
+			name:      "cpu through analyze",
+			identity:  "dev",
+			handler:   AnalyzeHandler,
+			arguments: map[string]interface{}{"duration": 0.05},
+			wantErr:   `permission denied: identity "dev" may not call cpu-profile`,
+		},
+		{
+			name:      "heap through named-profile",
+			identity:  "ops",
+			handler:   NamedProfileHandler,
+			arguments: map[string]interface{}{"name": "heap"},
+			wantErr:   `permission denied: identity "ops" may not call heap-profile`,
+		},
+		{
+			name:      "heap through diff-profiles",
+			identity:  "ops",
+			handler:   DiffProfilesHandler,
+			arguments: map[string]interface{}{"base": heap, "current": "now"},
+			wantErr:   `permission denied: identity "ops" may not call heap-profile`,
+		},
+		{
+			name:      "custom profile through named-profile",
+			identity:  "ops",
+			handler:   NamedProfileHandler,
+			arguments: map[string]interface{}{"name": "mutex"},
+		},
+		{
+			name:      "allowed capture",
+			identity:  "dev",
+			handler:   NamedProfileHandler,
+			arguments: map[string]interface{}{"name": "heap"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(ContextWithIdentity(context.Background(), tt.identity), agentKey{}, a)
+			var request mcp.CallToolRequest
+			request.Params.Arguments = tt.arguments
+			result, err := tt.handler(ctx, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := resultText(result)
+			if tt.wantErr == "" {
+				if result.IsError {
+					t.Fatalf("unexpected error: %s", out)
+				}
+				return
+			}
+			if !result.IsError || !strings.Contains(out, tt.wantErr) {
+				t.Fatalf("result = %q, want error %q", out, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResourceReadPolicy(t *testing.T) {
+	policies := []Policy{
+		{Identity: "dev", Allow: []string{"execution-trace"}},
+		{Identity: "ops", Deny: []string{"execution-trace"}},
+	}
+	tests := []struct {
+		identity string
+		wantErr  string
+		action   string
+	}{
+		{identity: "dev", action: AuditActionRead},
+		{identity: "ops", wantErr: `permission denied: identity "ops" may not call execution-trace`, action: AuditActionDeny},
+		{identity: "guest", wantErr: "permission denied: no policy allows", action: AuditActionDeny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.identity, func(t *testing.T) {
+			_, a := newPprofServer(newConfig(WithPolicies(policies...)))
+			snap := a.traces.Add(ProfileTypeTrace, []byte("go 1.26 trace"))
+			uri := traceResourcePrefix + snap.ID
+
+			var request mcp.ReadResourceRequest
+			request.Params.URI = uri
+			handler := a.resourceMiddleware("execution-trace", TraceResourceHandler)
+			contents, err := handler(ContextWithIdentity(context.Background(), tt.identity), request)
+			if tt.wantErr == "" {
+				if err != nil || len(contents) != 1 {
+					t.Fatalf("read = %d contents, %v; want the trace", len(contents), err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+
+			entries := a.auditLog.list(10, func(AuditEntry) bool { return true })
+			if len(entries) != 1 {
+				t.Fatalf("got %d audit entries, want 1", len(entries))
+			}
+			e := entries[0]
+			if e.Identity != tt.identity || e.Tool != "execution-trace" || e.Action != tt.action || !strings.HasPrefix(e.Detail, uri) {
+				t.Errorf("audit entry = %+v", e)
+			}
+			if tt.action == AuditActionRead && e.ResultBytes == 0 {
+				t.Error("read entry has no result size")
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// progressInterval is how often progress notifications are emitted during a capture.
+const progressInterval = time.Second
+
+// progressReporter sends MCP progress notifications for a single tool request.
+// Notifications are only sent when the client supplied a progress token;
+// otherwise every method is a no-op.
+type progressReporter struct {
+	srv   *server.MCPServer
+	token mcp.ProgressToken
+}
+
+// newProgressReporter creates a progressReporter for the given request.
+func newProgressReporter(ctx context.Context, request mcp.CallToolRequest) *progressReporter {
+	r := &progressReporter{srv: server.ServerFromContext(ctx)}
+	if request.Params.Meta != nil {
+		r.token = request.Params.Meta.ProgressToken
+	}
+	return r
+}
+
+// report emits a notifications/progress message with the given progress and total.
+// Delivery failures are ignored, since progress is best effort.
+func (r *progressReporter) report(ctx context.Context, progress, total float64) {
+	if r.srv == nil || r.token == nil {
+		return
+	}
+	params := map[string]any{
+		"progressToken": r.token,
+		"progress":      progress,
+	}
+	if total > 0 {
+		params["total"] = total
+	}
+	_ = r.srv.SendNotificationToClient(ctx, "notifications/progress", params)
+}
+
+// waitWithProgress blocks for the given capture window and reports the elapsed
+// and total seconds once per progressInterval. It is used by every windowed
+// collection (CPU profiles, delta captures) so clients do not see a silent request.
+// It returns the context error if the request is cancelled before the window ends.
+func waitWithProgress(ctx context.Context, request mcp.CallToolRequest, d time.Duration) error {
+	reporter := newProgressReporter(ctx, request)
+	total := d.Seconds()
+	reporter.report(ctx, 0, total)
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			reporter.report(ctx, total, total)
+			return nil
+		case <-ticker.C:
+			elapsed := time.Since(start).Seconds()
+			if elapsed > total {
+				elapsed = total
+			}
+			reporter.report(ctx, elapsed, total)
+		}
+	}
+}
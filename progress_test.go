@@ -0,0 +1,80 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// testSession is an initialized client session that collects notifications.
+type testSession struct {
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *testSession) Initialize()       {}
+func (s *testSession) Initialized() bool { return true }
+func (s *testSession) SessionID() string { return "test" }
+func (s *testSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func TestWaitWithProgress(t *testing.T) {
+	tests := []struct {
+		name string
+		meta string
+		want []map[string]any
+	}{
+		{
+			name: "progress token",
+			meta: `, "_meta": {"progressToken": "capture-1"}`,
+			want: []map[string]any{
+				{"progressToken": "capture-1", "progress": 0.0, "total": 0.05},
+				{"progressToken": "capture-1", "progress": 0.05, "total": 0.05},
+			},
+		},
+		{
+			name: "no progress token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewPprofServer()
+			session := &testSession{notifications: make(chan mcp.JSONRPCNotification, 10)}
+			ctx := s.WithContext(context.Background(), session)
+			message := `{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "cpu-profile", "arguments": {"duration": 0.05}` + tt.meta + `}}`
+			if response, ok := s.HandleMessage(ctx, json.RawMessage(message)).(mcp.JSONRPCResponse); !ok {
+				t.Fatalf("tool call failed: %+v", response)
+			}
+			close(session.notifications)
+
+			var got []map[string]any
+			for n := range session.notifications {
+				if n.Method != "notifications/progress" {
+					t.Errorf("unexpected notification %s", n.Method)
+					continue
+				}
+				got = append(got, n.Params.AdditionalFields)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("progress = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitWithProgressCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if err := waitWithProgress(ctx, mcp.CallToolRequest{}, time.Minute); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancelled wait took %s", elapsed)
+	}
+}
@@ -0,0 +1,150 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Prompt name constants
+const (
+	PromptInvestigateMemoryLeak  = "investigate-memory-leak"
+	PromptFindCPUHotspot         = "find-cpu-hotspot"
+	PromptDiagnoseLockContention = "diagnose-lock-contention"
+)
+
+// NewInvestigateMemoryLeakPrompt creates a new MCP prompt that guides a memory leak investigation.
+// It walks the agent through comparing in-use heap memory against allocation churn
+// and correlating the result with goroutine growth.
+func NewInvestigateMemoryLeakPrompt() mcp.Prompt {
+	return mcp.NewPrompt(PromptInvestigateMemoryLeak,
+		mcp.WithPromptDescription("Guided investigation of steadily growing memory usage"),
+		mcp.WithArgument("focus",
+			mcp.ArgumentDescription("Optional function or package name to pay special attention to"),
+		),
+	)
+}
+
+// NewFindCPUHotspotPrompt creates a new MCP prompt that guides a CPU hotspot investigation.
+// It instructs the agent to capture a CPU profile and drill down from cumulative
+// to flat values before looking at the call graph.
+func NewFindCPUHotspotPrompt() mcp.Prompt {
+	return mcp.NewPrompt(PromptFindCPUHotspot,
+		mcp.WithPromptDescription("Guided investigation of high CPU usage"),
+		mcp.WithArgument("duration",
+			mcp.ArgumentDescription("CPU profiling duration in seconds (default: 10)"),
+		),
+		mcp.WithArgument("focus",
+			mcp.ArgumentDescription("Optional function or package name to pay special attention to"),
+		),
+	)
+}
+
+// NewDiagnoseLockContentionPrompt creates a new MCP prompt that guides a lock contention investigation.
+// It combines block, mutex and goroutine profiles to find where goroutines wait
+// and which code paths hold the contended locks.
+func NewDiagnoseLockContentionPrompt() mcp.Prompt {
+	return mcp.NewPrompt(PromptDiagnoseLockContention,
+		mcp.WithPromptDescription("Guided investigation of lock contention and blocked goroutines"),
+		mcp.WithArgument("focus",
+			mcp.ArgumentDescription("Optional function or package name to pay special attention to"),
+		),
+	)
+}
+
+// InvestigateMemoryLeakPromptHandler returns the step-by-step instructions for a memory leak investigation.
+func InvestigateMemoryLeakPromptHandler(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	var b strings.Builder
+	b.WriteString("Investigate a suspected memory leak in this Go process using the pprof tools.\n\n")
+	b.WriteString("Steps:\n")
+	b.WriteString("1. Call `heap-profile` with {\"view\": \"flat\", \"limit\": 100}. ")
+	b.WriteString("Each location shows the objects and bytes allocated since start, then the objects and bytes currently in use; ")
+	b.WriteString("rank locations by the bytes in use, the last value.\n")
+	b.WriteString("2. Call `heap-profile` with {\"view\": \"graph\", \"limit\": 100} for the top in-use locations ")
+	b.WriteString("to see which callers retain the memory.\n")
+	b.WriteString("3. Call `allocs-profile` with {\"view\": \"flat\", \"limit\": 100}. ")
+	b.WriteString("Locations with high total allocation but low in-use memory are churn, not leaks.\n")
+	b.WriteString("4. Call `goroutine-profile` with {\"view\": \"flat\", \"limit\": 100}. ")
+	b.WriteString("A large or growing number of goroutines parked at the same location often retains memory through their stacks and closures.\n\n")
+	b.WriteString("Interpretation:\n")
+	b.WriteString("- A leak shows up as in-use memory concentrated in a few locations that keep growing between calls.\n")
+	b.WriteString("- Caches, maps and slices that are appended to but never truncated are the usual culprits.\n")
+	b.WriteString("- Heap profiles are sampled; small values are approximate and should not be reported as exact.\n")
+	writePromptFocus(&b, request)
+	b.WriteString("\nFinish with a short summary: the most likely leaking location, the evidence, and a suggested fix.")
+
+	return newPromptResult("Memory leak investigation", b.String()), nil
+}
+
+// FindCPUHotspotPromptHandler returns the step-by-step instructions for a CPU hotspot investigation.
+func FindCPUHotspotPromptHandler(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	duration := 10.0
+	if d, err := strconv.ParseFloat(request.Params.Arguments["duration"], 64); err == nil && d > 0 && !math.IsInf(d, 1) {
+		duration = d
+	}
+
+	var b strings.Builder
+	b.WriteString("Find the CPU hotspots of this Go process using the pprof tools.\n\n")
+	b.WriteString("Steps:\n")
+	fmt.Fprintf(&b, "1. Call `cpu-profile` with {\"duration\": %g, \"view\": \"flat\", \"limit\": 100}. ", duration)
+	b.WriteString("Flat values show CPU time spent directly in each function.\n")
+	fmt.Fprintf(&b, "2. Call `cpu-profile` with {\"duration\": %g, \"view\": \"cum\", \"limit\": 100}. ", duration)
+	b.WriteString("Cumulative values include callees and point at the expensive high-level operations.\n")
+	fmt.Fprintf(&b, "3. Call `cpu-profile` with {\"duration\": %g, \"view\": \"graph\", \"limit\": 100} ", duration)
+	b.WriteString("to see which callers drive the top functions.\n")
+	b.WriteString("4. If runtime.mallocgc or runtime.gcBgMarkWorker rank high, call `allocs-profile` ")
+	b.WriteString("with {\"view\": \"flat\", \"limit\": 100} to find the allocation sites behind the GC cost.\n\n")
+	b.WriteString("Interpretation:\n")
+	b.WriteString("- A function with high flat time is itself expensive; optimize its body.\n")
+	b.WriteString("- A function with high cumulative but low flat time is expensive because of what it calls.\n")
+	b.WriteString("- The process must be under representative load while the profile is captured, otherwise the result is mostly idle time.\n")
+	writePromptFocus(&b, request)
+	b.WriteString("\nFinish with a ranked list of hotspots, the evidence for each, and a suggested optimization.")
+
+	return newPromptResult("CPU hotspot investigation", b.String()), nil
+}
+
+// DiagnoseLockContentionPromptHandler returns the step-by-step instructions for a lock contention investigation.
+func DiagnoseLockContentionPromptHandler(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	var b strings.Builder
+	b.WriteString("Diagnose lock contention and blocked goroutines in this Go process using the pprof tools.\n\n")
+	b.WriteString("Steps:\n")
+	b.WriteString("1. Call `block-profile` with {\"view\": \"flat\", \"limit\": 100}. ")
+	b.WriteString("The first value is the number of contentions, the second is the total delay.\n")
+	b.WriteString("2. Call `block-profile` with {\"view\": \"graph\", \"limit\": 100} ")
+	b.WriteString("to see which callers reach the blocking call sites.\n")
+	b.WriteString("3. Call `named-profile` with {\"name\": \"mutex\", \"view\": \"flat\", \"limit\": 100}. ")
+	b.WriteString("The mutex profile attributes the delay to the code that held the lock when it was released, so it shows who causes the waiting.\n")
+	b.WriteString("4. Call `goroutine-profile` with {\"view\": \"flat\", \"limit\": 100}. ")
+	b.WriteString("Many goroutines parked at the same location confirm the contention point.\n\n")
+	b.WriteString("Interpretation:\n")
+	b.WriteString("- Rank blocking sites by total delay, not by contention count; a few long waits matter more than many short ones.\n")
+	b.WriteString("- sync.(*Mutex).Lock and sync.(*RWMutex).Lock indicate mutex contention; runtime.chansend and runtime.chanrecv indicate channel back-pressure.\n")
+	b.WriteString("- An empty block profile usually means block profiling is disabled; it requires runtime.SetBlockProfileRate in the target process.\n")
+	b.WriteString("- An empty mutex profile usually means mutex profiling is disabled; it requires runtime.SetMutexProfileFraction in the target process.\n")
+	writePromptFocus(&b, request)
+	b.WriteString("\nFinish with the most contended locations, which code paths wait on them, and a suggested fix.")
+
+	return newPromptResult("Lock contention investigation", b.String()), nil
+}
+
+// writePromptFocus appends the optional focus instruction shared by all prompts.
+func writePromptFocus(b *strings.Builder, request mcp.GetPromptRequest) {
+	if focus := request.Params.Arguments["focus"]; focus != "" {
+		fmt.Fprintf(b, "\nPay special attention to locations matching %q.\n", focus)
+	}
+}
+
+// newPromptResult wraps prompt text into a single user message.
+func newPromptResult(description, text string) *mcp.GetPromptResult {
+	return &mcp.GetPromptResult{
+		Description: description,
+		Messages: []mcp.PromptMessage{
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(text)),
+		},
+	}
+}
@@ -0,0 +1,89 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestPromptHandlers(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   server.PromptHandlerFunc
+		arguments map[string]string
+		contains  []string
+		absent    []string
+	}{
+		{
+			name:     "cpu default duration",
+			handler:  FindCPUHotspotPromptHandler,
+			contains: []string{`{"duration": 10, "view": "flat"`},
+		},
+		{
+			name:      "cpu duration",
+			handler:   FindCPUHotspotPromptHandler,
+			arguments: map[string]string{"duration": "2.5"},
+			contains:  []string{`{"duration": 2.5, "view": "cum"`},
+		},
+		{
+			name:      "cpu invalid duration",
+			handler:   FindCPUHotspotPromptHandler,
+			arguments: map[string]string{"duration": "10s, \"limit\": 1"},
+			contains:  []string{`{"duration": 10, "view": "graph"`},
+			absent:    []string{"10s"},
+		},
+		{
+			name:      "cpu negative duration",
+			handler:   FindCPUHotspotPromptHandler,
+			arguments: map[string]string{"duration": "-5"},
+			contains:  []string{`{"duration": 10,`},
+		},
+		{
+			name:      "cpu infinite duration",
+			handler:   FindCPUHotspotPromptHandler,
+			arguments: map[string]string{"duration": "Inf"},
+			contains:  []string{`{"duration": 10,`},
+		},
+		{
+			name:     "heap values",
+			handler:  InvestigateMemoryLeakPromptHandler,
+			contains: []string{"objects and bytes allocated since start, then the objects and bytes currently in use"},
+			absent:   []string{"The first value is memory currently in use"},
+		},
+		{
+			name:     "lock contention",
+			handler:  DiagnoseLockContentionPromptHandler,
+			contains: []string{"`block-profile`", "`named-profile` with {\"name\": \"mutex\"", "SetMutexProfileFraction"},
+		},
+		{
+			name:      "focus",
+			handler:   DiagnoseLockContentionPromptHandler,
+			arguments: map[string]string{"focus": "internal/cache"},
+			contains:  []string{`Pay special attention to locations matching "internal/cache"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request mcp.GetPromptRequest
+			request.Params.Arguments = tt.arguments
+			result, err := tt.handler(context.Background(), request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text := result.Messages[0].Content.(mcp.TextContent).Text
+			for _, s := range tt.contains {
+				if !strings.Contains(text, s) {
+					t.Errorf("prompt does not contain %q:\n%s", s, text)
+				}
+			}
+			for _, s := range tt.absent {
+				if strings.Contains(text, s) {
+					t.Errorf("prompt contains %q:\n%s", s, text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultRedactionReplacement replaces matches of rules without a replacement.
+const defaultRedactionReplacement = "[redacted]"
+
+// RedactionRule replaces the parts of function names, file paths or label values
+// that match a regular expression before profile data leaves the process.
+type RedactionRule struct {
+	// Pattern is a regular expression (RE2 syntax), e.g. `^github\.com/acme/internal/`.
+	Pattern string
+	// Replacement replaces each match and may refer to submatches as $1.
+	// Empty means "[redacted]".
+	Replacement string
+	// Functions applies the rule to function names.
+	Functions bool
+	// Files applies the rule to source file paths and mapped binary paths.
+	Files bool
+	// Labels applies the rule to sample label values, and to task and region names of execution traces.
+	Labels bool
+}
+
+// WithRedaction rewrites function names, file paths and label values of all
+// collected profiles before they are stored, rendered or exported. A rule that
+// selects none of Functions, Files and Labels applies to all of them.
+// If a pattern is invalid, tools that return profile data fail rather than leak it.
+// Raw execution traces cannot be rewritten and are not exported while rules are set.
+// Persisted snapshots and baselines are redacted when they are loaded.
+func WithRedaction(rules ...RedactionRule) Option {
+	return func(c *config) {
+		c.redactionRules = append(c.redactionRules, rules...)
+	}
+}
+
+// compiledRedactionRule is a RedactionRule with its pattern compiled.
+type compiledRedactionRule struct {
+	RedactionRule
+	re *regexp.Regexp
+}
+
+// redactor applies redaction rules. A nil redactor leaves all data unchanged.
+type redactor struct {
+	functions, files, labels []compiledRedactionRule
+	// err is the error of an invalid rule; it is returned for all data so nothing leaks.
+	err error
+}
+
+// newRedactor compiles redaction rules. It returns nil if there are none.
+func newRedactor(rules []RedactionRule) *redactor {
+	if len(rules) == 0 {
+		return nil
+	}
+	r := &redactor{}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			r.err = fmt.Errorf("invalid redaction rule %q: %w", rule.Pattern, err)
+			log.Print(r.err)
+			continue
+		}
+		if rule.Replacement == "" {
+			rule.Replacement = defaultRedactionReplacement
+		}
+		c := compiledRedactionRule{RedactionRule: rule, re: re}
+		all := !rule.Functions && !rule.Files && !rule.Labels
+		if all || rule.Functions {
+			r.functions = append(r.functions, c)
+		}
+		if all || rule.Files {
+			r.files = append(r.files, c)
+		}
+		if all || rule.Labels {
+			r.labels = append(r.labels, c)
+		}
+	}
+	return r
+}
+
+// applyRedactions replaces the matches of the rules in s.
+func applyRedactions(rules []compiledRedactionRule, s string) string {
+	if s == "" {
+		return s
+	}
+	for _, rule := range rules {
+		s = rule.re.ReplaceAllString(s, rule.Replacement)
+	}
+	return s
+}
+
+func (r *redactor) function(name string) string {
+	if r == nil {
+		return name
+	}
+	return applyRedactions(r.functions, name)
+}
+
+func (r *redactor) file(path string) string {
+	if r == nil {
+		return path
+	}
+	return applyRedactions(r.files, path)
+}
+
+func (r *redactor) label(value string) string {
+	if r == nil {
+		return value
+	}
+	return applyRedactions(r.labels, value)
+}
+
+// profile redacts a parsed profile in place.
+func (r *redactor) profile(p *profile.Profile) error {
+	if r == nil {
+		return nil
+	}
+	if r.err != nil {
+		return r.err
+	}
+	for _, f := range p.Function {
+		f.Name = r.function(f.Name)
+		f.SystemName = r.function(f.SystemName)
+		f.Filename = r.file(f.Filename)
+	}
+	for _, m := range p.Mapping {
+		m.File = r.file(m.File)
+	}
+	for _, s := range p.Sample {
+		for key, values := range s.Label {
+			// Label slices may be shared between samples, e.g. after SetLabel
+			redacted := make([]string, len(values))
+			for i, v := range values {
+				redacted[i] = r.label(v)
+			}
+			s.Label[key] = redacted
+		}
+	}
+	return nil
+}
+
+// data redacts gzipped protobuf profile data.
+func (r *redactor) data(data []byte) ([]byte, error) {
+	if r == nil {
+		return data, nil
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	p, err := profile.ParseData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse profile for redaction: %w", err)
+	}
+	if err := r.profile(p); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		return nil, fmt.Errorf("failed to write redacted profile: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// goroutines redacts the frames of parsed goroutine stacks in place.
+func (r *redactor) goroutines(goroutines []*goroutineStack) error {
+	if r == nil {
+		return nil
+	}
+	if r.err != nil {
+		return r.err
+	}
+	for _, g := range goroutines {
+		for i := range g.Frames {
+			g.Frames[i].Function = r.function(g.Frames[i].Function)
+			g.Frames[i].File = r.file(g.Frames[i].File)
+		}
+	}
+	return nil
+}
+
+// trace redacts the goroutine, task and region names of a trace summary in place.
+func (r *redactor) trace(s *traceSummary) error {
+	if r == nil {
+		return nil
+	}
+	if r.err != nil {
+		return r.err
+	}
+	for _, g := range s.goroutines {
+		g.name = r.function(g.name)
+	}
+	s.tasks = r.spans(s.tasks)
+	s.regions = r.spans(s.regions)
+	return nil
+}
+
+// spans returns the spans keyed by their redacted names, merging spans whose names
+// become equal.
+func (r *redactor) spans(spans map[string]*traceSpan) map[string]*traceSpan {
+	result := make(map[string]*traceSpan, len(spans))
+	for name, sp := range spans {
+		name = r.label(name)
+		existing, ok := result[name]
+		if !ok {
+			result[name] = sp
+			continue
+		}
+		existing.count += sp.count
+		existing.total += sp.total
+		if sp.max > existing.max {
+			existing.max = sp.max
+		}
+	}
+	return result
+}
+
+// source returns src with its profiles redacted, or src itself without rules.
+func (r *redactor) source(src profileSource) profileSource {
+	if r == nil {
+		return src
+	}
+	return redactingSource{profileSource: src, redactor: r}
+}
+
+// redactingSource redacts the profiles of a profile source. Goroutine dumps and
+// execution traces are redacted by their handlers after parsing.
+type redactingSource struct {
+	profileSource
+	redactor *redactor
+}
+
+func (s redactingSource) Profile(ctx context.Context, request mcp.CallToolRequest, name string, d time.Duration) ([]byte, error) {
+	data, err := s.profileSource.Profile(ctx, request, name, d)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = s.redactor.data(data); err != nil {
+		return nil, &ProfileError{ProfileType: name, Err: err}
+	}
+	return data, nil
+}
@@ -0,0 +1,198 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// redactionTestProfile returns a CPU profile with an internal function name,
+// a home directory path and a tenant label.
+func redactionTestProfile() *profile.Profile {
+	fn := &profile.Function{
+		ID:         1,
+		Name:       "github.com/acme/internal/billing.Charge",
+		SystemName: "github.com/acme/internal/billing.Charge",
+		Filename:   "/home/alice/src/billing/charge.go",
+	}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn, Line: 42}}}
+	return &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:     10000000,
+		Sample: []*profile.Sample{{
+			Location: []*profile.Location{loc},
+			Value:    []int64{5, 50000000},
+			Label:    map[string][]string{"tenant": {"tenant-42"}},
+		}},
+		Location: []*profile.Location{loc},
+		Function: []*profile.Function{fn},
+	}
+}
+
+func redactionTestData(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := redactionTestProfile().Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+var testRedactionRules = []RedactionRule{
+	{Pattern: `^github\.com/acme/internal/`, Replacement: "internal/", Functions: true},
+	{Pattern: `^/home/[^/]+/`, Replacement: "~/", Files: true},
+	{Pattern: `tenant-[0-9]+`, Labels: true},
+}
+
+func TestRedactorProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []RedactionRule
+		function string
+		file     string
+		label    string
+	}{
+		{
+			name:     "per field",
+			rules:    testRedactionRules,
+			function: "internal/billing.Charge",
+			file:     "~/src/billing/charge.go",
+			label:    "[redacted]",
+		},
+		{
+			name:     "all fields",
+			rules:    []RedactionRule{{Pattern: `acme|alice|42`}},
+			function: "github.com/[redacted]/internal/billing.Charge",
+			file:     "/home/[redacted]/src/billing/charge.go",
+			label:    "tenant-[redacted]",
+		},
+		{
+			name:     "submatches",
+			rules:    []RedactionRule{{Pattern: `^github\.com/(\w+)/internal/`, Replacement: "$1/", Functions: true}},
+			function: "acme/billing.Charge",
+			file:     "/home/alice/src/billing/charge.go",
+			label:    "tenant-42",
+		},
+		{
+			name:     "only the selected field",
+			rules:    []RedactionRule{{Pattern: `billing`, Files: true}},
+			function: "github.com/acme/internal/billing.Charge",
+			file:     "/home/alice/src/[redacted]/charge.go",
+			label:    "tenant-42",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := redactionTestProfile()
+			if err := newRedactor(tt.rules).profile(p); err != nil {
+				t.Fatal(err)
+			}
+			fn := p.Function[0]
+			if fn.Name != tt.function || fn.SystemName != tt.function {
+				t.Errorf("function = %q (system %q), want %q", fn.Name, fn.SystemName, tt.function)
+			}
+			if fn.Filename != tt.file {
+				t.Errorf("file = %q, want %q", fn.Filename, tt.file)
+			}
+			if got := p.Sample[0].Label["tenant"][0]; got != tt.label {
+				t.Errorf("label = %q, want %q", got, tt.label)
+			}
+		})
+	}
+}
+
+func TestRedactorInvalidRule(t *testing.T) {
+	r := newRedactor([]RedactionRule{{Pattern: `^github\.com/acme/`}, {Pattern: `(`}})
+	if _, err := r.data(redactionTestData(t)); err == nil || !strings.Contains(err.Error(), "invalid redaction rule") {
+		t.Fatalf("error = %v, want an invalid rule error", err)
+	}
+	if r := newRedactor(nil); r != nil {
+		t.Fatal("redactor without rules is not nil")
+	}
+}
+
+// TestRedactPersistedProfiles checks that snapshots and baselines saved before
+// redaction was configured are redacted when they are shown.
+func TestRedactPersistedProfiles(t *testing.T) {
+	snapshotDir, baselineDir := t.TempDir(), t.TempDir()
+	data := redactionTestData(t)
+	snap := newSnapshotStore(10, 0, snapshotDir, nil).Add(ProfileTypeCPU, data)
+	if _, err := newBaselineStore(baselineDir, nil).Save("before-rules", ProfileTypeCPU, data); err != nil {
+		t.Fatal(err)
+	}
+
+	_, a := newPprofServer(newConfig(
+		WithSnapshotDir(snapshotDir),
+		WithBaselineDir(baselineDir),
+		WithRedaction(testRedactionRules...),
+	))
+	ctx := context.WithValue(context.Background(), agentKey{}, a)
+
+	t.Run("get-snapshot", func(t *testing.T) {
+		var request mcp.CallToolRequest
+		request.Params.Arguments = map[string]interface{}{"id": snap.ID}
+		result, err := GetSnapshotHandler(ctx, request)
+		if err != nil || result.IsError {
+			t.Fatalf("GetSnapshotHandler = %v, %v", resultText(result), err)
+		}
+		out := resultText(result)
+		if strings.Contains(out, "acme") || !strings.Contains(out, "internal/billing.Charge") {
+			t.Errorf("snapshot is not redacted:\n%s", out)
+		}
+	})
+
+	t.Run("baseline", func(t *testing.T) {
+		b, err := a.baselines.Get("before-rules")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := b.Profile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Function[0].Name; got != "internal/billing.Charge" {
+			t.Errorf("baseline function = %q, want it redacted", got)
+		}
+	})
+
+	t.Run("invalid rule", func(t *testing.T) {
+		_, a := newPprofServer(newConfig(WithSnapshotDir(snapshotDir), WithRedaction(RedactionRule{Pattern: "("})))
+		if _, err := a.snapshots.Get(snap.ID); err == nil {
+			t.Error("snapshot that cannot be redacted was loaded")
+		}
+	})
+}
+
+func TestRenderProfileFileRedaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpu.pb.gz")
+	if err := os.WriteFile(path, redactionTestData(t), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := RenderProfileFile(path, 10, ViewModeFlat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "github.com/acme/internal/billing.Charge") {
+		t.Errorf("unredacted output does not show the function:\n%s", out)
+	}
+
+	out, err = RenderProfileFile(path, 10, ViewModeFlat, testRedactionRules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "acme") || !strings.Contains(out, "internal/billing.Charge") {
+		t.Errorf("output is not redacted:\n%s", out)
+	}
+
+	if _, err := RenderProfileFile(path, 10, ViewModeFlat, RedactionRule{Pattern: "("}); err == nil {
+		t.Error("rendering with an invalid rule succeeded")
+	}
+}
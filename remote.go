@@ -0,0 +1,149 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxRemoteErrorBody limits how much of an error response is included in error messages.
+const maxRemoteErrorBody = 512
+
+// remoteSource fetches profiles from a remote net/http/pprof endpoint.
+type remoteSource struct {
+	baseURL string
+	client  *http.Client
+}
+
+// newRemoteSource creates a remoteSource for the given target. The target may be
+// the server root (http://host:6060) or the /debug/pprof endpoint itself.
+func newRemoteSource(target string, client *http.Client) *remoteSource {
+	base := strings.TrimRight(target, "/")
+	if !strings.HasSuffix(base, "/debug/pprof") {
+		base += "/debug/pprof"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &remoteSource{baseURL: base, client: client}
+}
+
+func (s *remoteSource) Profile(ctx context.Context, request mcp.CallToolRequest, name string, d time.Duration) ([]byte, error) {
+	if name == ProfileTypeCPU {
+		return s.fetchWindow(ctx, request, ProfileTypeCPU, "profile", d)
+	}
+	data, err := s.fetch(ctx, url.PathEscape(name))
+	if err != nil {
+		return nil, &ProfileError{ProfileType: name, Err: err}
+	}
+	return data, nil
+}
+
+func (s *remoteSource) Trace(ctx context.Context, request mcp.CallToolRequest, d time.Duration) ([]byte, error) {
+	return s.fetchWindow(ctx, request, ProfileTypeTrace, "trace", d)
+}
+
+// remoteIndexEntry matches a profile row of the net/http/pprof index page.
+var remoteIndexEntry = regexp.MustCompile(`<td>(\d+)</td><td><a href='?([^'?>]+)\?debug=1'?>`)
+
+// remoteNonProfiles are net/http/pprof index entries that are not runtime/pprof profiles.
+var remoteNonProfiles = map[string]bool{
+	"cmdline": true,
+	"profile": true,
+	"symbol":  true,
+	"trace":   true,
+}
+
+func (s *remoteSource) Profiles(ctx context.Context) ([]profileInfo, error) {
+	data, err := s.fetch(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var result []profileInfo
+	for _, m := range remoteIndexEntry.FindAllStringSubmatch(string(data), -1) {
+		count, _ := strconv.Atoi(m[1])
+		name, err := url.PathUnescape(m[2])
+		if err != nil {
+			name = m[2]
+		}
+		if remoteNonProfiles[name] {
+			continue
+		}
+		result = append(result, profileInfo{Name: name, Count: count})
+	}
+	return result, nil
+}
+
+func (s *remoteSource) GoroutineDump(ctx context.Context) ([]byte, error) {
+	data, err := s.fetch(ctx, ProfileTypeGoroutine+"?debug=2")
+	if err != nil {
+		return nil, &ProfileError{ProfileType: ProfileTypeGoroutine, Err: err}
+	}
+	return data, nil
+}
+
+// fetchWindow fetches a profile of the given type that is collected over a time window
+// (CPU profile or trace) from path, reporting progress while the remote process is sampling.
+func (s *remoteSource) fetchWindow(ctx context.Context, request mcp.CallToolRequest, profileType, path string, d time.Duration) ([]byte, error) {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	type fetchResult struct {
+		data []byte
+		err  error
+	}
+	done := make(chan fetchResult, 1)
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		data, err := s.fetch(fetchCtx, fmt.Sprintf("%s?seconds=%d", path, seconds))
+		done <- fetchResult{data, err}
+	}()
+
+	waitCtx, stopWaiting := context.WithCancel(ctx)
+	go func() {
+		_ = waitWithProgress(waitCtx, request, time.Duration(seconds)*time.Second)
+	}()
+	res := <-done
+	stopWaiting()
+
+	if res.err != nil {
+		return nil, &ProfileError{ProfileType: profileType, Err: res.err}
+	}
+	return res.data, nil
+}
+
+// fetch performs a GET request for the given path relative to the pprof endpoint.
+func (s *remoteSource) fetch(ctx context.Context, path string) ([]byte, error) {
+	target := s.baseURL + "/" + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxRemoteErrorBody))
+		return nil, fmt.Errorf("failed to fetch %s: %s: %s", target, resp.Status, strings.TrimSpace(string(body)))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", target, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,124 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestNewRemoteSource(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"http://localhost:6060", "http://localhost:6060/debug/pprof"},
+		{"http://localhost:6060/", "http://localhost:6060/debug/pprof"},
+		{"http://localhost:6060/debug/pprof", "http://localhost:6060/debug/pprof"},
+		{"http://localhost:6060/debug/pprof/", "http://localhost:6060/debug/pprof"},
+		{"https://example.com/admin", "https://example.com/admin/debug/pprof"},
+	}
+	for _, tt := range tests {
+		if got := newRemoteSource(tt.target, nil).baseURL; got != tt.want {
+			t.Errorf("newRemoteSource(%q) base URL = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteSource(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	s := newRemoteSource(srv.URL, srv.Client())
+	ctx := context.Background()
+
+	t.Run("profiles", func(t *testing.T) {
+		profiles, err := s.Profiles(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make(map[string]bool)
+		for _, p := range profiles {
+			names[p.Name] = true
+		}
+		for _, name := range []string{ProfileTypeHeap, ProfileTypeGoroutine, ProfileTypeMutex} {
+			if !names[name] {
+				t.Errorf("profiles %+v do not include %s", profiles, name)
+			}
+		}
+		for name := range remoteNonProfiles {
+			if names[name] {
+				t.Errorf("profiles include %s, which is not a profile", name)
+			}
+		}
+	})
+
+	tests := []struct {
+		name     string
+		profile  string
+		duration time.Duration
+		wantType string
+		wantErr  string
+	}{
+		{name: "heap", profile: ProfileTypeHeap, wantType: "alloc_objects"},
+		{name: "goroutine", profile: ProfileTypeGoroutine, wantType: "goroutine"},
+		{name: "cpu", profile: ProfileTypeCPU, duration: time.Second, wantType: "samples"},
+		{name: "unknown", profile: "no-such-profile", wantErr: "404 Not Found: Unknown profile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := s.Profile(ctx, mcp.CallToolRequest{}, tt.profile, tt.duration)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := profile.Parse(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.SampleType[0].Type; got != tt.wantType {
+				t.Errorf("first sample type = %q, want %q", got, tt.wantType)
+			}
+		})
+	}
+
+	t.Run("goroutine dump", func(t *testing.T) {
+		data, err := s.GoroutineDump(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "goroutine ") || !strings.Contains(string(data), "TestRemoteSource") {
+			t.Errorf("goroutine dump does not list the test goroutine:\n%s", data)
+		}
+	})
+}
+
+func TestRemoteSourceWindowErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "profiling disabled", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	s := newRemoteSource(srv.URL, srv.Client())
+	ctx := context.Background()
+
+	if _, err := s.Profile(ctx, mcp.CallToolRequest{}, ProfileTypeCPU, time.Second); err == nil || !strings.HasPrefix(err.Error(), "profile error (cpu): ") {
+		t.Errorf("CPU profile error = %v, want a cpu profile error", err)
+	}
+	if _, err := s.Trace(ctx, mcp.CallToolRequest{}, time.Second); err == nil || !strings.HasPrefix(err.Error(), "profile error (trace): ") {
+		t.Errorf("trace error = %v, want a trace profile error", err)
+	}
+}
@@ -0,0 +1,175 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// histogramQuantiles are the percentiles rendered for histogram metrics.
+var histogramQuantiles = []float64{0.5, 0.9, 0.99}
+
+// RuntimeMetricsHandler reports the scalar runtime state from runtime/metrics.
+// Metrics can be filtered by name. If an interval is given, metrics are sampled
+// twice and cumulative metrics are reported as rates per second over the interval;
+// histograms then describe only the observations made during the interval.
+func RuntimeMetricsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	filter, _ := request.Params.Arguments["filter"].(string)
+	interval, _ := request.Params.Arguments["interval"].(float64)
+
+	descs := filterMetrics(metrics.All(), filter)
+	if len(descs) == 0 {
+		return handleMCPError(fmt.Errorf("no runtime metrics match %q", filter)), nil
+	}
+
+	samples := make([]metrics.Sample, len(descs))
+	for i, desc := range descs {
+		samples[i].Name = desc.Name
+	}
+	metrics.Read(samples)
+
+	var result strings.Builder
+	if interval <= 0 {
+		result.WriteString(fmt.Sprintf("Runtime metrics (%d)\n\n", len(descs)))
+		for i, desc := range descs {
+			result.WriteString(fmt.Sprintf("%s: %s\n", desc.Name, formatMetricSample(samples[i].Value, desc.Name)))
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.NewTextContent(result.String()),
+			},
+		}, nil
+	}
+
+	// Read into a second slice so the first histograms are not overwritten
+	prev := samples
+	samples = make([]metrics.Sample, len(prev))
+	for i, sample := range prev {
+		samples[i].Name = sample.Name
+	}
+	d := time.Duration(interval * float64(time.Second))
+	if err := waitWithProgress(ctx, request, d); err != nil {
+		return handleMCPError(err), nil
+	}
+	metrics.Read(samples)
+
+	result.WriteString(fmt.Sprintf("Runtime metrics over %s (%d)\n", d, len(descs)))
+	result.WriteString("Cumulative metrics are shown as rates per second; histograms cover the interval only.\n\n")
+	for i, desc := range descs {
+		result.WriteString(fmt.Sprintf("%s: %s\n", desc.Name, formatMetricDelta(prev[i].Value, samples[i].Value, desc, d)))
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(result.String()),
+		},
+	}, nil
+}
+
+// filterMetrics returns the metric descriptions whose name contains any of the
+// comma-separated filter terms. An empty filter matches every metric.
+func filterMetrics(descs []metrics.Description, filter string) []metrics.Description {
+	var terms []string
+	for _, term := range strings.Split(filter, ",") {
+		if term = strings.TrimSpace(term); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) == 0 {
+		return descs
+	}
+
+	var result []metrics.Description
+	for _, desc := range descs {
+		for _, term := range terms {
+			if strings.Contains(desc.Name, term) {
+				result = append(result, desc)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// formatMetricSample formats a metric value according to its kind and unit.
+func formatMetricSample(v metrics.Value, name string) string {
+	switch v.Kind() {
+	case metrics.KindUint64:
+		return formatMetricNumber(float64(v.Uint64()), name)
+	case metrics.KindFloat64:
+		return formatMetricNumber(v.Float64(), name)
+	case metrics.KindFloat64Histogram:
+		return formatHistogram(v.Float64Histogram(), name)
+	default:
+		return "unsupported metric"
+	}
+}
+
+// formatMetricDelta formats the change of a metric between two reads.
+// Cumulative scalar metrics are reported as a rate, other scalars as their current value,
+// and histograms as the distribution of observations made in between.
+func formatMetricDelta(prev, cur metrics.Value, desc metrics.Description, d time.Duration) string {
+	switch cur.Kind() {
+	case metrics.KindFloat64Histogram:
+		return formatHistogram(subtractHistogram(cur.Float64Histogram(), prev.Float64Histogram()), desc.Name)
+	case metrics.KindUint64, metrics.KindFloat64:
+		if !desc.Cumulative {
+			return formatMetricSample(cur, desc.Name)
+		}
+		delta := metricFloat(cur) - metricFloat(prev)
+		return fmt.Sprintf("%s/s (%s total)", formatMetricNumber(delta/d.Seconds(), desc.Name), formatMetricNumber(metricFloat(cur), desc.Name))
+	default:
+		return "unsupported metric"
+	}
+}
+
+// formatHistogram renders the count and percentiles of a runtime/metrics histogram.
+func formatHistogram(h *metrics.Float64Histogram, name string) string {
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total == 0 {
+		return "no observations"
+	}
+
+	parts := []string{fmt.Sprintf("count=%d", total)}
+	for _, q := range histogramQuantiles {
+		parts = append(parts, fmt.Sprintf("p%g=%s", q*100, formatMetricNumber(histogramPercentile(h, q), name)))
+	}
+	parts = append(parts, fmt.Sprintf("max=%s", formatMetricNumber(histogramPercentile(h, 1), name)))
+	return strings.Join(parts, ", ")
+}
+
+// formatMetricNumber formats a number using the unit suffix of the metric name.
+func formatMetricNumber(v float64, name string) string {
+	_, unit, _ := cutLast(name, ":")
+	switch unit {
+	case "bytes":
+		if v >= math.MaxInt64 {
+			return "unlimited"
+		}
+		return formatValue(int64(v))
+	case "seconds":
+		return time.Duration(v * float64(time.Second)).String()
+	case "cpu-seconds":
+		return fmt.Sprintf("%.3fs", v)
+	}
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return fmt.Sprintf("%.0f %s", v, unit)
+	}
+	return fmt.Sprintf("%.3f %s", v, unit)
+}
+
+// metricFloat returns a scalar metric value as float64.
+func metricFloat(v metrics.Value) float64 {
+	if v.Kind() == metrics.KindUint64 {
+		return float64(v.Uint64())
+	}
+	return v.Float64()
+}
@@ -0,0 +1,140 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"runtime/metrics"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestFilterMetrics(t *testing.T) {
+	descs := []metrics.Description{
+		{Name: "/gc/heap/goal:bytes"},
+		{Name: "/sched/goroutines:goroutines"},
+		{Name: "/memory/classes/total:bytes"},
+	}
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{"", []string{"/gc/heap/goal:bytes", "/sched/goroutines:goroutines", "/memory/classes/total:bytes"}},
+		{" , ", []string{"/gc/heap/goal:bytes", "/sched/goroutines:goroutines", "/memory/classes/total:bytes"}},
+		{"gc", []string{"/gc/heap/goal:bytes"}},
+		{"sched, memory", []string{"/sched/goroutines:goroutines", "/memory/classes/total:bytes"}},
+		{":bytes,heap", []string{"/gc/heap/goal:bytes", "/memory/classes/total:bytes"}},
+		{"mutex", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, desc := range filterMetrics(descs, tt.filter) {
+			got = append(got, desc.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("filterMetrics(%q) = %q, want %q", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestFormatMetricNumber(t *testing.T) {
+	tests := []struct {
+		v    float64
+		name string
+		want string
+	}{
+		{1536, "/memory/classes/heap/objects:bytes", "1.50KB"},
+		{math.MaxInt64, "/gc/gomemlimit:bytes", "unlimited"},
+		{0.0015, "/gc/pauses:seconds", "1.5ms"},
+		{1.23456, "/cpu/classes/gc/total:cpu-seconds", "1.235s"},
+		{42, "/sched/goroutines:goroutines", "42 goroutines"},
+		{0.5, "/sync/mutex/wait/total:percent", "0.500 percent"},
+	}
+	for _, tt := range tests {
+		if got := formatMetricNumber(tt.v, tt.name); got != tt.want {
+			t.Errorf("formatMetricNumber(%g, %q) = %q, want %q", tt.v, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatHistogram(t *testing.T) {
+	buckets := []float64{0, 1, 2, 4, math.Inf(1)}
+	tests := []struct {
+		name string
+		h    *metrics.Float64Histogram
+		want string
+	}{
+		{
+			name: "empty",
+			h:    &metrics.Float64Histogram{Counts: []uint64{0, 0, 0, 0}, Buckets: buckets},
+			want: "no observations",
+		},
+		{
+			name: "percentiles",
+			h:    &metrics.Float64Histogram{Counts: []uint64{5, 3, 1, 1}, Buckets: buckets},
+			want: "count=10, p50=1s, p90=4s, p99=4s, max=4s",
+		},
+		{
+			name: "interval",
+			h: subtractHistogram(
+				&metrics.Float64Histogram{Counts: []uint64{5, 3, 1, 1}, Buckets: buckets},
+				&metrics.Float64Histogram{Counts: []uint64{2, 3, 1, 0}, Buckets: buckets},
+			),
+			want: "count=4, p50=1s, p90=4s, p99=4s, max=4s",
+		},
+	}
+	for _, tt := range tests {
+		if got := formatHistogram(tt.h, "/sched/latencies:seconds"); got != tt.want {
+			t.Errorf("%s: formatHistogram() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRuntimeMetricsHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		contains  []string
+		wantErr   string
+	}{
+		{
+			name:      "filtered",
+			arguments: map[string]interface{}{"filter": "/sched/goroutines:goroutines"},
+			contains:  []string{"Runtime metrics (1)\n\n/sched/goroutines:goroutines: "},
+		},
+		{
+			name:      "interval",
+			arguments: map[string]interface{}{"filter": "/gc/cycles/total:gc-cycles", "interval": 0.01},
+			contains:  []string{"Runtime metrics over 10ms (1)", "/gc/cycles/total:gc-cycles: ", "gc-cycles/s ("},
+		},
+		{
+			name:      "no match",
+			arguments: map[string]interface{}{"filter": "no-such-metric"},
+			wantErr:   `no runtime metrics match "no-such-metric"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request mcp.CallToolRequest
+			request.Params.Arguments = tt.arguments
+			result, err := RuntimeMetricsHandler(context.Background(), request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := resultText(result)
+			if tt.wantErr != "" {
+				if !result.IsError || !strings.Contains(out, tt.wantErr) {
+					t.Fatalf("result = %q, want error %q", out, tt.wantErr)
+				}
+				return
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(out, s) {
+					t.Errorf("result does not contain %q:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
@@ -2,7 +2,10 @@ package pprofmcpagent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"os"
 	"time"
 
 	"github.com/mark3labs/mcp-go/server"
@@ -14,6 +17,7 @@ import (
 // Parameters:
 //   - ctx: Context for controlling the server lifecycle
 //   - port: Port number to listen on (e.g., ":8080")
+//   - opts: Options configuring the server (see NewPprofServer)
 //
 // Returns:
 //   - error: Any error that occurred during server startup or operation
@@ -25,14 +29,19 @@ import (
 //	if err := ServeSSE(ctx, ":8080"); err != nil {
 //	    log.Fatal(err)
 //	}
-func ServeSSE(ctx context.Context, port string) error {
-	s := NewPprofServer()
+func ServeSSE(ctx context.Context, port string, opts ...Option) error {
+	s, a := newPprofServer(newConfig(append([]Option{WithContext(ctx)}, opts...)...))
+	if a.configErr != nil {
+		return a.configErr
+	}
 
 	// Configure SSE server with enhanced settings
 	sses := server.NewSSEServer(s,
 		server.WithBaseURL(
 			fmt.Sprintf("http://localhost%s", port),
 		),
+		// Authenticate clients for per-identity policies.
+		server.WithSSEContextFunc(a.authenticate),
 	)
 
 	// Setup graceful shutdown
@@ -49,3 +58,27 @@ func ServeSSE(ctx context.Context, port string) error {
 
 	return nil
 }
+
+// ServeStdio serves the pprof MCP server over standard input and output,
+// which is how MCP clients usually launch local tool binaries.
+// The server runs until the provided context is cancelled or stdin is closed.
+//
+// Example:
+//
+//	if err := ServeStdio(ctx, WithRemoteTarget("http://localhost:6060")); err != nil {
+//	    log.Fatal(err)
+//	}
+func ServeStdio(ctx context.Context, opts ...Option) error {
+	s, a := newPprofServer(newConfig(append([]Option{WithContext(ctx)}, opts...)...))
+	if a.configErr != nil {
+		return a.configErr
+	}
+
+	stdio := server.NewStdioServer(s)
+	stdio.SetErrorLogger(log.New(os.Stderr, "", log.LstdFlags))
+	if err := stdio.Listen(ctx, os.Stdin, os.Stdout); err != nil && !errors.Is(err, context.Canceled) {
+		return fmt.Errorf("server error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/google/uuid"
+)
+
+// snapshotFileExt is the file extension used for snapshots persisted on disk.
+const snapshotFileExt = ".pb.gz"
+
+// Snapshot is a profile captured by a tool call and kept for later reference.
+type Snapshot struct {
+	ID          string
+	ProfileType string
+	CreatedAt   time.Time
+	Size        int
+
+	data []byte
+	// file is the name of the file a baseline is persisted to, relative to the store directory.
+	file string
+}
+
+// Profile parses the snapshot's gzipped protobuf data.
+func (s *Snapshot) Profile() (*profile.Profile, error) {
+	return profile.Parse(bytes.NewReader(s.data))
+}
+
+// snapshotStore keeps recently captured profiles in memory, and optionally on disk,
+// bounded by number of snapshots and total bytes.
+type snapshotStore struct {
+	mu        sync.Mutex
+	snapshots []*Snapshot // ordered from oldest to newest
+	bytes     int64
+
+	maxCount int
+	maxBytes int64
+	dir      string
+	// redactor redacts snapshots loaded from dir, which may predate the redaction rules.
+	redactor *redactor
+}
+
+// newSnapshotStore creates a snapshot store. If dir is not empty, snapshots are
+// persisted there and existing snapshot files are loaded and redacted with r.
+func newSnapshotStore(maxCount int, maxBytes int64, dir string, r *redactor) *snapshotStore {
+	s := &snapshotStore{
+		maxCount: maxCount,
+		maxBytes: maxBytes,
+		dir:      dir,
+		redactor: r,
+	}
+	if dir != "" {
+		if err := s.load(); err != nil {
+			log.Printf("snapshot store: %v", err)
+		}
+	}
+	return s
+}
+
+// load reads existing snapshot files from the store directory.
+func (s *snapshotStore) load() error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot directory: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, snapshotFileExt) {
+			continue
+		}
+		id := strings.TrimSuffix(name, snapshotFileExt)
+		profileType, ok := snapshotProfileType(id)
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			log.Printf("snapshot store: failed to read %s: %v", name, err)
+			continue
+		}
+		if data, err = s.redactor.data(data); err != nil {
+			log.Printf("snapshot store: skipping %s: %v", name, err)
+			continue
+		}
+		s.snapshots = append(s.snapshots, &Snapshot{
+			ID:          id,
+			ProfileType: profileType,
+			CreatedAt:   info.ModTime(),
+			Size:        len(data),
+			data:        data,
+		})
+		s.bytes += int64(len(data))
+	}
+	sort.Slice(s.snapshots, func(i, j int) bool {
+		return s.snapshots[i].CreatedAt.Before(s.snapshots[j].CreatedAt)
+	})
+	s.evictLocked()
+	return nil
+}
+
+// Add stores gzipped protobuf profile data and returns the new snapshot.
+func (s *snapshotStore) Add(profileType string, data []byte) *Snapshot {
+	snap := &Snapshot{
+		ID:          fmt.Sprintf("%s-%s", snapshotIDPrefix(profileType), uuid.NewString()[:8]),
+		ProfileType: profileType,
+		CreatedAt:   time.Now(),
+		Size:        len(data),
+		data:        data,
+	}
+
+	if s.dir != "" {
+		path := filepath.Join(s.dir, snap.ID+snapshotFileExt)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			log.Printf("snapshot store: failed to persist %s: %v", snap.ID, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots = append(s.snapshots, snap)
+	s.bytes += int64(snap.Size)
+	s.evictLocked()
+	return snap
+}
+
+// Get returns the snapshot with the given ID.
+func (s *snapshotStore) Get(id string) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, snap := range s.snapshots {
+		if snap.ID == id {
+			return snap, nil
+		}
+	}
+	return nil, fmt.Errorf("snapshot %q not found", id)
+}
+
+// List returns the stored snapshots from newest to oldest,
+// optionally filtered by profile type.
+func (s *snapshotStore) List(profileType string) []*Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []*Snapshot
+	for i := len(s.snapshots) - 1; i >= 0; i-- {
+		snap := s.snapshots[i]
+		if profileType != "" && snap.ProfileType != profileType {
+			continue
+		}
+		result = append(result, snap)
+	}
+	return result
+}
+
+// evictLocked removes the oldest snapshots until the retention bounds are met.
+// The newest snapshot is always kept. s.mu must be held.
+func (s *snapshotStore) evictLocked() {
+	for len(s.snapshots) > 1 &&
+		((s.maxCount > 0 && len(s.snapshots) > s.maxCount) ||
+			(s.maxBytes > 0 && s.bytes > s.maxBytes)) {
+		oldest := s.snapshots[0]
+		s.snapshots = s.snapshots[1:]
+		s.bytes -= int64(oldest.Size)
+		if s.dir != "" {
+			if err := os.Remove(filepath.Join(s.dir, oldest.ID+snapshotFileExt)); err != nil && !os.IsNotExist(err) {
+				log.Printf("snapshot store: failed to remove %s: %v", oldest.ID, err)
+			}
+		}
+	}
+}
+
+// snapshotIDPrefix makes a profile name safe to use in snapshot IDs and file names.
+// Custom profiles registered with pprof.NewProfile may use arbitrary names, so bytes
+// other than letters, digits, '.', '_' and '-' are percent-encoded; snapshotProfileType
+// decodes the name again.
+func snapshotIDPrefix(profileType string) string {
+	var b strings.Builder
+	for i := 0; i < len(profileType); i++ {
+		c := profileType[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// snapshotProfileType returns the profile type of a snapshot ID made by Add.
+func snapshotProfileType(id string) (string, bool) {
+	prefix, _, ok := cutLast(id, "-")
+	if !ok {
+		return "", false
+	}
+	profileType, err := url.PathUnescape(prefix)
+	if err != nil {
+		return "", false
+	}
+	return profileType, true
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,113 @@
+package pprofmcpagent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotIDProfileType(t *testing.T) {
+	tests := []struct {
+		profileType string
+		prefix      string
+	}{
+		{ProfileTypeHeap, "heap"},
+		{"open-conns", "open-conns"},
+		{"open_conns", "open_conns"},
+		{"pool/leased buffers", "pool%2Fleased%20buffers"},
+		{"100%", "100%25"},
+		{"größe", "gr%C3%B6%C3%9Fe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profileType, func(t *testing.T) {
+			if got := snapshotIDPrefix(tt.profileType); got != tt.prefix {
+				t.Errorf("snapshotIDPrefix(%q) = %q, want %q", tt.profileType, got, tt.prefix)
+			}
+			snap := newSnapshotStore(10, 0, "", nil).Add(tt.profileType, []byte("data"))
+			if !strings.HasPrefix(snap.ID, tt.prefix+"-") {
+				t.Errorf("ID %q does not start with %q", snap.ID, tt.prefix+"-")
+			}
+			if got, ok := snapshotProfileType(snap.ID); !ok || got != tt.profileType {
+				t.Errorf("snapshotProfileType(%q) = %q, %v; want %q", snap.ID, got, ok, tt.profileType)
+			}
+		})
+	}
+
+	for _, id := range []string{"heap", "bad%zz-01234567"} {
+		if got, ok := snapshotProfileType(id); ok {
+			t.Errorf("snapshotProfileType(%q) = %q, want no type", id, got)
+		}
+	}
+}
+
+func TestSnapshotStoreEviction(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxCount int
+		maxBytes int64
+		sizes    []int
+		want     []int // indexes of the kept snapshots, newest first
+	}{
+		{name: "unbounded", sizes: []int{10, 10, 10}, want: []int{2, 1, 0}},
+		{name: "count", maxCount: 2, sizes: []int{10, 10, 10}, want: []int{2, 1}},
+		{name: "bytes", maxBytes: 25, sizes: []int{10, 10, 10}, want: []int{2, 1}},
+		{name: "count and bytes", maxCount: 3, maxBytes: 15, sizes: []int{5, 5, 5, 10}, want: []int{3, 2}},
+		{name: "newest is kept", maxBytes: 5, sizes: []int{1, 100}, want: []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSnapshotStore(tt.maxCount, tt.maxBytes, "", nil)
+			var ids []string
+			for _, size := range tt.sizes {
+				ids = append(ids, s.Add(ProfileTypeHeap, make([]byte, size)).ID)
+			}
+			var want, got []string
+			for _, i := range tt.want {
+				want = append(want, ids[i])
+			}
+			for _, snap := range s.List("") {
+				got = append(got, snap.ID)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("kept %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSnapshotStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	s := newSnapshotStore(3, 0, dir, nil)
+	var ids []string
+	for i, profileType := range []string{ProfileTypeHeap, "open-conns", ProfileTypeCPU, "open-conns"} {
+		snap := s.Add(profileType, []byte("data"))
+		// Snapshots are reloaded in the order of their modification times.
+		mtime := time.Now().Add(time.Duration(i-10) * time.Minute)
+		if err := os.Chtimes(filepath.Join(dir, snap.ID+snapshotFileExt), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, snap.ID)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ids[0]+snapshotFileExt)); !os.IsNotExist(err) {
+		t.Errorf("evicted snapshot file still exists: %v", err)
+	}
+
+	reloaded := newSnapshotStore(2, 0, dir, nil)
+	var got []string
+	for _, snap := range reloaded.List("") {
+		got = append(got, snap.ID)
+	}
+	if want := []string{ids[3], ids[2]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reloaded %v, want %v", got, want)
+	}
+	snaps := reloaded.List("open-conns")
+	if len(snaps) != 1 || snaps[0].ID != ids[3] || snaps[0].ProfileType != "open-conns" {
+		t.Errorf("open-conns snapshots = %+v, want %s", snaps, ids[3])
+	}
+	if _, err := reloaded.Get(ids[1]); err == nil {
+		t.Errorf("snapshot %s evicted on reload is still found", ids[1])
+	}
+}
@@ -0,0 +1,88 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime/pprof"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// profileSource collects profiles and execution traces, either from the
+// current process or from a remote process.
+type profileSource interface {
+	// Profile returns the named profile as gzipped protobuf data.
+	// CPU profiles are sampled for d; progress is reported for the request.
+	Profile(ctx context.Context, request mcp.CallToolRequest, name string, d time.Duration) ([]byte, error)
+	// Trace captures an execution trace for d.
+	Trace(ctx context.Context, request mcp.CallToolRequest, d time.Duration) ([]byte, error)
+	// Profiles lists the available profiles.
+	Profiles(ctx context.Context) ([]profileInfo, error)
+	// GoroutineDump returns the stacks of all goroutines in the text format of
+	// the goroutine profile with debug=2 (the format of a panic or SIGQUIT dump).
+	GoroutineDump(ctx context.Context) ([]byte, error)
+}
+
+// profileInfo describes an available profile.
+type profileInfo struct {
+	Name  string
+	Count int
+}
+
+// localSource collects profiles from the current process through runtime/pprof.
+// CPU profiles are captured through cpu, which is shared with all other captures in the process.
+type localSource struct {
+	cpu *cpuProfiler
+}
+
+func (s localSource) Profile(ctx context.Context, request mcp.CallToolRequest, name string, d time.Duration) ([]byte, error) {
+	if name == ProfileTypeCPU {
+		return s.cpu.capture(ctx, request, d)
+	}
+	return lookupProfile(name)
+}
+
+func (localSource) Trace(ctx context.Context, request mcp.CallToolRequest, d time.Duration) ([]byte, error) {
+	return captureTrace(ctx, request, d)
+}
+
+func (localSource) Profiles(ctx context.Context) ([]profileInfo, error) {
+	var result []profileInfo
+	for _, prof := range pprof.Profiles() {
+		result = append(result, profileInfo{Name: prof.Name(), Count: prof.Count()})
+	}
+	return result, nil
+}
+
+func (localSource) GoroutineDump(ctx context.Context) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup(ProfileTypeGoroutine).WriteTo(&buf, 2); err != nil {
+		return nil, &ProfileError{ProfileType: ProfileTypeGoroutine, Err: err}
+	}
+	return buf.Bytes(), nil
+}
+
+// errNoTarget is returned by noProcessSource.
+var errNoTarget = errors.New("no target selected; pass target or targets")
+
+// noProcessSource is the source of servers created with WithoutLocalProcess.
+// It fails every capture, so tools profile only the targets selected in the request.
+type noProcessSource struct{}
+
+func (noProcessSource) Profile(ctx context.Context, request mcp.CallToolRequest, name string, d time.Duration) ([]byte, error) {
+	return nil, &ProfileError{ProfileType: name, Err: errNoTarget}
+}
+
+func (noProcessSource) Trace(ctx context.Context, request mcp.CallToolRequest, d time.Duration) ([]byte, error) {
+	return nil, &ProfileError{ProfileType: ProfileTypeTrace, Err: errNoTarget}
+}
+
+func (noProcessSource) Profiles(ctx context.Context) ([]profileInfo, error) {
+	return nil, errNoTarget
+}
+
+func (noProcessSource) GoroutineDump(ctx context.Context) ([]byte, error) {
+	return nil, &ProfileError{ProfileType: ProfileTypeGoroutine, Err: errNoTarget}
+}
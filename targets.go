@@ -0,0 +1,351 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// targetLabel is the sample label that records which target a merged sample came from.
+const targetLabel = "target"
+
+// Target is a remote process exposing a net/http/pprof endpoint.
+type Target struct {
+	// Name identifies the target in the target and targets tool arguments.
+	Name string `json:"name"`
+	// URL is the server root (http://host:6060) or the /debug/pprof endpoint itself.
+	URL string `json:"url"`
+	// Labels are free-form attributes that can be used to select targets (e.g. "service=api").
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// targetsFile is the format of the file read by WithTargetsFile.
+type targetsFile struct {
+	Targets []Target `json:"targets"`
+}
+
+// WithTargets registers remote targets that tools can profile through their
+// target and targets arguments.
+func WithTargets(targets ...Target) Option {
+	return func(c *config) {
+		c.targets = append(c.targets, targets...)
+	}
+}
+
+// WithTargetsFile registers the remote targets listed in a JSON file of the form
+// {"targets": [{"name": "api-1", "url": "http://10.0.0.1:6060", "labels": {"service": "api"}}]}.
+// The file is read once when the server is created; if it cannot be read or
+// parsed, ServeSSE and ServeStdio return the error.
+func WithTargetsFile(path string) Option {
+	return func(c *config) {
+		c.targetsFile = path
+	}
+}
+
+// WithTargetsDir discovers remote targets from a directory of *.json files, each
+// holding a single target. The directory is re-read on every tool call, so
+// processes can register and unregister themselves by writing and removing files.
+// The file name (without extension) is used when the target has no name.
+func WithTargetsDir(dir string) Option {
+	return func(c *config) {
+		c.targetsDir = dir
+	}
+}
+
+// targetRegistry resolves the targets configured statically and discovered in a directory.
+type targetRegistry struct {
+	static []Target
+	dir    string
+}
+
+// newTargetRegistry creates a registry from the targets configuration,
+// or returns nil when no targets are configured.
+func newTargetRegistry(cfg *config) (*targetRegistry, error) {
+	if len(cfg.targets) == 0 && cfg.targetsFile == "" && cfg.targetsDir == "" {
+		return nil, nil
+	}
+	r := &targetRegistry{
+		static: append([]Target(nil), cfg.targets...),
+		dir:    cfg.targetsDir,
+	}
+	if cfg.targetsFile != "" {
+		data, err := os.ReadFile(cfg.targetsFile)
+		if err != nil {
+			return r, fmt.Errorf("failed to read targets file: %w", err)
+		}
+		var file targetsFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return r, fmt.Errorf("failed to parse targets file %s: %w", cfg.targetsFile, err)
+		}
+		r.static = append(r.static, file.Targets...)
+	}
+	return r, nil
+}
+
+// List returns all known targets sorted by name. Discovered targets
+// do not replace static targets of the same name.
+func (r *targetRegistry) List() ([]Target, error) {
+	seen := make(map[string]bool)
+	var result []Target
+	for _, t := range r.static {
+		if t.Name == "" || t.URL == "" || seen[t.Name] {
+			continue
+		}
+		seen[t.Name] = true
+		result = append(result, t)
+	}
+
+	if r.dir != "" {
+		files, err := filepath.Glob(filepath.Join(r.dir, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list targets directory: %w", err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				// The file may have been removed since it was listed.
+				continue
+			}
+			var t Target
+			if err := json.Unmarshal(data, &t); err != nil {
+				continue
+			}
+			if t.Name == "" {
+				t.Name = strings.TrimSuffix(filepath.Base(file), ".json")
+			}
+			if t.URL == "" || seen[t.Name] {
+				continue
+			}
+			seen[t.Name] = true
+			result = append(result, t)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Resolve returns the targets matching any of the selectors. A selector is a
+// target name, a name pattern such as "api-*", or a label selector such as "service=api".
+func (r *targetRegistry) Resolve(selectors []string) ([]Target, error) {
+	all, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Target
+	for _, t := range all {
+		for _, sel := range selectors {
+			if t.matches(sel) {
+				result = append(result, t)
+				break
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no targets match %s", strings.Join(selectors, ", "))
+	}
+	return result, nil
+}
+
+// matches reports whether the target matches a name, name pattern or label selector.
+func (t Target) matches(selector string) bool {
+	if key, value, ok := strings.Cut(selector, "="); ok {
+		v, exists := t.Labels[key]
+		return exists && v == value
+	}
+	ok, err := path.Match(selector, t.Name)
+	return ok && err == nil
+}
+
+// requestTargets resolves the target and targets request parameters.
+// It returns nil when neither is given, meaning the agent's own profile source is used.
+func (a *agent) requestTargets(request mcp.CallToolRequest) ([]Target, error) {
+	var selectors []string
+	if target, ok := request.Params.Arguments["target"].(string); ok && target != "" {
+		selectors = append(selectors, target)
+	}
+	selectors = append(selectors, stringsParam(request, "targets")...)
+	if len(selectors) == 0 {
+		return nil, nil
+	}
+	if a.targets == nil {
+		return nil, fmt.Errorf("no targets are configured")
+	}
+	return a.targets.Resolve(selectors)
+}
+
+// sourceFor returns the profile source for tools that work on a single process:
+// the selected target, or the agent's own source when no target is given.
+func (a *agent) sourceFor(request mcp.CallToolRequest) (profileSource, error) {
+	targets, err := a.requestTargets(request)
+	if err != nil {
+		return nil, err
+	}
+	switch len(targets) {
+	case 0:
+		return a.source, nil
+	case 1:
+		return a.redactor.source(newRemoteSource(targets[0].URL, a.httpClient)), nil
+	default:
+		return nil, fmt.Errorf("this tool works on a single target, but %d targets were selected", len(targets))
+	}
+}
+
+// fetchTargets collects the named profile from all targets in parallel.
+// Progress is reported for the first target only, as all targets are sampled concurrently.
+// It returns the targets that succeeded with their profiles, and an error line per
+// target that failed. It fails only if no target succeeded.
+func (a *agent) fetchTargets(ctx context.Context, request mcp.CallToolRequest, targets []Target, profileName string, d time.Duration) ([]Target, [][]byte, []string, error) {
+	results := make([][]byte, len(targets))
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		req := request
+		if i > 0 {
+			req = mcp.CallToolRequest{}
+		}
+		wg.Add(1)
+		go func(i int, t Target, req mcp.CallToolRequest) {
+			defer wg.Done()
+			results[i], errs[i] = a.redactor.source(newRemoteSource(t.URL, a.httpClient)).Profile(ctx, req, profileName, d)
+		}(i, t, req)
+	}
+	wg.Wait()
+
+	var fetched []Target
+	var data [][]byte
+	var failures []string
+	for i, err := range errs {
+		if err != nil {
+			// The profile type is named once by the caller.
+			var pe *ProfileError
+			if errors.As(err, &pe) {
+				err = pe.Err
+			}
+			failures = append(failures, fmt.Sprintf("target %s: %v", targets[i].Name, err))
+			continue
+		}
+		fetched = append(fetched, targets[i])
+		data = append(data, results[i])
+	}
+	if len(fetched) == 0 {
+		return nil, nil, nil, &ProfileError{
+			ProfileType: profileName,
+			Err:         errors.New(strings.Join(failures, "; ")),
+		}
+	}
+	return fetched, data, failures, nil
+}
+
+// targetFailures renders the error lines of targets whose profiles could not be collected.
+func targetFailures(failures []string) mcp.Content {
+	return mcp.NewTextContent(fmt.Sprintf("Failed targets (%d), not included:\n%s", len(failures), strings.Join(failures, "\n")))
+}
+
+// mergeTargetProfiles merges the profiles collected from several targets into one
+// gzipped protobuf profile. Each sample is labeled with the target it came from.
+func mergeTargetProfiles(profileName string, targets []Target, data [][]byte) ([]byte, error) {
+	profiles := make([]*profile.Profile, len(data))
+	for i, d := range data {
+		p, err := profile.ParseData(d)
+		if err != nil {
+			return nil, &ProfileError{
+				ProfileType: profileName,
+				Err:         fmt.Errorf("failed to parse profile of target %s: %w", targets[i].Name, err),
+			}
+		}
+		p.SetLabel(targetLabel, []string{targets[i].Name})
+		profiles[i] = p
+	}
+
+	merged, err := profile.Merge(profiles)
+	if err != nil {
+		return nil, &ProfileError{
+			ProfileType: profileName,
+			Err:         fmt.Errorf("failed to merge profiles: %w", err),
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := merged.Write(&buf); err != nil {
+		return nil, &ProfileError{
+			ProfileType: profileName,
+			Err:         fmt.Errorf("failed to write merged profile: %w", err),
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// renderTargetBreakdown renders the profiles of several targets one after another
+// instead of merging them. Each profile is stored as its own snapshot.
+func renderTargetBreakdown(ctx context.Context, profileName string, targets []Target, data [][]byte, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	result := &mcp.CallToolResult{}
+	for i, t := range targets {
+		r, err := renderSnapshot(ctx, profileName, data[i], request)
+		if err != nil {
+			return nil, err
+		}
+		result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("== Target: %s (%s) ==", t.Name, t.URL)))
+		result.Content = append(result.Content, r.Content...)
+	}
+	return result, nil
+}
+
+// targetNames returns the names of the targets, for display.
+func targetNames(targets []Target) string {
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = t.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// ListTargetsHandler lists the configured and discovered remote targets.
+func ListTargetsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	a := agentFromContext(ctx)
+	if a.targets == nil {
+		return handleMCPError(fmt.Errorf("no targets are configured")), nil
+	}
+	targets, err := a.targets.List()
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Targets (%d)\n\n", len(targets)))
+	for _, t := range targets {
+		result.WriteString(fmt.Sprintf("%s: %s", t.Name, t.URL))
+		if len(t.Labels) > 0 {
+			keys := make([]string, 0, len(t.Labels))
+			for k := range t.Labels {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			labels := make([]string, len(keys))
+			for i, k := range keys {
+				labels[i] = k + "=" + t.Labels[k]
+			}
+			result.WriteString(fmt.Sprintf(" [%s]", strings.Join(labels, ", ")))
+		}
+		result.WriteString("\n")
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(result.String()),
+		},
+	}, nil
+}
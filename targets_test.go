@@ -0,0 +1,166 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// pprofTestServer serves a heap profile with one function at /debug/pprof/heap,
+// or fails every request if fn is empty.
+func pprofTestServer(t *testing.T, fn string) *httptest.Server {
+	t.Helper()
+	var buf bytes.Buffer
+	if fn != "" {
+		if err := heapProfile(map[string]int64{fn: 10}).Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fn == "" || r.URL.Path != "/debug/pprof/heap" {
+			http.Error(w, "profiling disabled", http.StatusInternalServerError)
+			return
+		}
+		w.Write(buf.Bytes())
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFanOutPartialFailure(t *testing.T) {
+	targets := []Target{
+		{Name: "api-1", URL: pprofTestServer(t, "main.one").URL},
+		{Name: "api-2", URL: pprofTestServer(t, "main.two").URL},
+		{Name: "api-3", URL: pprofTestServer(t, "").URL},
+		{Name: "down-1", URL: pprofTestServer(t, "").URL},
+	}
+	_, a := newPprofServer(newConfig(WithTargets(targets...)))
+	ctx := context.WithValue(context.Background(), agentKey{}, a)
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		contains  []string
+		absent    []string
+		wantErr   string
+	}{
+		{
+			name:      "merged",
+			arguments: map[string]interface{}{"targets": []interface{}{"api-*"}},
+			contains: []string{
+				"Failed targets (1), not included:\ntarget api-3: ",
+				"Merged profile of 2 of 3 targets: api-1, api-2",
+				"main.one", "main.two",
+			},
+		},
+		{
+			name:      "breakdown",
+			arguments: map[string]interface{}{"targets": []interface{}{"api-*"}, "breakdown": true},
+			contains:  []string{"target api-3: ", "== Target: api-1", "== Target: api-2"},
+			absent:    []string{"== Target: api-3"},
+		},
+		{
+			name:      "all succeed",
+			arguments: map[string]interface{}{"targets": []interface{}{"api-1", "api-2"}},
+			contains:  []string{"Merged profile of 2 targets: api-1, api-2"},
+			absent:    []string{"Failed targets"},
+		},
+		{
+			name:      "all fail",
+			arguments: map[string]interface{}{"targets": []interface{}{"api-3", "down-*"}},
+			wantErr:   "target api-3: failed to fetch",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request mcp.CallToolRequest
+			request.Params.Arguments = tt.arguments
+			result, err := HeapHandler(ctx, request)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), "target down-1") {
+					t.Fatalf("error = %v, want the errors of all targets", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := resultText(result)
+			for _, s := range tt.contains {
+				if !strings.Contains(out, s) {
+					t.Errorf("result does not contain %q:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.absent {
+				if strings.Contains(out, s) {
+					t.Errorf("result contains %q:\n%s", s, out)
+				}
+			}
+		})
+	}
+
+	t.Run("comparisons need every target", func(t *testing.T) {
+		var request mcp.CallToolRequest
+		request.Params.Arguments = map[string]interface{}{"targets": []interface{}{"api-*"}}
+		if _, err := collectProfile(ctx, ProfileTypeHeap, request); err == nil || !strings.Contains(err.Error(), "target api-3") {
+			t.Fatalf("collectProfile error = %v, want the failure of api-3", err)
+		}
+	})
+}
+
+func TestWithoutLocalProcess(t *testing.T) {
+	target := Target{Name: "api-1", URL: pprofTestServer(t, "main.one").URL}
+	_, a := newPprofServer(newConfig(WithoutLocalProcess(), WithTargets(target)))
+	ctx := context.WithValue(context.Background(), agentKey{}, a)
+
+	for _, name := range []string{"runtime-metrics", "memstats"} {
+		if _, ok := a.tools[name]; ok {
+			t.Errorf("%s is registered without a local process", name)
+		}
+	}
+
+	var request mcp.CallToolRequest
+	if _, err := HeapHandler(ctx, request); err == nil || !strings.Contains(err.Error(), "no target selected; pass target or targets") {
+		t.Errorf("heap-profile without a target: error = %v, want no target selected", err)
+	}
+	request.Params.Arguments = map[string]interface{}{"duration": 0.05}
+	if result, _ := ExecutionTraceHandler(ctx, request); !result.IsError || !strings.Contains(resultText(result), "no target selected") {
+		t.Errorf("execution-trace without a target: result = %q, want no target selected", resultText(result))
+	}
+
+	request.Params.Arguments = map[string]interface{}{"target": "api-1"}
+	result, err := HeapHandler(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := resultText(result); !strings.Contains(out, "main.one") {
+		t.Errorf("heap-profile of api-1 does not contain main.one:\n%s", out)
+	}
+}
+
+func TestServeStdioRejectsInvalidTargetsFile(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "targets.json")
+	if err := os.WriteFile(invalid, []byte(`{"targets": [`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path    string
+		wantErr string
+	}{
+		{filepath.Join(dir, "missing.json"), "failed to read targets file"},
+		{invalid, "failed to parse targets file " + invalid},
+	}
+	for _, tt := range tests {
+		if err := ServeStdio(context.Background(), WithTargetsFile(tt.path)); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ServeStdio with targets file %s: error = %v, want %q", tt.path, err, tt.wantErr)
+		}
+	}
+}
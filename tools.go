@@ -1,6 +1,8 @@
 package pprofmcpagent
 
 import (
+	"strings"
+
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
@@ -23,21 +25,114 @@ import (
 // - Flat: direct values for each function
 // - Cumulative: including child function costs
 // - Graph: showing call relationships
-func NewPprofServer() *server.MCPServer {
+//
+// Guided investigation prompts (memory leak, CPU hotspot, lock contention)
+// are registered as well.
+//
+// Every collected profile is kept in a bounded snapshot store so it can be
+// referred to later by its snapshot ID. The store can be configured with Options.
+// When continuous profiling or triggers are enabled, tools to query their captures are added.
+// With WithRemoteTarget, profiles are fetched from a remote net/http/pprof endpoint.
+// With WithTargets, WithTargetsFile or WithTargetsDir, tools can profile a fleet of
+// remote targets selected by their target and targets arguments.
+// With WithProfileDir, profile files in a local directory can be analyzed offline.
+// Named baselines are kept in memory, or on disk with WithBaselineDir.
+// With WithModuleDir, benchmarks of a local Go module can be run, profiled and compared.
+// With WithRuntimeControl, tools to change runtime settings and force GCs are added.
+// With WithPolicies, tool calls are restricted per authenticated identity.
+func NewPprofServer(opts ...Option) *server.MCPServer {
+	s, _ := newPprofServer(newConfig(opts...))
+	return s
+}
+
+// newPprofServer creates the MCP server and the agent state shared by its handlers.
+func newPprofServer(cfg *config) (*server.MCPServer, *agent) {
+	a := newAgent(cfg)
+
 	s := server.NewMCPServer(
 		"pprof server",
 		"1.0.0",
+		server.WithToolHandlerMiddleware(a.middleware),
 	)
 
+	// Tools are recorded so policies can check their argument defaults.
+	add := func(tool mcp.Tool, handler server.ToolHandlerFunc) {
+		a.tools[tool.Name] = tool
+		s.AddTool(tool, handler)
+	}
+
+	// Tools that collect profiles accept target arguments when targets are configured.
+	fanOut := func(tool mcp.Tool) mcp.Tool {
+		if a.targets != nil {
+			return withTargetParams(tool, true)
+		}
+		return tool
+	}
+	single := func(tool mcp.Tool) mcp.Tool {
+		if a.targets != nil {
+			return withTargetParams(tool, false)
+		}
+		return tool
+	}
+
 	// Add tools
-	s.AddTool(NewHeapTool(), HeapHandler)
-	s.AddTool(NewGoroutineTool(), GoroutineHandler)
-	s.AddTool(NewThreadCreateTool(), ThreadCreateHandler)
-	s.AddTool(NewBlockTool(), BlockHandler)
-	s.AddTool(NewAllocsTool(), AllocsHandler)
-	s.AddTool(NewCPUTool(), CPUHandler)
+	add(fanOut(NewHeapTool()), HeapHandler)
+	add(fanOut(NewGoroutineTool()), GoroutineHandler)
+	add(fanOut(NewThreadCreateTool()), ThreadCreateHandler)
+	add(fanOut(NewBlockTool()), BlockHandler)
+	add(fanOut(NewAllocsTool()), AllocsHandler)
+	add(fanOut(NewCPUTool()), CPUHandler)
+	add(fanOut(NewNamedProfileTool()), NamedProfileHandler)
+	add(single(NewListProfilesTool()), ListProfilesHandler)
+	add(NewListSnapshotsTool(), ListSnapshotsHandler)
+	add(NewGetSnapshotTool(), GetSnapshotHandler)
+	add(fanOut(NewDiffProfilesTool()), DiffProfilesHandler)
+	add(NewMergeProfilesTool(), MergeProfilesHandler)
+	add(fanOut(NewSaveBaselineTool()), SaveBaselineHandler)
+	add(NewListBaselinesTool(), ListBaselinesHandler)
+	add(fanOut(NewCheckRegressionTool()), CheckRegressionHandler)
+	add(fanOut(NewAnalyzeTool()), AnalyzeHandler)
+	add(single(NewDeadlockTool()), DeadlockHandler)
+	if !a.remote {
+		add(NewRuntimeMetricsTool(), RuntimeMetricsHandler)
+		add(NewMemStatsTool(), MemStatsHandler)
+	}
+	add(single(NewExecutionTraceTool()), ExecutionTraceHandler)
+	if a.targets != nil {
+		add(NewListTargetsTool(), ListTargetsHandler)
+	}
+	if a.files != nil {
+		add(NewListProfileFilesTool(), ListProfileFilesHandler)
+		add(NewOpenProfileFileTool(), OpenProfileFileHandler)
+	}
+	if a.bench != nil {
+		add(NewRunBenchmarkTool(), RunBenchmarkHandler)
+		add(NewListBenchmarkRunsTool(), ListBenchmarkRunsHandler)
+		add(NewCompareBenchmarksTool(), CompareBenchmarksHandler)
+	}
+	if a.continuous != nil {
+		add(NewContinuousProfilesTool(), ContinuousProfilesHandler)
+		add(NewContinuousAggregateTool(), ContinuousAggregateHandler)
+	}
+	if a.triggers != nil {
+		add(NewTriggeredCapturesTool(), TriggeredCapturesHandler)
+	}
+	if a.control != nil {
+		add(NewRuntimeSettingsTool(), RuntimeSettingsHandler)
+		add(NewSetRuntimeSettingTool(), SetRuntimeSettingHandler)
+		add(NewForceGCTool(), ForceGCHandler)
+	}
+	add(NewRecentAuditTool(), RecentAuditHandler)
 
-	return s
+	// Add resources
+	s.AddResourceTemplate(NewTraceResourceTemplate(), a.resourceMiddleware("execution-trace", TraceResourceHandler))
+
+	// Add prompts
+	s.AddPrompt(NewInvestigateMemoryLeakPrompt(), InvestigateMemoryLeakPromptHandler)
+	s.AddPrompt(NewFindCPUHotspotPrompt(), FindCPUHotspotPromptHandler)
+	s.AddPrompt(NewDiagnoseLockContentionPrompt(), DiagnoseLockContentionPromptHandler)
+
+	return s, a
 }
 
 // newProfileTool creates a new MCP tool with common profile configuration options.
@@ -51,7 +146,10 @@ func NewPprofServer() *server.MCPServer {
 //
 // Configuration options:
 //   - limit: Number of top locations to show (default: 100, min: 100, max: 10000)
-//   - view: Profile view mode (flat, cum, graph)
+//   - view: Profile view mode (flat, cum, graph, packages)
+//   - trim_names, by_module: Function name trimming and package view grouping
+//   - skip_runtime, skip_packages: Attribution of samples past runtime and library frames
+//   - max_tokens, max_bytes: Output budget the view is trimmed to fit
 func newProfileTool(name, description string, extraOpts ...mcp.ToolOption) mcp.Tool {
 	opts := []mcp.ToolOption{
 		mcp.WithDescription(description),
@@ -64,14 +162,43 @@ func newProfileTool(name, description string, extraOpts ...mcp.ToolOption) mcp.T
 		),
 		mcp.WithString(
 			"view",
-			mcp.Description("View mode for profile data (flat: direct values, cum: cumulative values including children, graph: call graph)"),
+			mcp.Description("View mode for profile data (flat: direct values, cum: cumulative values including children, graph: call graph, packages: values rolled up per package)"),
 			mcp.DefaultString(string(ViewModeFlat)),
 			mcp.Enum(
 				string(ViewModeFlat),
 				string(ViewModeCum),
 				string(ViewModeGraph),
+				string(ViewModePackages),
 			),
 		),
+		mcp.WithBoolean(
+			"trim_names",
+			mcp.Description("Shorten function names: drop import paths, collapse generic type arguments and abbreviate nested closures"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithBoolean(
+			"skip_runtime",
+			mcp.Description("Attribute each sample to its first frame outside of the runtime and standard library (or the packages in skip_packages), e.g. to the caller of runtime.gopark"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithArray(
+			"skip_packages",
+			mcp.Description("Packages skipped by skip_runtime, including their subpackages (default: [\"std\"], the whole standard library)"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithBoolean(
+			"by_module",
+			mcp.Description("In the packages view, roll values up per module instead of per package"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithNumber(
+			"max_tokens",
+			mcp.Description("Approximate output budget in LLM tokens (at least 256); the output is trimmed adaptively to fit and the elided details are noted"),
+		),
+		mcp.WithNumber(
+			"max_bytes",
+			mcp.Description("Output budget in bytes (at least 1024); the output is trimmed adaptively to fit and the elided details are noted"),
+		),
 	}
 	opts = append(opts, extraOpts...)
 	return mcp.NewTool(name, opts...)
@@ -124,3 +251,548 @@ func NewCPUTool() mcp.Tool {
 		),
 	)
 }
+
+// NewNamedProfileTool creates a new MCP tool for any profile registered with runtime/pprof.
+// This tool makes custom profiles created with pprof.NewProfile (open connections,
+// leased buffers, ...) and future runtime profiles available without dedicated tools.
+func NewNamedProfileTool() mcp.Tool {
+	return newProfileTool("named-profile", "Output profile data of any registered runtime/pprof profile, including custom profiles",
+		mcp.WithString(
+			"name",
+			mcp.Description("Profile name as listed by list-profiles (e.g. mutex, or a custom profile name)"),
+			mcp.Required(),
+		),
+		mcp.WithNumber(
+			"duration",
+			mcp.Description("Duration of CPU profiling in seconds when name is cpu"),
+			mcp.DefaultNumber(10),
+		),
+	)
+}
+
+// NewListProfilesTool creates a new MCP tool for listing registered profiles.
+// This tool enumerates pprof.Profiles() with their current sample counts.
+func NewListProfilesTool() mcp.Tool {
+	return mcp.NewTool("list-profiles",
+		mcp.WithDescription("List the profiles registered with runtime/pprof and their current counts"),
+	)
+}
+
+// NewListTargetsTool creates a new MCP tool for listing remote targets.
+// This tool shows the configured and discovered targets that the profile tools
+// can select with their target and targets arguments.
+func NewListTargetsTool() mcp.Tool {
+	return mcp.NewTool("list-targets",
+		mcp.WithDescription("List the remote targets that can be profiled, with their URLs and labels"),
+	)
+}
+
+// NewListProfileFilesTool creates a new MCP tool for listing profile files.
+// This tool enumerates the profile files and goroutine dumps in the configured profile directory.
+func NewListProfileFilesTool() mcp.Tool {
+	return mcp.NewTool("list-profile-files",
+		mcp.WithDescription("List the profile files (.pb.gz, .pprof, ...) and goroutine dumps (.txt) available for offline analysis"),
+	)
+}
+
+// NewOpenProfileFileTool creates a new MCP tool for analyzing a profile file.
+// This tool loads a profile captured elsewhere (e.g. shared by a colleague) and
+// renders it with the same views as a live profile.
+func NewOpenProfileFileTool() mcp.Tool {
+	return newProfileTool("open-profile-file", "Output profile data of a profile file from the profile directory",
+		mcp.WithString(
+			"path",
+			mcp.Description("Path of the profile file relative to the profile directory, as listed by list-profile-files"),
+			mcp.Required(),
+		),
+	)
+}
+
+// withTargetParams adds the target selection parameters to a tool.
+// Tools that can fan out to several targets also get the targets and breakdown parameters.
+func withTargetParams(tool mcp.Tool, fanOut bool) mcp.Tool {
+	opts := []mcp.ToolOption{
+		mcp.WithString(
+			"target",
+			mcp.Description("Name of the remote target to profile, as listed by list-targets (default: the agent's own process or remote target)"),
+		),
+	}
+	if fanOut {
+		opts = append(opts,
+			mcp.WithArray(
+				"targets",
+				mcp.Description("Targets to profile and merge: names, name patterns (e.g. \"api-*\") or label selectors (e.g. \"service=api\")"),
+				mcp.Items(map[string]interface{}{"type": "string"}),
+			),
+			mcp.WithBoolean(
+				"breakdown",
+				mcp.Description("Show each target's profile separately instead of merging them"),
+				mcp.DefaultBool(false),
+			),
+		)
+	}
+	for _, opt := range opts {
+		opt(&tool)
+	}
+	return tool
+}
+
+// NewRunBenchmarkTool creates a new MCP tool for running Go benchmarks.
+// This tool gives evidence for a proposed optimization: it runs the benchmarks
+// of a package with CPU and memory profiling and renders the captured profiles.
+func NewRunBenchmarkTool() mcp.Tool {
+	return newProfileTool("run-benchmark", "Run go test -bench for a package of the module with CPU and memory profiling, "+
+		"summarize the results and output the captured profiles",
+		mcp.WithString(
+			"package",
+			mcp.Description("Package directory relative to the module directory (e.g. ./internal/parser)"),
+			mcp.DefaultString("."),
+		),
+		mcp.WithString(
+			"bench",
+			mcp.Description("Regular expression selecting the benchmarks to run (go test -bench)"),
+			mcp.DefaultString("."),
+		),
+		mcp.WithNumber(
+			"count",
+			mcp.Description("Number of times to run each benchmark; several runs are needed to compare runs"),
+			mcp.DefaultNumber(defaultBenchmarkCount),
+			mcp.Min(1),
+			mcp.Max(maxBenchmarkCount),
+		),
+		mcp.WithString(
+			"benchtime",
+			mcp.Description("Run time or iterations of each benchmark (go test -benchtime, e.g. 2s or 1000x)"),
+		),
+		mcp.WithNumber(
+			"timeout",
+			mcp.Description("Maximum duration of the go test run in seconds"),
+			mcp.DefaultNumber(defaultBenchmarkTimeout.Seconds()),
+			mcp.Max(defaultBenchmarkTimeout.Seconds()),
+		),
+	)
+}
+
+// NewListBenchmarkRunsTool creates a new MCP tool for listing benchmark runs.
+func NewListBenchmarkRunsTool() mcp.Tool {
+	return mcp.NewTool("list-benchmark-runs",
+		mcp.WithDescription("List recent benchmark runs with their package, pattern and profile snapshots"),
+	)
+}
+
+// NewCompareBenchmarksTool creates a new MCP tool for comparing benchmark runs.
+// This tool tells whether a change made benchmarks faster or slower beyond noise.
+func NewCompareBenchmarksTool() mcp.Tool {
+	return mcp.NewTool("compare-benchmarks",
+		mcp.WithDescription("Compare two benchmark runs benchstat-style: means, change and significance (Mann-Whitney U test) per benchmark and unit"),
+		mcp.WithString(
+			"base",
+			mcp.Description("ID of the base benchmark run"),
+			mcp.Required(),
+		),
+		mcp.WithString(
+			"current",
+			mcp.Description("ID of the current benchmark run"),
+			mcp.Required(),
+		),
+	)
+}
+
+// NewListSnapshotsTool creates a new MCP tool for listing stored profile snapshots.
+// Each profile tool call stores its profile as a snapshot; this tool enumerates
+// them with their type, capture time and size.
+func NewListSnapshotsTool() mcp.Tool {
+	return mcp.NewTool("list-snapshots",
+		mcp.WithDescription("List stored profile snapshots with their type, capture time and size"),
+		mcp.WithString(
+			"type",
+			mcp.Description("Only list snapshots of this profile type (e.g. heap, cpu)"),
+		),
+	)
+}
+
+// NewGetSnapshotTool creates a new MCP tool for rendering a stored profile snapshot.
+// This tool lets the agent refer back to a profile captured by an earlier tool call.
+func NewGetSnapshotTool() mcp.Tool {
+	return newProfileTool("get-snapshot", "Output profile data of a stored snapshot",
+		mcp.WithString(
+			"id",
+			mcp.Description("Snapshot ID returned by a previous profile tool call"),
+			mcp.Required(),
+		),
+	)
+}
+
+// NewDiffProfilesTool creates a new MCP tool for comparing two profiles.
+// This tool helps validate fixes and find regressions by showing how values
+// changed between a base snapshot and a current snapshot (or a fresh profile).
+func NewDiffProfilesTool() mcp.Tool {
+	return newProfileTool("diff-profiles", "Output the difference between two profiles of the same type (current minus base)",
+		mcp.WithString(
+			"base",
+			mcp.Description("Snapshot ID of the base profile"),
+			mcp.Required(),
+		),
+		mcp.WithString(
+			"current",
+			mcp.Description("Snapshot ID of the current profile, or \"now\" to collect a fresh profile of the base's type"),
+			mcp.DefaultString("now"),
+		),
+		mcp.WithBoolean(
+			"normalize",
+			mcp.Description("Scale the base profile so its totals match the current profile before diffing"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithNumber(
+			"duration",
+			mcp.Description("Duration of CPU profiling in seconds when current is \"now\" for a CPU profile"),
+			mcp.DefaultNumber(10),
+		),
+	)
+}
+
+// NewMergeProfilesTool creates a new MCP tool for merging profiles.
+// This tool aggregates several snapshots or profile files of the same type,
+// e.g. CPU profiles of several capture windows or replicas, before analysis.
+func NewMergeProfilesTool() mcp.Tool {
+	return newProfileTool("merge-profiles", "Merge several profiles of the same type into one, optionally scaling each",
+		mcp.WithArray(
+			"snapshots",
+			mcp.Description("Snapshot IDs of the profiles to merge"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithArray(
+			"files",
+			mcp.Description("Paths of profile files to merge, relative to the profile directory"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithArray(
+			"scales",
+			mcp.Description("Scale factor for each profile, in the order snapshots then files (default: 1)"),
+			mcp.Items(map[string]interface{}{"type": "number"}),
+		),
+		mcp.WithBoolean(
+			"average",
+			mcp.Description("Divide the merged values by the number of profiles"),
+			mcp.DefaultBool(false),
+		),
+	)
+}
+
+// NewSaveBaselineTool creates a new MCP tool for saving a named baseline profile.
+// This tool records the state before a deploy, so check-regression can later
+// tell whether the deploy made things worse.
+func NewSaveBaselineTool() mcp.Tool {
+	return mcp.NewTool("save-baseline",
+		mcp.WithDescription("Save a stored snapshot or a freshly collected profile as a named baseline for check-regression"),
+		mcp.WithString(
+			"name",
+			mcp.Description("Name of the baseline (letters, digits, '.', '_' and '-'); an existing baseline of the same name is replaced"),
+			mcp.Required(),
+		),
+		mcp.WithString(
+			"snapshot",
+			mcp.Description("Snapshot ID of the profile to save (default: collect a fresh profile)"),
+		),
+		mcp.WithString(
+			"type",
+			mcp.Description("Profile type to collect when no snapshot is given (e.g. cpu, heap, allocs)"),
+			mcp.DefaultString(ProfileTypeCPU),
+		),
+		mcp.WithNumber(
+			"duration",
+			mcp.Description("Duration of CPU profiling in seconds when collecting a CPU profile"),
+			mcp.DefaultNumber(10),
+		),
+	)
+}
+
+// NewRecentAuditTool creates a new MCP tool for listing recent audit entries.
+// This tool shows operators who profiled what and when.
+func NewRecentAuditTool() mcp.Tool {
+	return mcp.NewTool("recent-audit",
+		mcp.WithDescription("List recent tool calls, policy denials and runtime changes with caller identity, "+
+			"arguments, duration, result size and error, newest first"),
+		mcp.WithNumber(
+			"limit",
+			mcp.Description("Maximum number of entries to return"),
+			mcp.DefaultNumber(50),
+			mcp.Min(1),
+			mcp.Max(maxRecentAuditEntries),
+		),
+		mcp.WithString(
+			"identity",
+			mcp.Description("Only entries of this caller identity"),
+		),
+		mcp.WithString(
+			"tool",
+			mcp.Description("Only entries of this tool"),
+		),
+		mcp.WithBoolean(
+			"errors_only",
+			mcp.Description("Only failed calls and policy denials"),
+			mcp.DefaultBool(false),
+		),
+	)
+}
+
+// NewListBaselinesTool creates a new MCP tool for listing saved baselines.
+func NewListBaselinesTool() mcp.Tool {
+	return mcp.NewTool("list-baselines",
+		mcp.WithDescription("List saved baseline profiles with their type, save time and size"),
+	)
+}
+
+// NewCheckRegressionTool creates a new MCP tool for checking a profile against a baseline.
+// This tool answers "did this deploy make things worse?" with a PASS or FAIL verdict
+// and the functions that regressed, suitable for canary gates.
+func NewCheckRegressionTool() mcp.Tool {
+	return mcp.NewTool("check-regression",
+		mcp.WithDescription("Compare a profile against a named baseline and report functions that regressed "+
+			"beyond the thresholds and sampling noise, with a PASS or FAIL verdict"),
+		mcp.WithString(
+			"baseline",
+			mcp.Description("Name of the baseline saved with save-baseline"),
+			mcp.Required(),
+		),
+		mcp.WithString(
+			"current",
+			mcp.Description("Snapshot ID of the current profile, or \"now\" to collect a fresh profile of the baseline's type"),
+			mcp.DefaultString("now"),
+		),
+		mcp.WithNumber(
+			"threshold",
+			mcp.Description("Minimum increase of a function's value over the baseline, in percent"),
+			mcp.DefaultNumber(defaultRegressionThreshold),
+			mcp.Min(0),
+		),
+		mcp.WithNumber(
+			"min_share",
+			mcp.Description("Minimum share of the current profile's total a function must have, in percent"),
+			mcp.DefaultNumber(defaultRegressionMinShare),
+			mcp.Min(0),
+		),
+		mcp.WithNumber(
+			"sigma",
+			mcp.Description("Minimum increase in standard deviations of the sampling noise, estimated from the sample counts of CPU profiles; not tested for other profiles"),
+			mcp.DefaultNumber(defaultRegressionSigma),
+			mcp.Min(0),
+		),
+		mcp.WithBoolean(
+			"cumulative",
+			mcp.Description("Compare cumulative values (including callees) instead of flat values"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithBoolean(
+			"normalize",
+			mcp.Description("Scale the baseline so its total matches the current profile, e.g. when load differs"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithNumber(
+			"limit",
+			mcp.Description("Maximum number of regressions to list"),
+			mcp.DefaultNumber(20),
+			mcp.Min(1),
+		),
+		mcp.WithNumber(
+			"duration",
+			mcp.Description("Duration of CPU profiling in seconds when current is \"now\" for a CPU profile"),
+			mcp.DefaultNumber(10),
+		),
+	)
+}
+
+// NewAnalyzeTool creates a new MCP tool for automated profile analysis.
+// This tool runs rule-based detectors for known performance anti-patterns and
+// returns findings with severity, evidence and remediation hints, so the
+// numbers do not have to be interpreted from scratch.
+func NewAnalyzeTool() mcp.Tool {
+	return mcp.NewTool("analyze",
+		mcp.WithDescription("Detect known performance anti-patterns (fmt/strconv churn, regexp compilation, reflection-heavy JSON, "+
+			"map and slice growth, []byte/string conversions, defer in loops, GC pressure) and suggest fixes"),
+		mcp.WithString(
+			"snapshot",
+			mcp.Description("Snapshot ID of the profile to analyze (default: collect fresh CPU and allocation profiles)"),
+		),
+		mcp.WithNumber(
+			"duration",
+			mcp.Description("Duration of CPU profiling in seconds when no snapshot is given"),
+			mcp.DefaultNumber(10),
+		),
+	)
+}
+
+// NewDeadlockTool creates a new MCP tool for deadlock detection.
+// This tool analyzes goroutine stacks of a hanging process to find out quickly
+// whether goroutines are stuck on each other, and on which code paths.
+func NewDeadlockTool() mcp.Tool {
+	return mcp.NewTool("detect-deadlocks",
+		mcp.WithDescription("Analyze goroutine stacks for goroutines blocked on mutexes, wait groups and channels, "+
+			"grouped by call site, and flag deadlocks and likely lock-order cycles"),
+		mcp.WithString(
+			"file",
+			mcp.Description("Goroutine dump file (debug=2 or panic/SIGQUIT format) in the profile directory to analyze instead of the live process"),
+		),
+		mcp.WithNumber(
+			"limit",
+			mcp.Description("Maximum number of blocking call sites to show"),
+			mcp.DefaultNumber(20),
+			mcp.Min(1),
+			mcp.Max(1000),
+		),
+	)
+}
+
+// withTimeRange adds the from and to parameters used by the continuous profiling tools.
+func withTimeRange() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithString(
+			"from",
+			mcp.Description("Start of the time range: RFC 3339 timestamp or duration ago (e.g. \"30m\"); default: oldest profile"),
+		),
+		mcp.WithString(
+			"to",
+			mcp.Description("End of the time range: RFC 3339 timestamp or duration ago (e.g. \"5m\"); default: now"),
+		),
+	}
+}
+
+// NewContinuousProfilesTool creates a new MCP tool for listing background profiles.
+// This tool shows which profiles the continuous collector captured in a time range,
+// so the agent can look at an incident that already ended.
+func NewContinuousProfilesTool() mcp.Tool {
+	opts := append(withTimeRange(),
+		mcp.WithDescription("List profiles captured by continuous background profiling within a time range"),
+		mcp.WithString(
+			"type",
+			mcp.Description("Only list profiles of this type (e.g. cpu, heap, goroutine, mutex)"),
+		),
+	)
+	return mcp.NewTool("continuous-profiles", opts...)
+}
+
+// NewContinuousAggregateTool creates a new MCP tool for aggregating background profiles.
+// CPU profiles are summed, cumulative profiles (mutex, block, allocs) are reported as the
+// delta over the range, and heap and goroutine profiles are averaged.
+func NewContinuousAggregateTool() mcp.Tool {
+	opts := append(withTimeRange(),
+		mcp.WithString(
+			"type",
+			mcp.Description("Profile type to aggregate (e.g. cpu, heap, goroutine, mutex)"),
+			mcp.Required(),
+		),
+	)
+	return newProfileTool("continuous-aggregate", "Output profile data aggregated over a time range of continuous background profiling", opts...)
+}
+
+// NewTriggeredCapturesTool creates a new MCP tool for listing threshold-triggered captures.
+// This tool shows when each trigger fired, the metric value that crossed the threshold
+// and the snapshot IDs of the captured profiles.
+func NewTriggeredCapturesTool() mcp.Tool {
+	return mcp.NewTool("triggered-captures",
+		mcp.WithDescription("List profiles captured automatically when a runtime metric crossed a configured threshold"),
+	)
+}
+
+// NewRuntimeMetricsTool creates a new MCP tool for reading runtime/metrics.
+// This tool provides the scalar runtime state (heap sizes, GC cycles, goroutine count,
+// scheduler latencies) that gives context to the sampled profiles.
+func NewRuntimeMetricsTool() mcp.Tool {
+	return mcp.NewTool("runtime-metrics",
+		mcp.WithDescription("Output runtime/metrics values, with percentiles for histograms such as GC pauses and scheduler latencies"),
+		mcp.WithString(
+			"filter",
+			mcp.Description("Comma-separated substrings of metric names to include (e.g. \"/gc/,/sched/\"); default: all metrics"),
+		),
+		mcp.WithNumber(
+			"interval",
+			mcp.Description("If greater than 0, sample twice this many seconds apart and report cumulative metrics as rates"),
+			mcp.DefaultNumber(0),
+			mcp.Min(0),
+			mcp.Max(300),
+		),
+	)
+}
+
+// NewMemStatsTool creates a new MCP tool for GC and memory statistics.
+// This tool complements the sampled heap profile with exact heap sizes, GC settings,
+// pause percentiles and GC CPU usage, and explains what the numbers mean.
+func NewMemStatsTool() mcp.Tool {
+	return mcp.NewTool("memstats",
+		mcp.WithDescription("Output a summary of runtime.MemStats and GC statistics with an interpretation"),
+	)
+}
+
+// NewRuntimeSettingsTool creates a new MCP tool for listing runtime settings.
+func NewRuntimeSettingsTool() mcp.Tool {
+	return mcp.NewTool("runtime-settings",
+		mcp.WithDescription("List the runtime settings that set-runtime-setting can change, with their current values and pending reverts"),
+	)
+}
+
+// NewSetRuntimeSettingTool creates a new MCP tool for changing a runtime setting.
+// This tool enables diagnostics that need different settings, such as block or
+// mutex profiling, or tests the effect of GC tuning. Changes can be temporary.
+func NewSetRuntimeSettingTool() mcp.Tool {
+	names := runtimeSettingNames()
+	descriptions := make([]string, len(names))
+	for i, name := range names {
+		descriptions[i] = name + ": " + runtimeSettings[name].description
+	}
+	return mcp.NewTool("set-runtime-setting",
+		mcp.WithDescription("Change a runtime setting of the process, optionally reverting it after a TTL. Settings:\n"+
+			strings.Join(descriptions, "\n")),
+		mcp.WithString(
+			"setting",
+			mcp.Description("Name of the setting"),
+			mcp.Enum(names...),
+			mcp.Required(),
+		),
+		mcp.WithNumber(
+			"value",
+			mcp.Description("New value of the setting"),
+			mcp.Required(),
+		),
+		mcp.WithNumber(
+			"ttl",
+			mcp.Description("Revert the setting to its previous value after this many seconds (default: keep the new value)"),
+			mcp.Min(0),
+		),
+	)
+}
+
+// NewForceGCTool creates a new MCP tool for forcing a garbage collection.
+func NewForceGCTool() mcp.Tool {
+	return mcp.NewTool("force-gc",
+		mcp.WithDescription("Run a garbage collection (runtime.GC), or debug.FreeOSMemory to also return memory to the OS, "+
+			"and report the heap before and after"),
+		mcp.WithBoolean(
+			"free_os_memory",
+			mcp.Description("Use debug.FreeOSMemory instead of runtime.GC"),
+			mcp.DefaultBool(false),
+		),
+	)
+}
+
+// NewExecutionTraceTool creates a new MCP tool for execution tracing.
+// This tool captures a runtime/trace execution trace and summarizes latency caused by
+// scheduling, blocking, syscalls and GC, which CPU profiles do not show.
+func NewExecutionTraceTool() mcp.Tool {
+	return mcp.NewTool("execution-trace",
+		mcp.WithDescription("Capture an execution trace and output a summary of goroutine scheduling, blocking, GC and user tasks/regions"),
+		mcp.WithNumber(
+			"duration",
+			mcp.Description("Duration of tracing in seconds"),
+			mcp.DefaultNumber(5),
+			mcp.Min(1),
+			mcp.Max(60),
+		),
+		mcp.WithNumber(
+			"limit",
+			mcp.Description("Maximum number of goroutines, groups, tasks and regions to show"),
+			mcp.DefaultNumber(20),
+			mcp.Min(1),
+			mcp.Max(1000),
+		),
+	)
+}
@@ -0,0 +1,487 @@
+package pprofmcpagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/trace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	xtrace "golang.org/x/exp/trace"
+)
+
+// Execution trace settings
+const (
+	ProfileTypeTrace     = "trace"
+	traceResourcePrefix  = "pprof://traces/"
+	minTraceDuration     = time.Second
+	maxTraceDuration     = 60 * time.Second
+	maxStoredTraces      = 4
+	maxStoredTraceBytes  = 256 << 20
+	defaultTraceDuration = 5
+)
+
+// Blocking categories used in the execution trace summary
+const (
+	traceCategoryChannel = "channel/select"
+	traceCategorySync    = "sync"
+	traceCategoryNetwork = "network"
+	traceCategorySleep   = "sleep"
+	traceCategoryGC      = "GC"
+	traceCategoryOther   = "other"
+)
+
+// goroutineTrace accumulates the time a single goroutine spent in each state.
+type goroutineTrace struct {
+	id        xtrace.GoID
+	name      string
+	state     xtrace.GoState
+	reason    string
+	since     xtrace.Time
+	exec      time.Duration
+	schedWait time.Duration
+	syscall   time.Duration
+	blocked   map[string]time.Duration
+}
+
+func (g *goroutineTrace) blockedTotal() time.Duration {
+	var total time.Duration
+	for _, d := range g.blocked {
+		total += d
+	}
+	return total
+}
+
+// traceSpan accumulates the count and durations of a kind of range, task or region.
+type traceSpan struct {
+	count int
+	total time.Duration
+	max   time.Duration
+}
+
+func (s *traceSpan) add(d time.Duration) {
+	s.count++
+	s.total += d
+	if d > s.max {
+		s.max = d
+	}
+}
+
+// traceSummary is the result of analysing an execution trace.
+type traceSummary struct {
+	start, end xtrace.Time
+	events     int
+	goroutines map[xtrace.GoID]*goroutineTrace
+	ranges     map[string]*traceSpan
+	tasks      map[string]*traceSpan
+	regions    map[string]*traceSpan
+}
+
+// traceGoVersion returns the Go version from the header of an execution trace,
+// e.g. "go 1.26", or "" if the data does not start with a trace header.
+func traceGoVersion(data []byte) string {
+	header, _, ok := bytes.Cut(data[:min(len(data), 16)], []byte(" trace"))
+	if !ok || !bytes.HasPrefix(header, []byte("go 1.")) {
+		return ""
+	}
+	return string(header)
+}
+
+// summarizeTrace parses an execution trace and accumulates per-goroutine state durations,
+// GC and stop-the-world ranges, and user task and region durations.
+func summarizeTrace(data []byte) (*traceSummary, error) {
+	r, err := xtrace.NewReader(bytes.NewReader(data))
+	if err != nil {
+		if version := traceGoVersion(data); version != "" {
+			return nil, fmt.Errorf("failed to read trace written by %s; this agent was built with %s and its "+
+				"golang.org/x/exp/trace may not support that trace format yet: %w", version, runtime.Version(), err)
+		}
+		return nil, fmt.Errorf("failed to read trace: %w", err)
+	}
+
+	s := &traceSummary{
+		start:      -1,
+		goroutines: make(map[xtrace.GoID]*goroutineTrace),
+		ranges:     make(map[string]*traceSpan),
+		tasks:      make(map[string]*traceSpan),
+		regions:    make(map[string]*traceSpan),
+	}
+	rangeStarts := make(map[string]xtrace.Time)
+	taskStarts := make(map[xtrace.TaskID]xtrace.Time)
+	taskTypes := make(map[xtrace.TaskID]string)
+	regionStarts := make(map[xtrace.GoID][]xtrace.Time)
+
+	for {
+		ev, err := r.ReadEvent()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trace event: %w", err)
+		}
+
+		s.events++
+		ts := ev.Time()
+		if s.start < 0 {
+			s.start = ts
+		}
+		s.end = ts
+
+		switch ev.Kind() {
+		case xtrace.EventStateTransition:
+			st := ev.StateTransition()
+			if st.Resource.Kind != xtrace.ResourceGoroutine {
+				continue
+			}
+			s.goroutineTransition(st, ts)
+		case xtrace.EventRangeBegin:
+			rangeStarts[rangeKey(ev)] = ts
+		case xtrace.EventRangeEnd:
+			key := rangeKey(ev)
+			if begin, ok := rangeStarts[key]; ok {
+				s.span(s.ranges, ev.Range().Name).add(ts.Sub(begin))
+				delete(rangeStarts, key)
+			}
+		case xtrace.EventTaskBegin:
+			task := ev.Task()
+			taskStarts[task.ID] = ts
+			taskTypes[task.ID] = task.Type
+		case xtrace.EventTaskEnd:
+			task := ev.Task()
+			if begin, ok := taskStarts[task.ID]; ok {
+				s.span(s.tasks, taskTypes[task.ID]).add(ts.Sub(begin))
+				delete(taskStarts, task.ID)
+			}
+		case xtrace.EventRegionBegin:
+			regionStarts[ev.Goroutine()] = append(regionStarts[ev.Goroutine()], ts)
+		case xtrace.EventRegionEnd:
+			starts := regionStarts[ev.Goroutine()]
+			if len(starts) > 0 {
+				s.span(s.regions, ev.Region().Type).add(ts.Sub(starts[len(starts)-1]))
+				regionStarts[ev.Goroutine()] = starts[:len(starts)-1]
+			}
+		}
+	}
+
+	// Account for the time goroutines spent in their final state
+	for _, g := range s.goroutines {
+		g.accumulate(s.end)
+	}
+	return s, nil
+}
+
+// goroutineTransition records a goroutine state change.
+func (s *traceSummary) goroutineTransition(st xtrace.StateTransition, ts xtrace.Time) {
+	id := st.Resource.Goroutine()
+	g, ok := s.goroutines[id]
+	if !ok {
+		g = &goroutineTrace{id: id, since: ts, blocked: make(map[string]time.Duration)}
+		s.goroutines[id] = g
+	}
+	if g.name == "" {
+		// The outermost frame is the goroutine's start function
+		for frame := range st.Stack.Frames() {
+			g.name = frame.Func
+		}
+	}
+
+	from, to := st.Goroutine()
+	g.state = from
+	g.accumulate(ts)
+	g.state = to
+	if to == xtrace.GoWaiting {
+		g.reason = st.Reason
+	}
+}
+
+// accumulate adds the time since the last transition to the current state.
+func (g *goroutineTrace) accumulate(ts xtrace.Time) {
+	d := ts.Sub(g.since)
+	g.since = ts
+	switch g.state {
+	case xtrace.GoRunning:
+		g.exec += d
+	case xtrace.GoRunnable:
+		g.schedWait += d
+	case xtrace.GoSyscall:
+		g.syscall += d
+	case xtrace.GoWaiting:
+		g.blocked[blockingCategory(g.reason)] += d
+	}
+}
+
+func (s *traceSummary) span(spans map[string]*traceSpan, name string) *traceSpan {
+	if name == "" {
+		name = "(unnamed)"
+	}
+	sp, ok := spans[name]
+	if !ok {
+		sp = &traceSpan{}
+		spans[name] = sp
+	}
+	return sp
+}
+
+// rangeKey identifies an active range by name and scope.
+func rangeKey(ev xtrace.Event) string {
+	r := ev.Range()
+	return r.Name + "@" + r.Scope.String()
+}
+
+// blockingCategory maps a goroutine wait reason to a blocking category.
+func blockingCategory(reason string) string {
+	switch {
+	case strings.Contains(reason, "chan"), strings.Contains(reason, "select"):
+		return traceCategoryChannel
+	case strings.Contains(reason, "network"):
+		return traceCategoryNetwork
+	case strings.Contains(reason, "sync"), strings.Contains(reason, "Cond"):
+		return traceCategorySync
+	case strings.Contains(reason, "sleep"):
+		return traceCategorySleep
+	case strings.Contains(reason, "GC"):
+		return traceCategoryGC
+	default:
+		return traceCategoryOther
+	}
+}
+
+// format renders the summary, showing up to n goroutine groups and goroutines.
+func (s *traceSummary) format(n int) string {
+	var result strings.Builder
+	duration := s.end.Sub(s.start)
+	result.WriteString(fmt.Sprintf("Execution trace summary (%s, %d events, %d goroutines)\n\n", duration, s.events, len(s.goroutines)))
+
+	// Totals over all goroutines
+	var exec, schedWait, syscall time.Duration
+	blocked := make(map[string]time.Duration)
+	type group struct {
+		name                              string
+		count                             int
+		exec, schedWait, syscall, blocked time.Duration
+	}
+	groups := make(map[string]*group)
+	for _, g := range s.goroutines {
+		exec += g.exec
+		schedWait += g.schedWait
+		syscall += g.syscall
+		for category, d := range g.blocked {
+			blocked[category] += d
+		}
+
+		name := g.name
+		if name == "" {
+			name = "(unknown)"
+		}
+		gr, ok := groups[name]
+		if !ok {
+			gr = &group{name: name}
+			groups[name] = gr
+		}
+		gr.count++
+		gr.exec += g.exec
+		gr.schedWait += g.schedWait
+		gr.syscall += g.syscall
+		gr.blocked += g.blockedTotal()
+	}
+
+	result.WriteString("Time spent by all goroutines:\n")
+	result.WriteString(fmt.Sprintf("  executing: %s\n", exec))
+	result.WriteString(fmt.Sprintf("  waiting for a P (scheduler latency): %s\n", schedWait))
+	result.WriteString(fmt.Sprintf("  in syscalls: %s\n", syscall))
+	categories := make([]string, 0, len(blocked))
+	for category := range blocked {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return blocked[categories[i]] > blocked[categories[j]]
+	})
+	for _, category := range categories {
+		result.WriteString(fmt.Sprintf("  blocked on %s: %s\n", category, blocked[category]))
+	}
+
+	result.WriteString("\nGC and runtime ranges:\n")
+	if len(s.ranges) == 0 {
+		result.WriteString("  none\n")
+	}
+	writeSpans(&result, s.ranges, n)
+
+	sortedGroups := make([]*group, 0, len(groups))
+	for _, gr := range groups {
+		sortedGroups = append(sortedGroups, gr)
+	}
+	sort.Slice(sortedGroups, func(i, j int) bool {
+		return sortedGroups[i].exec > sortedGroups[j].exec
+	})
+	result.WriteString(fmt.Sprintf("\nGoroutine groups by start function (top %d by execution time):\n", n))
+	for i := 0; i < n && i < len(sortedGroups); i++ {
+		gr := sortedGroups[i]
+		result.WriteString(fmt.Sprintf("  %s: %d goroutines, exec %s, sched wait %s, syscall %s, blocked %s\n",
+			gr.name, gr.count, gr.exec, gr.schedWait, gr.syscall, gr.blocked))
+	}
+
+	sortedGoroutines := make([]*goroutineTrace, 0, len(s.goroutines))
+	for _, g := range s.goroutines {
+		sortedGoroutines = append(sortedGoroutines, g)
+	}
+	sort.Slice(sortedGoroutines, func(i, j int) bool {
+		return sortedGoroutines[i].exec > sortedGoroutines[j].exec
+	})
+	result.WriteString(fmt.Sprintf("\nGoroutines (top %d by execution time):\n", n))
+	for i := 0; i < n && i < len(sortedGoroutines); i++ {
+		g := sortedGoroutines[i]
+		result.WriteString(fmt.Sprintf("  goroutine %d (%s): exec %s, sched wait %s, syscall %s, blocked %s\n",
+			g.id, g.name, g.exec, g.schedWait, g.syscall, g.blockedTotal()))
+	}
+
+	if len(s.tasks) > 0 {
+		result.WriteString("\nUser tasks:\n")
+		writeSpans(&result, s.tasks, n)
+	}
+	if len(s.regions) > 0 {
+		result.WriteString("\nUser regions:\n")
+		writeSpans(&result, s.regions, n)
+	}
+
+	return result.String()
+}
+
+// writeSpans writes up to n spans sorted by total duration.
+func writeSpans(result *strings.Builder, spans map[string]*traceSpan, n int) {
+	names := make([]string, 0, len(spans))
+	for name := range spans {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return spans[names[i]].total > spans[names[j]].total
+	})
+	for i := 0; i < n && i < len(names); i++ {
+		sp := spans[names[i]]
+		result.WriteString(fmt.Sprintf("  %s: count %d, total %s, avg %s, max %s\n",
+			names[i], sp.count, sp.total, sp.total/time.Duration(sp.count), sp.max))
+	}
+}
+
+// ExecutionTraceHandler captures a runtime/trace execution trace for a bounded duration
+// and summarizes scheduling, blocking, syscall and GC behaviour that CPU profiles miss.
+// The raw trace is kept and exposed as an MCP resource for tools such as `go tool trace`.
+func ExecutionTraceHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	duration, ok := request.Params.Arguments["duration"].(float64)
+	if !ok {
+		duration = defaultTraceDuration
+	}
+	d := time.Duration(duration * float64(time.Second))
+	if d < minTraceDuration {
+		d = minTraceDuration
+	}
+	if d > maxTraceDuration {
+		d = maxTraceDuration
+	}
+	limit := 20
+	if limitParam, ok := request.Params.Arguments["limit"].(float64); ok {
+		limit = int(limitParam)
+	}
+
+	a := agentFromContext(ctx)
+	source, err := a.sourceFor(request)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+	data, err := source.Trace(ctx, request, d)
+	if err != nil {
+		return handleMCPError(err), nil
+	}
+
+	// The raw trace stays available even if it cannot be summarized,
+	// e.g. when it was written by a newer Go version than the parser supports.
+	snap := a.traces.Add(ProfileTypeTrace, data)
+	var result string
+	if summary, err := summarizeTrace(snap.data); err != nil {
+		result = fmt.Sprintf("Summary unavailable: %v\n", err)
+		if a.redactor == nil {
+			result += "The raw trace is still available and can be opened with `go tool trace` of the Go version that wrote it.\n"
+		}
+	} else if err := a.redactor.trace(summary); err != nil {
+		return handleMCPError(err), nil
+	} else {
+		result = summary.format(limit)
+	}
+
+	raw := fmt.Sprintf("raw trace: %s%s, %s", traceResourcePrefix, snap.ID, formatValue(int64(snap.Size)))
+	if a.redactor != nil {
+		raw = "raw trace withheld because redaction is configured"
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(fmt.Sprintf("Trace ID: %s (%s)\n\n%s", snap.ID, raw, result)),
+		},
+	}, nil
+}
+
+// processTraceCapture is held while an agent of the process captures an execution trace.
+var processTraceCapture sync.Mutex
+
+var (
+	errTraceBusy    = errors.New("another execution trace is being captured; retry when it finishes")
+	errTraceEnabled = errors.New("execution tracing is already enabled in this process by another tracer, e.g. go test -trace or /debug/pprof/trace")
+)
+
+// captureTrace runs runtime/trace for the given duration,
+// sending progress notifications for the request while the trace is being captured.
+func captureTrace(ctx context.Context, request mcp.CallToolRequest, d time.Duration) ([]byte, error) {
+	// The runtime supports only one execution trace at a time
+	if !processTraceCapture.TryLock() {
+		return nil, &ProfileError{ProfileType: ProfileTypeTrace, Err: errTraceBusy}
+	}
+	defer processTraceCapture.Unlock()
+	if trace.IsEnabled() {
+		return nil, &ProfileError{ProfileType: ProfileTypeTrace, Err: errTraceEnabled}
+	}
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		return nil, &ProfileError{ProfileType: ProfileTypeTrace, Err: err}
+	}
+	err := waitWithProgress(ctx, request, d)
+	trace.Stop()
+	if err != nil {
+		return nil, &ProfileError{ProfileType: ProfileTypeTrace, Err: err}
+	}
+	return buf.Bytes(), nil
+}
+
+// NewTraceResourceTemplate creates the MCP resource template for raw execution traces.
+func NewTraceResourceTemplate() mcp.ResourceTemplate {
+	return mcp.NewResourceTemplate(traceResourcePrefix+"{id}", "Execution trace",
+		mcp.WithTemplateDescription("Raw runtime/trace data captured by the execution-trace tool, readable with `go tool trace`"),
+		mcp.WithTemplateMIMEType("application/octet-stream"),
+	)
+}
+
+// TraceResourceHandler returns the raw data of a captured execution trace.
+// Raw traces cannot be redacted, so they are not returned when redaction is configured.
+func TraceResourceHandler(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	a := agentFromContext(ctx)
+	if a.redactor != nil {
+		return nil, fmt.Errorf("raw execution traces cannot be redacted and are not exported when redaction is configured")
+	}
+	id := strings.TrimPrefix(request.Params.URI, traceResourcePrefix)
+	snap, err := a.traces.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{
+		mcp.BlobResourceContents{
+			URI:      request.Params.URI,
+			MIMEType: "application/octet-stream",
+			Blob:     base64.StdEncoding.EncodeToString(snap.data),
+		},
+	}, nil
+}
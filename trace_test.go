@@ -0,0 +1,107 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"runtime/trace"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestCaptureAndSummarizeTrace(t *testing.T) {
+	// Generate some scheduling and blocking activity while tracing
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(time.Millisecond):
+				}
+			}
+		}()
+	}
+	data, err := captureTrace(context.Background(), mcp.CallToolRequest{}, 100*time.Millisecond)
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("captureTrace: %v", err)
+	}
+
+	summary, err := summarizeTrace(data)
+	if err != nil {
+		t.Fatalf("summarizeTrace of a %s trace: %v", runtime.Version(), err)
+	}
+	if summary.events == 0 || len(summary.goroutines) == 0 {
+		t.Fatalf("summary has %d events and %d goroutines", summary.events, len(summary.goroutines))
+	}
+	out := summary.format(10)
+	if !strings.HasPrefix(out, "Execution trace summary (") {
+		t.Errorf("unexpected summary:\n%s", out)
+	}
+}
+
+func TestCaptureTraceBusy(t *testing.T) {
+	done := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_, err := captureTrace(ctx, mcp.CallToolRequest{}, time.Minute)
+		done <- err
+	}()
+	waitFor(t, trace.IsEnabled)
+
+	_, err := captureTrace(context.Background(), mcp.CallToolRequest{}, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), errTraceBusy.Error()) {
+		t.Errorf("concurrent capture: got %v, want %v", err, errTraceBusy)
+	}
+	cancel()
+	<-done
+
+	if err := trace.Start(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	_, err = captureTrace(context.Background(), mcp.CallToolRequest{}, 100*time.Millisecond)
+	trace.Stop()
+	if err == nil || !strings.Contains(err.Error(), errTraceEnabled.Error()) {
+		t.Errorf("capture during another tracer: got %v, want %v", err, errTraceEnabled)
+	}
+}
+
+func TestTraceGoVersion(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"go 1.26 trace\x00\x00\x00\x01\x02", "go 1.26"},
+		{"go 1.9 trace\x00\x00\x00\x00", "go 1.9"},
+		{"not a trace", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := traceGoVersion([]byte(tt.data)); got != tt.want {
+			t.Errorf("traceGoVersion(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizeUnsupportedTrace(t *testing.T) {
+	_, err := summarizeTrace([]byte("go 1.99 trace\x00\x00\x00"))
+	if err == nil {
+		t.Fatal("summarizing a trace of an unknown version succeeded")
+	}
+	for _, s := range []string{"go 1.99", runtime.Version()} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("error %q does not name %s", err, s)
+		}
+	}
+}
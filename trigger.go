@@ -0,0 +1,403 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"runtime/metrics"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TriggerMetric identifies a runtime metric watched by a Trigger.
+type TriggerMetric string
+
+const (
+	// TriggerHeapInUse fires when heap memory occupied by live and unswept objects exceeds the threshold (bytes).
+	TriggerHeapInUse TriggerMetric = "heap_inuse_bytes"
+	// TriggerGoroutines fires when the number of live goroutines exceeds the threshold.
+	TriggerGoroutines TriggerMetric = "goroutines"
+	// TriggerGCCPUFraction fires when the fraction of CPU time spent in the GC since the
+	// previous check exceeds the threshold (0-1).
+	TriggerGCCPUFraction TriggerMetric = "gc_cpu_fraction"
+	// TriggerSchedLatencyP99 fires when the 99th percentile of the time goroutines waited
+	// to be scheduled since the previous check exceeds the threshold (seconds).
+	TriggerSchedLatencyP99 TriggerMetric = "sched_latency_p99_seconds"
+)
+
+// Default trigger settings
+const (
+	DefaultTriggerInterval    = 5 * time.Second
+	DefaultTriggerCooldown    = 5 * time.Minute
+	DefaultTriggerCPUDuration = 10 * time.Second
+	maxTriggeredCaptures      = 100
+)
+
+// Trigger captures profiles automatically when a runtime metric crosses a threshold.
+type Trigger struct {
+	// Name identifies the trigger in the list of triggered captures (default: the metric name).
+	Name string
+	// Metric is the runtime metric to watch.
+	Metric TriggerMetric
+	// Threshold is the value above which the trigger fires.
+	Threshold float64
+	// ProfileTypes to capture when the trigger fires (default depends on the metric).
+	ProfileTypes []string
+	// Cooldown is the minimum time between two captures of this trigger (default: 5 minutes).
+	Cooldown time.Duration
+	// CPUDuration is how long the CPU profile is sampled, if captured (default: 10 seconds).
+	CPUDuration time.Duration
+}
+
+// WithTrigger adds a threshold trigger. Triggers are checked every trigger interval
+// until the context given by WithContext (or ServeSSE) is cancelled.
+func WithTrigger(t Trigger) Option {
+	return func(c *config) {
+		if t.Name == "" {
+			t.Name = string(t.Metric)
+		}
+		if len(t.ProfileTypes) == 0 {
+			t.ProfileTypes = defaultTriggerProfileTypes(t.Metric)
+		}
+		if t.Cooldown <= 0 {
+			t.Cooldown = DefaultTriggerCooldown
+		}
+		if t.CPUDuration <= 0 {
+			t.CPUDuration = DefaultTriggerCPUDuration
+		}
+		c.triggers = append(c.triggers, t)
+	}
+}
+
+// WithTriggerInterval sets how often trigger metrics are checked (default: 5 seconds).
+func WithTriggerInterval(d time.Duration) Option {
+	return func(c *config) {
+		c.triggerInterval = d
+	}
+}
+
+// defaultTriggerProfileTypes returns the profiles most relevant to a metric.
+func defaultTriggerProfileTypes(metric TriggerMetric) []string {
+	switch metric {
+	case TriggerHeapInUse:
+		return []string{ProfileTypeHeap, ProfileTypeAllocs}
+	case TriggerGoroutines:
+		return []string{ProfileTypeGoroutine}
+	case TriggerGCCPUFraction:
+		return []string{ProfileTypeAllocs, ProfileTypeCPU}
+	case TriggerSchedLatencyP99:
+		return []string{ProfileTypeCPU, ProfileTypeGoroutine}
+	default:
+		return []string{ProfileTypeHeap, ProfileTypeGoroutine}
+	}
+}
+
+// TriggeredCapture records why a trigger fired and which snapshots it captured.
+type TriggeredCapture struct {
+	Trigger     string
+	Metric      TriggerMetric
+	Value       float64
+	Threshold   float64
+	FiredAt     time.Time
+	SnapshotIDs []string
+	Errors      []string
+}
+
+// Runtime metric names read by the trigger watcher
+const (
+	metricHeapObjectsBytes = "/memory/classes/heap/objects:bytes"
+	metricGoroutines       = "/sched/goroutines:goroutines"
+	metricGCCPUSeconds     = "/cpu/classes/gc/total:cpu-seconds"
+	metricTotalCPUSeconds  = "/cpu/classes/total:cpu-seconds"
+	metricSchedLatencies   = "/sched/latencies:seconds"
+)
+
+// triggerWatcher periodically evaluates triggers and captures profiles into the snapshot store.
+type triggerWatcher struct {
+	triggers []Trigger
+	interval time.Duration
+	source   profileSource
+	store    *snapshotStore
+
+	mu        sync.Mutex
+	lastFired map[string]time.Time
+	captures  []TriggeredCapture // ordered from oldest to newest
+
+	samples     []metrics.Sample
+	prevGCCPU   float64
+	prevCPU     float64
+	prevLatency *metrics.Float64Histogram
+}
+
+// newTriggerWatcher creates a trigger watcher. It returns an error if a trigger
+// watches an unknown metric or captures an unknown profile type, as such a trigger would never fire
+// or capture nothing.
+func newTriggerWatcher(triggers []Trigger, interval time.Duration, source profileSource, store *snapshotStore) (*triggerWatcher, error) {
+	for _, t := range triggers {
+		if err := validateTrigger(t); err != nil {
+			return nil, err
+		}
+	}
+	if interval <= 0 {
+		interval = DefaultTriggerInterval
+	}
+	return &triggerWatcher{
+		triggers:  triggers,
+		interval:  interval,
+		source:    source,
+		store:     store,
+		lastFired: make(map[string]time.Time),
+		samples: []metrics.Sample{
+			{Name: metricHeapObjectsBytes},
+			{Name: metricGoroutines},
+			{Name: metricGCCPUSeconds},
+			{Name: metricTotalCPUSeconds},
+			{Name: metricSchedLatencies},
+		},
+	}, nil
+}
+
+// triggerRuntimeMetrics maps each trigger metric to the runtime/metrics names it is computed from.
+var triggerRuntimeMetrics = map[TriggerMetric][]string{
+	TriggerHeapInUse:       {metricHeapObjectsBytes},
+	TriggerGoroutines:      {metricGoroutines},
+	TriggerGCCPUFraction:   {metricGCCPUSeconds, metricTotalCPUSeconds},
+	TriggerSchedLatencyP99: {metricSchedLatencies},
+}
+
+// validateTrigger checks that the trigger's metric is known and supported by the
+// runtime, and that its profile types exist.
+func validateTrigger(t Trigger) error {
+	names, ok := triggerRuntimeMetrics[t.Metric]
+	if !ok {
+		known := make([]string, 0, len(triggerRuntimeMetrics))
+		for m := range triggerRuntimeMetrics {
+			known = append(known, string(m))
+		}
+		sort.Strings(known)
+		return fmt.Errorf("trigger %s: unknown metric %q (known: %s)", t.Name, t.Metric, strings.Join(known, ", "))
+	}
+	supported := make(map[string]bool)
+	for _, d := range metrics.All() {
+		supported[d.Name] = true
+	}
+	for _, name := range names {
+		if !supported[name] {
+			return fmt.Errorf("trigger %s: metric %s needs runtime metric %s, which this Go runtime does not provide", t.Name, t.Metric, name)
+		}
+	}
+	for _, profileType := range t.ProfileTypes {
+		if profileType != ProfileTypeCPU && pprof.Lookup(profileType) == nil {
+			return fmt.Errorf("trigger %s: unknown profile type %q", t.Name, profileType)
+		}
+	}
+	return nil
+}
+
+// run checks triggers every interval until ctx is cancelled.
+func (w *triggerWatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	w.read() // establish the baseline for interval-based metrics
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		values := w.read()
+		for _, t := range w.triggers {
+			value, ok := values[t.Metric]
+			if !ok || value <= t.Threshold {
+				continue
+			}
+			w.mu.Lock()
+			last := w.lastFired[t.Name]
+			w.mu.Unlock()
+			if !last.IsZero() && time.Since(last) < t.Cooldown {
+				continue
+			}
+			w.fire(ctx, t, value)
+		}
+	}
+}
+
+// read samples the runtime metrics and returns the current value of every trigger metric.
+// Interval-based metrics are computed against the previous read.
+func (w *triggerWatcher) read() map[TriggerMetric]float64 {
+	metrics.Read(w.samples)
+
+	values := make(map[TriggerMetric]float64)
+	var gcCPU, totalCPU float64
+	for _, sample := range w.samples {
+		switch sample.Name {
+		case metricHeapObjectsBytes:
+			values[TriggerHeapInUse] = float64(sample.Value.Uint64())
+		case metricGoroutines:
+			values[TriggerGoroutines] = float64(sample.Value.Uint64())
+		case metricGCCPUSeconds:
+			gcCPU = sample.Value.Float64()
+		case metricTotalCPUSeconds:
+			totalCPU = sample.Value.Float64()
+		case metricSchedLatencies:
+			hist := sample.Value.Float64Histogram()
+			if w.prevLatency != nil {
+				values[TriggerSchedLatencyP99] = histogramPercentile(subtractHistogram(hist, w.prevLatency), 0.99)
+			}
+			w.prevLatency = copyHistogram(hist)
+		}
+	}
+	if delta := totalCPU - w.prevCPU; delta > 0 {
+		values[TriggerGCCPUFraction] = (gcCPU - w.prevGCCPU) / delta
+	}
+	w.prevGCCPU, w.prevCPU = gcCPU, totalCPU
+	return values
+}
+
+// fire captures the trigger's profiles and records the capture.
+func (w *triggerWatcher) fire(ctx context.Context, t Trigger, value float64) {
+	capture := TriggeredCapture{
+		Trigger:   t.Name,
+		Metric:    t.Metric,
+		Value:     value,
+		Threshold: t.Threshold,
+		FiredAt:   time.Now(),
+	}
+	w.mu.Lock()
+	w.lastFired[t.Name] = capture.FiredAt
+	w.mu.Unlock()
+
+	for _, profileType := range t.ProfileTypes {
+		data, err := w.source.Profile(ctx, mcp.CallToolRequest{}, profileType, t.CPUDuration)
+		if err != nil {
+			capture.Errors = append(capture.Errors, err.Error())
+			continue
+		}
+		capture.SnapshotIDs = append(capture.SnapshotIDs, w.store.Add(profileType, data).ID)
+	}
+	log.Printf("trigger %s fired: %s=%s > %s, captured %s",
+		t.Name, t.Metric, formatMetricValue(t.Metric, value), formatMetricValue(t.Metric, t.Threshold),
+		strings.Join(capture.SnapshotIDs, ", "))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.captures = append(w.captures, capture)
+	if len(w.captures) > maxTriggeredCaptures {
+		w.captures = w.captures[len(w.captures)-maxTriggeredCaptures:]
+	}
+}
+
+// list returns the recorded captures from newest to oldest.
+func (w *triggerWatcher) list() []TriggeredCapture {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	result := make([]TriggeredCapture, 0, len(w.captures))
+	for i := len(w.captures) - 1; i >= 0; i-- {
+		result = append(result, w.captures[i])
+	}
+	return result
+}
+
+// formatMetricValue formats a trigger metric value in its natural unit.
+func formatMetricValue(metric TriggerMetric, v float64) string {
+	switch metric {
+	case TriggerHeapInUse:
+		return formatValue(int64(v))
+	case TriggerGCCPUFraction:
+		return fmt.Sprintf("%.1f%%", v*100)
+	case TriggerSchedLatencyP99:
+		return time.Duration(v * float64(time.Second)).String()
+	default:
+		return fmt.Sprintf("%.0f", v)
+	}
+}
+
+// copyHistogram returns a deep copy of a runtime/metrics histogram.
+func copyHistogram(h *metrics.Float64Histogram) *metrics.Float64Histogram {
+	return &metrics.Float64Histogram{
+		Counts:  append([]uint64(nil), h.Counts...),
+		Buckets: append([]float64(nil), h.Buckets...),
+	}
+}
+
+// subtractHistogram returns the per-bucket difference h - prev.
+// Both histograms must share the same buckets.
+func subtractHistogram(h, prev *metrics.Float64Histogram) *metrics.Float64Histogram {
+	delta := copyHistogram(h)
+	for i := range delta.Counts {
+		if i < len(prev.Counts) && prev.Counts[i] <= delta.Counts[i] {
+			delta.Counts[i] -= prev.Counts[i]
+		}
+	}
+	return delta
+}
+
+// histogramPercentile estimates the q-th quantile (0-1) of a runtime/metrics histogram,
+// using the upper bound of the bucket the quantile falls into. It returns 0 for an empty histogram.
+func histogramPercentile(h *metrics.Float64Histogram, q float64) float64 {
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, c := range h.Counts {
+		seen += c
+		if seen >= rank {
+			upper := h.Buckets[i+1]
+			if math.IsInf(upper, 1) {
+				return h.Buckets[i]
+			}
+			return upper
+		}
+	}
+	return h.Buckets[len(h.Buckets)-1]
+}
+
+// TriggeredCapturesHandler lists the profile captures fired by threshold triggers,
+// including the metric value that caused them and the captured snapshot IDs.
+func TriggeredCapturesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	watcher := agentFromContext(ctx).triggers
+	if watcher == nil {
+		return handleMCPError(fmt.Errorf("no triggers are configured")), nil
+	}
+
+	captures := watcher.list()
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Triggered captures (%d)\n\n", len(captures)))
+	for _, c := range captures {
+		result.WriteString(fmt.Sprintf("%s: trigger=%s, %s=%s exceeded threshold %s\n",
+			c.FiredAt.Format(time.RFC3339), c.Trigger, c.Metric,
+			formatMetricValue(c.Metric, c.Value), formatMetricValue(c.Metric, c.Threshold)))
+		if len(c.SnapshotIDs) > 0 {
+			result.WriteString(fmt.Sprintf("  snapshots: %s\n", strings.Join(c.SnapshotIDs, ", ")))
+		}
+		for _, e := range c.Errors {
+			result.WriteString(fmt.Sprintf("  error: %s\n", e))
+		}
+	}
+
+	result.WriteString("\nConfigured triggers:\n")
+	for _, t := range watcher.triggers {
+		result.WriteString(fmt.Sprintf("- %s: %s > %s, captures %s, cooldown %s\n",
+			t.Name, t.Metric, formatMetricValue(t.Metric, t.Threshold),
+			strings.Join(t.ProfileTypes, ", "), t.Cooldown))
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(result.String()),
+		},
+	}, nil
+}
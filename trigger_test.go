@@ -0,0 +1,98 @@
+package pprofmcpagent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestNewTriggerWatcherValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		trigger Trigger
+		wantErr string
+	}{
+		{
+			name:    "known metric",
+			trigger: Trigger{Name: "heap", Metric: TriggerHeapInUse, ProfileTypes: []string{ProfileTypeHeap}},
+		},
+		{
+			name:    "cpu profile",
+			trigger: Trigger{Name: "gc", Metric: TriggerGCCPUFraction, ProfileTypes: []string{ProfileTypeCPU}},
+		},
+		{
+			name:    "mistyped metric",
+			trigger: Trigger{Name: "heap", Metric: "heap_in_use", ProfileTypes: []string{ProfileTypeHeap}},
+			wantErr: `unknown metric "heap_in_use"`,
+		},
+		{
+			name:    "runtime/metrics name",
+			trigger: Trigger{Name: "g", Metric: "/sched/goroutines:goroutines"},
+			wantErr: "unknown metric",
+		},
+		{
+			name:    "unknown profile type",
+			trigger: Trigger{Name: "heap", Metric: TriggerHeapInUse, ProfileTypes: []string{"heap-profile"}},
+			wantErr: `unknown profile type "heap-profile"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := newTriggerWatcher([]Trigger{tt.trigger}, 0, localSource{cpu: &cpuProfiler{}}, newSnapshotStore(10, 0, "", nil))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if w.interval != DefaultTriggerInterval {
+					t.Errorf("interval = %s, want %s", w.interval, DefaultTriggerInterval)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServeStdioRejectsInvalidTrigger(t *testing.T) {
+	err := ServeStdio(context.Background(), WithTrigger(Trigger{Metric: "heap_bytes", Threshold: 1}))
+	if err == nil || !strings.Contains(err.Error(), `unknown metric "heap_bytes"`) {
+		t.Fatalf("ServeStdio error = %v, want unknown metric", err)
+	}
+}
+
+func TestTriggerCaptureDuringCPUCapture(t *testing.T) {
+	cpu := &cpuProfiler{}
+	source := localSource{cpu: cpu}
+	store := newSnapshotStore(10, 0, "", nil)
+	trigger := Trigger{Name: "gc", Metric: TriggerGCCPUFraction, ProfileTypes: []string{ProfileTypeCPU}, CPUDuration: 300 * time.Millisecond}
+	w, err := newTriggerWatcher([]Trigger{trigger}, time.Second, source, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := source.Profile(context.Background(), mcp.CallToolRequest{}, ProfileTypeCPU, 300*time.Millisecond); err != nil {
+			t.Errorf("on-demand capture failed: %v", err)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	w.fire(context.Background(), trigger, 0.5)
+	wg.Wait()
+
+	captures := w.list()
+	if len(captures) != 1 {
+		t.Fatalf("got %d captures, want 1", len(captures))
+	}
+	if len(captures[0].Errors) > 0 || len(captures[0].SnapshotIDs) != 1 {
+		t.Fatalf("capture = %+v, want one snapshot and no errors", captures[0])
+	}
+}
@@ -2,6 +2,9 @@ package pprofmcpagent
 
 import (
 	"fmt"
+	"maps"
+	"math"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -13,11 +16,207 @@ import (
 type ViewMode string
 
 const (
-	ViewModeFlat  ViewMode = "flat"
-	ViewModeCum   ViewMode = "cum"
-	ViewModeGraph ViewMode = "graph"
+	ViewModeFlat     ViewMode = "flat"
+	ViewModeCum      ViewMode = "cum"
+	ViewModeGraph    ViewMode = "graph"
+	ViewModePackages ViewMode = "packages"
 )
 
+// bytesPerToken approximates the number of bytes per LLM token in rendered profiles.
+const bytesPerToken = 4
+
+// minBudgetBytes is the smallest output budget. Smaller budgets are raised to it,
+// as the note on what was elided alone can take a few hundred bytes.
+const minBudgetBytes = 1024
+
+// defaultSkipPackages are the packages skipped by skip_runtime when no package list is given:
+// the whole standard library, including the runtime.
+var defaultSkipPackages = []string{"std"}
+
+// nodeFractions are the thresholds tried, in order, to hide small locations when output exceeds its budget.
+var nodeFractions = []float64{0.001, 0.005, 0.01, 0.02, 0.05}
+
+// viewOptions controls how profile data is rendered.
+type viewOptions struct {
+	// limit is the maximum number of locations or graph nodes shown.
+	limit int
+	mode  ViewMode
+	// maxBytes is the size budget of the output; zero means unlimited.
+	maxBytes int
+	// trimNames prints function names shortened with trimFunctionName (see displayNames).
+	trimNames bool
+	// byModule makes the packages view roll values up per module instead of per package.
+	byModule bool
+	// collapseRuntime attributes samples to their first frame outside of the runtime.
+	collapseRuntime bool
+	// skipPackages attributes samples to their first frame outside of these packages
+	// (see matchesPackage); nil disables skipping.
+	skipPackages []string
+	// nodeFraction hides locations whose value is below this fraction of the profile total.
+	nodeFraction float64
+	// total is the sum of the absolute first sample values, used for nodeFraction.
+	total int64
+}
+
+// hidden reports whether a location with the given first value is hidden by nodeFraction.
+func (o viewOptions) hidden(v int64) bool {
+	return o.nodeFraction > 0 && float64(abs(v)) < o.nodeFraction*float64(o.total)
+}
+
+// frames returns the stack a sample is attributed to. With collapseRuntime or
+// skipPackages, leading runtime or skipped frames are dropped so the sample is
+// attributed to their caller. Stacks made only of such frames are kept as they are.
+func (o viewOptions) frames(locs []*profile.Location) []*profile.Location {
+	if !o.collapseRuntime && o.skipPackages == nil {
+		return locs
+	}
+	for i, loc := range locs {
+		if !o.skipped(loc) {
+			return locs[i:]
+		}
+	}
+	return locs
+}
+
+// skipped reports whether frames drops the location.
+func (o viewOptions) skipped(loc *profile.Location) bool {
+	if o.collapseRuntime && isRuntimeLocation(loc) {
+		return true
+	}
+	if o.skipPackages == nil || len(loc.Line) == 0 || loc.Line[0].Function == nil {
+		return false
+	}
+	pkg := packageOf(loc.Line[0].Function.Name)
+	for _, p := range o.skipPackages {
+		if matchesPackage(pkg, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// displayNames returns the names the locations are printed with. Locations are
+// aggregated on their full function names; with trimNames the names are shortened
+// for display, except where two locations would be printed with the same name.
+func (o viewOptions) displayNames(locs []string) map[string]string {
+	names := make(map[string]string, len(locs))
+	if !o.trimNames {
+		for _, loc := range locs {
+			names[loc] = loc
+		}
+		return names
+	}
+	count := make(map[string]int, len(locs))
+	for _, loc := range locs {
+		names[loc] = trimFunctionName(loc)
+		count[names[loc]]++
+	}
+	for loc, name := range names {
+		if count[name] > 1 {
+			names[loc] = loc
+		}
+	}
+	return names
+}
+
+// isRuntimeLocation reports whether the location's function belongs to the runtime.
+func isRuntimeLocation(loc *profile.Location) bool {
+	if len(loc.Line) == 0 || loc.Line[0].Function == nil {
+		return false
+	}
+	return strings.HasPrefix(loc.Line[0].Function.Name, "runtime.")
+}
+
+// matchesPackage reports whether pkg is the package pattern or below it,
+// e.g. "net/http" matches net/http and net/http/httputil.
+// The pattern "std" matches all standard library packages.
+func matchesPackage(pkg, pattern string) bool {
+	if pattern == "std" {
+		return moduleOf(pkg) == "std"
+	}
+	return pkg == pattern || strings.HasPrefix(pkg, pattern+"/")
+}
+
+// profileTotal returns the sum of the absolute first sample values of the profile.
+func profileTotal(p *profile.Profile) int64 {
+	var total int64
+	for _, sample := range p.Sample {
+		if len(sample.Value) > 0 {
+			total += abs(sample.Value[0])
+		}
+	}
+	return total
+}
+
+// renderWithBudget renders a view and, if the output exceeds maxBytes, progressively
+// shortens function names, collapses runtime frames, hides small locations and
+// lowers the limit until it fits. A note at the end says what was elided; the
+// output, including the note, does not exceed maxBytes.
+func renderWithBudget(opts viewOptions, render func(viewOptions) string) string {
+	out := render(opts)
+	if opts.maxBytes <= 0 || len(out) <= opts.maxBytes {
+		return out
+	}
+
+	// fits reports whether the output fits the budget with a note listing elided.
+	fits := func(elided []string) bool {
+		return len(out)+len(budgetNote(opts.maxBytes, elided)) <= opts.maxBytes
+	}
+	hidden := func(fraction float64) string {
+		return fmt.Sprintf("locations below %g%% of the total hidden", fraction*100)
+	}
+	limited := func(limit int) string {
+		return fmt.Sprintf("limited to the top %d locations", limit)
+	}
+
+	var elided []string
+	if !opts.trimNames {
+		opts.trimNames = true
+		out = render(opts)
+		elided = append(elided, "function names trimmed")
+	}
+	if !fits(elided) && !opts.collapseRuntime {
+		opts.collapseRuntime = true
+		out = render(opts)
+		elided = append(elided, "runtime frames collapsed into their callers")
+	}
+	if !fits(elided) {
+		for _, fraction := range nodeFractions {
+			if fraction <= opts.nodeFraction {
+				continue
+			}
+			opts.nodeFraction = fraction
+			out = render(opts)
+			if fits(append(slices.Clip(elided), hidden(fraction))) {
+				break
+			}
+		}
+		elided = append(elided, hidden(opts.nodeFraction))
+	}
+	if !fits(elided) {
+		for opts.limit > 1 {
+			opts.limit /= 2
+			out = render(opts)
+			if fits(append(slices.Clip(elided), limited(opts.limit))) {
+				break
+			}
+		}
+		elided = append(elided, limited(opts.limit))
+	}
+	if !fits(elided) {
+		elided = append(elided, "output truncated")
+		budget := max(opts.maxBytes-len(budgetNote(opts.maxBytes, elided)), 0)
+		out = out[:strings.LastIndex(out[:budget], "\n")+1]
+	}
+
+	return out + budgetNote(opts.maxBytes, elided)
+}
+
+// budgetNote is the note appended to output trimmed to fit maxBytes, listing what was elided.
+func budgetNote(maxBytes int, elided []string) string {
+	return fmt.Sprintf("\n[Trimmed to fit %d bytes: %s]\n", maxBytes, strings.Join(elided, "; "))
+}
+
 func formatLocation(locs []*profile.Location) string {
 	if len(locs) == 0 {
 		return ""
@@ -38,14 +237,24 @@ func formatLocation(locs []*profile.Location) string {
 
 // getTopSamples returns the profile data based on the specified view mode
 func getTopSamples(p *profile.Profile, n int, viewMode ViewMode, profileType string) string {
-	switch viewMode {
-	case ViewModeCum:
-		return getCumulativeView(p, n, profileType)
-	case ViewModeGraph:
-		return getGraphView(p, n, profileType)
-	default: // ViewModeFlat
-		return getFlatView(p, n, profileType)
-	}
+	return renderView(p, viewOptions{limit: n, mode: viewMode}, profileType)
+}
+
+// renderView renders the profile according to the view options, within their size budget.
+func renderView(p *profile.Profile, opts viewOptions, profileType string) string {
+	opts.total = profileTotal(p)
+	return renderWithBudget(opts, func(o viewOptions) string {
+		switch o.mode {
+		case ViewModeCum:
+			return getCumulativeView(p, o, profileType)
+		case ViewModeGraph:
+			return getGraphView(p, o, profileType)
+		case ViewModePackages:
+			return getPackagesView(p, o, profileType)
+		default: // ViewModeFlat
+			return getFlatView(p, o, profileType)
+		}
+	})
 }
 
 // aggregateSampleValues is a common function that aggregates profile sample values
@@ -75,26 +284,54 @@ func aggregateSampleValues(samples []*profile.Sample, getLocation func([]*profil
 }
 
 // getFlatView returns flat profile view (direct values for each location)
-func getFlatView(p *profile.Profile, n int, profileType string) string {
-	aggregatedSamples := aggregateSampleValues(p.Sample, formatLocation)
-	return formatResults("Flat view (direct values)", aggregatedSamples, n, profileType)
+func getFlatView(p *profile.Profile, opts viewOptions, profileType string) string {
+	aggregatedSamples := aggregateSampleValues(p.Sample, opts.flatLocation)
+	return formatResults("Flat view (direct values)", aggregatedSamples, opts, profileType)
 }
 
 // getCumulativeView returns cumulative profile view (including child functions)
-func getCumulativeView(p *profile.Profile, n int, profileType string) string {
-	getLocation := func(locs []*profile.Location) string {
-		if len(locs) == 0 {
-			return ""
-		}
-		return formatLocation([]*profile.Location{locs[0]})
+func getCumulativeView(p *profile.Profile, opts viewOptions, profileType string) string {
+	aggregatedSamples := aggregateSampleValues(p.Sample, opts.cumulativeLocation)
+	return formatResults("Cumulative view (including children)", aggregatedSamples, opts, profileType)
+}
+
+// flatLocation returns the location used to aggregate the flat view
+func (o viewOptions) flatLocation(locs []*profile.Location) string {
+	return formatLocation(o.frames(locs))
+}
+
+// cumulativeLocation returns the location used to aggregate the cumulative view
+func (o viewOptions) cumulativeLocation(locs []*profile.Location) string {
+	locs = o.frames(locs)
+	if len(locs) == 0 {
+		return ""
 	}
+	return formatLocation([]*profile.Location{locs[0]})
+}
 
-	aggregatedSamples := aggregateSampleValues(p.Sample, getLocation)
-	return formatResults("Cumulative view (including children)", aggregatedSamples, n, profileType)
+// renderDiffView renders delta profile data based on the specified view mode, within the size budget.
+// Flat and cumulative views list the largest increases and decreases separately;
+// the graph view orders nodes by the magnitude of their change.
+func renderDiffView(p *profile.Profile, opts viewOptions, profileType string) string {
+	opts.total = profileTotal(p)
+	return renderWithBudget(opts, func(o viewOptions) string {
+		switch o.mode {
+		case ViewModeCum:
+			aggregatedSamples := aggregateSampleValues(p.Sample, o.cumulativeLocation)
+			return formatDiffResults("Cumulative diff view (including children)", aggregatedSamples, o, profileType)
+		case ViewModeGraph:
+			return getGraphView(p, o, profileType)
+		case ViewModePackages:
+			return getPackagesView(p, o, profileType)
+		default: // ViewModeFlat
+			aggregatedSamples := aggregateSampleValues(p.Sample, o.flatLocation)
+			return formatDiffResults("Flat diff view (direct values)", aggregatedSamples, o, profileType)
+		}
+	})
 }
 
 // getGraphView returns a call graph view of the profile
-func getGraphView(p *profile.Profile, n int, profileType string) string {
+func getGraphView(p *profile.Profile, opts viewOptions, profileType string) string {
 	type nodeInfo struct {
 		values   []int64
 		children map[string][]int64
@@ -104,13 +341,14 @@ func getGraphView(p *profile.Profile, n int, profileType string) string {
 
 	// Build the call graph
 	for _, sample := range p.Sample {
-		if len(sample.Location) == 0 {
+		locs := opts.frames(sample.Location)
+		if len(locs) == 0 {
 			continue
 		}
 
 		// Process the call stack
-		for i := 0; i < len(sample.Location); i++ {
-			caller := formatLocation(sample.Location[i:])
+		for i := 0; i < len(locs); i++ {
+			caller := formatLocation(locs[i:])
 			if caller == "" {
 				continue
 			}
@@ -129,8 +367,8 @@ func getGraphView(p *profile.Profile, n int, profileType string) string {
 			}
 
 			// Add values to child relationships
-			if i+1 < len(sample.Location) {
-				callee := formatLocation(sample.Location[i+1:])
+			if i+1 < len(locs) {
+				callee := formatLocation(locs[i+1:])
 				if callee == "" {
 					continue
 				}
@@ -152,6 +390,9 @@ func getGraphView(p *profile.Profile, n int, profileType string) string {
 	}
 	var sortedNodes []nodePair
 	for name, info := range nodes {
+		if opts.hidden(info.values[0]) {
+			continue
+		}
 		var total int64
 		for _, v := range info.values {
 			total += v
@@ -159,20 +400,21 @@ func getGraphView(p *profile.Profile, n int, profileType string) string {
 		sortedNodes = append(sortedNodes, nodePair{name, total})
 	}
 	sort.Slice(sortedNodes, func(i, j int) bool {
-		return sortedNodes[i].total > sortedNodes[j].total
+		return abs(sortedNodes[i].total) > abs(sortedNodes[j].total)
 	})
 
 	// Build the output
+	names := opts.displayNames(slices.Collect(maps.Keys(nodes)))
 	var result strings.Builder
-	result.WriteString(fmt.Sprintf("Call graph view (top %d nodes)\n", n))
+	result.WriteString(fmt.Sprintf("Call graph view (top %d nodes)\n", opts.limit))
 	result.WriteString("Each node is followed by its children.\n\n")
 
-	for i := 0; i < n && i < len(sortedNodes); i++ {
+	for i := 0; i < opts.limit && i < len(sortedNodes); i++ {
 		nodeName := sortedNodes[i].name
 		nodeInfo := nodes[nodeName]
 
 		// Write node information
-		result.WriteString(fmt.Sprintf("Node: %s\n", nodeName))
+		result.WriteString(fmt.Sprintf("Node: %s\n", names[nodeName]))
 		result.WriteString(fmt.Sprintf("Values: %s\n", formatValues(nodeInfo.values, profileType)))
 
 		// Sort and write children
@@ -194,11 +436,14 @@ func getGraphView(p *profile.Profile, n int, profileType string) string {
 				for _, v := range sortedChildren[j].values {
 					totalJ += v
 				}
-				return totalI > totalJ
+				return abs(totalI) > abs(totalJ)
 			})
 
 			for _, child := range sortedChildren {
-				result.WriteString(fmt.Sprintf("  %s: %s\n", child.name, formatValues(child.values, profileType)))
+				if opts.hidden(child.values[0]) {
+					continue
+				}
+				result.WriteString(fmt.Sprintf("  %s: %s\n", names[child.name], formatValues(child.values, profileType)))
 			}
 		}
 		result.WriteString("\n")
@@ -207,7 +452,80 @@ func getGraphView(p *profile.Profile, n int, profileType string) string {
 	return result.String()
 }
 
-func formatResults(title string, samples map[string][]int64, n int, profileType string) string {
+// getPackagesView returns values rolled up per Go package (or module): flat values of the
+// functions in the package, and cumulative values of the samples whose stack passes through it.
+func getPackagesView(p *profile.Profile, opts viewOptions, profileType string) string {
+	unit := "package"
+	if opts.byModule {
+		unit = "module"
+	}
+
+	type groupInfo struct {
+		name string
+		flat []int64
+		cum  []int64
+	}
+	groups := make(map[string]*groupInfo)
+	group := func(name string, n int) *groupInfo {
+		g, ok := groups[name]
+		if !ok {
+			g = &groupInfo{name: name, flat: make([]int64, n), cum: make([]int64, n)}
+			groups[name] = g
+		}
+		return g
+	}
+
+	for _, sample := range p.Sample {
+		locs := opts.frames(sample.Location)
+		seen := make(map[string]bool)
+		for i, loc := range locs {
+			if len(loc.Line) == 0 || loc.Line[0].Function == nil {
+				continue
+			}
+			name := packageOf(loc.Line[0].Function.Name)
+			if opts.byModule {
+				name = moduleOf(name)
+			}
+			g := group(name, len(sample.Value))
+			if i == 0 {
+				for j, v := range sample.Value {
+					g.flat[j] += v
+				}
+			}
+			if !seen[name] {
+				seen[name] = true
+				for j, v := range sample.Value {
+					g.cum[j] += v
+				}
+			}
+		}
+	}
+
+	var sorted []*groupInfo
+	for _, g := range groups {
+		if !opts.hidden(g.cum[0]) {
+			sorted = append(sorted, g)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if abs(sorted[i].cum[0]) != abs(sorted[j].cum[0]) {
+			return abs(sorted[i].cum[0]) > abs(sorted[j].cum[0])
+		}
+		return sorted[i].name < sorted[j].name
+	})
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Packages view (values per %s, showing top %d)\n", unit, opts.limit))
+	result.WriteString("flat: in functions of the " + unit + "; cum: in stacks passing through the " + unit + ".\n\n")
+	for i := 0; i < opts.limit && i < len(sorted); i++ {
+		g := sorted[i]
+		result.WriteString(fmt.Sprintf("%s: flat %s; cum %s\n", g.name, formatValues(g.flat, profileType), formatValues(g.cum, profileType)))
+	}
+
+	return result.String()
+}
+
+func formatResults(title string, samples map[string][]int64, opts viewOptions, profileType string) string {
 	type sampleInfo struct {
 		location string
 		value    []int64
@@ -216,6 +534,9 @@ func formatResults(title string, samples map[string][]int64, n int, profileType
 	// Convert map to slice for sorting
 	var sampleSlice []sampleInfo
 	for loc, val := range samples {
+		if opts.hidden(val[0]) {
+			continue
+		}
 		sampleSlice = append(sampleSlice, sampleInfo{loc, val})
 	}
 
@@ -226,12 +547,61 @@ func formatResults(title string, samples map[string][]int64, n int, profileType
 
 	// Build the output string
 	var result strings.Builder
-	result.WriteString(fmt.Sprintf("%s (showing top %d locations)\n\n", title, n))
+	result.WriteString(fmt.Sprintf("%s (showing top %d locations)\n\n", title, opts.limit))
 
 	// Show top N samples
-	for i := 0; i < n && i < len(sampleSlice); i++ {
+	names := opts.displayNames(slices.Collect(maps.Keys(samples)))
+	for i := 0; i < opts.limit && i < len(sampleSlice); i++ {
 		sample := sampleSlice[i]
-		result.WriteString(fmt.Sprintf("%s: %s\n", sample.location, formatValues(sample.value, profileType)))
+		result.WriteString(fmt.Sprintf("%s: %s\n", names[sample.location], formatValues(sample.value, profileType)))
+	}
+
+	return result.String()
+}
+
+// formatDiffResults formats delta values, listing the top n increases
+// followed by the top n decreases.
+func formatDiffResults(title string, samples map[string][]int64, opts viewOptions, profileType string) string {
+	type sampleInfo struct {
+		location string
+		value    []int64
+	}
+
+	// Split into increases and decreases by the first value
+	var increased, decreased []sampleInfo
+	for loc, val := range samples {
+		switch {
+		case opts.hidden(val[0]):
+		case val[0] > 0:
+			increased = append(increased, sampleInfo{loc, val})
+		case val[0] < 0:
+			decreased = append(decreased, sampleInfo{loc, val})
+		}
+	}
+
+	// Sort both by magnitude in descending order
+	sort.Slice(increased, func(i, j int) bool {
+		return increased[i].value[0] > increased[j].value[0]
+	})
+	sort.Slice(decreased, func(i, j int) bool {
+		return decreased[i].value[0] < decreased[j].value[0]
+	})
+
+	// Build the output string
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("%s (showing top %d increases and decreases)\n\n", title, opts.limit))
+
+	names := opts.displayNames(slices.Collect(maps.Keys(samples)))
+	result.WriteString(fmt.Sprintf("Increased (%d locations):\n", len(increased)))
+	for i := 0; i < opts.limit && i < len(increased); i++ {
+		sample := increased[i]
+		result.WriteString(fmt.Sprintf("+ %s: %s\n", names[sample.location], formatValues(sample.value, profileType)))
+	}
+
+	result.WriteString(fmt.Sprintf("\nDecreased (%d locations):\n", len(decreased)))
+	for i := 0; i < opts.limit && i < len(decreased); i++ {
+		sample := decreased[i]
+		result.WriteString(fmt.Sprintf("- %s: %s\n", names[sample.location], formatValues(sample.value, profileType)))
 	}
 
 	return result.String()
@@ -246,16 +616,21 @@ func formatValues(values []int64, profileType string) string {
 	for i, v := range values {
 		var formatted string
 		switch profileType {
-		case ProfileTypeHeap:
+		case ProfileTypeHeap, ProfileTypeAllocs:
+			// alloc_objects, alloc_space, inuse_objects, inuse_space
 			switch i {
 			case 0:
-				formatted = fmt.Sprintf("%s in use", formatValue(v))
+				formatted = fmt.Sprintf("%d objects allocated", v)
 			case 1:
-				formatted = fmt.Sprintf("%s total alloc", formatValue(v))
+				formatted = fmt.Sprintf("%s allocated", formatValue(v))
+			case 2:
+				formatted = fmt.Sprintf("%d objects in use", v)
+			case 3:
+				formatted = fmt.Sprintf("%s in use", formatValue(v))
 			default:
 				formatted = formatValue(v)
 			}
-		case ProfileTypeBlock:
+		case ProfileTypeBlock, ProfileTypeMutex:
 			switch i {
 			case 0:
 				formatted = fmt.Sprintf("%d contentions", v)
@@ -265,9 +640,13 @@ func formatValues(values []int64, profileType string) string {
 				formatted = formatValue(v)
 			}
 		case ProfileTypeCPU:
-			if i == 0 {
+			// samples, cpu
+			switch i {
+			case 0:
+				formatted = fmt.Sprintf("%d samples", v)
+			case 1:
 				formatted = fmt.Sprintf("%v CPU time", time.Duration(v))
-			} else {
+			default:
 				formatted = formatValue(v)
 			}
 		default:
@@ -288,6 +667,10 @@ func formatValue(v int64) string {
 		_TB = _GB * 1024
 	)
 
+	if v < 0 && v != math.MinInt64 {
+		return "-" + formatValue(-v)
+	}
+
 	switch {
 	case v > _TB:
 		return fmt.Sprintf("%.2fTB", float64(v)/float64(_TB))
@@ -301,3 +684,10 @@ func formatValue(v int64) string {
 		return fmt.Sprintf("%dB", v)
 	}
 }
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
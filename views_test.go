@@ -0,0 +1,296 @@
+package pprofmcpagent
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// stackSample is a sample of a test profile: its stack from leaf to root, and its value.
+type stackSample struct {
+	stack []string
+	value int64
+}
+
+// stackProfile returns a CPU profile with one location per frame; frames of the
+// same function share their location. Functions are in file <package>.go.
+func stackProfile(samples ...stackSample) *profile.Profile {
+	p := &profile.Profile{SampleType: cpuSampleTypes}
+	locs := make(map[string]*profile.Location)
+	for _, s := range samples {
+		var stack []*profile.Location
+		for _, name := range s.stack {
+			loc, ok := locs[name]
+			if !ok {
+				fn := &profile.Function{ID: uint64(len(p.Function) + 1), Name: name, Filename: packageOf(name) + ".go"}
+				loc = &profile.Location{ID: uint64(len(p.Location) + 1), Line: []profile.Line{{Function: fn, Line: 1}}}
+				p.Function = append(p.Function, fn)
+				p.Location = append(p.Location, loc)
+				locs[name] = loc
+			}
+			stack = append(stack, loc)
+		}
+		p.Sample = append(p.Sample, &profile.Sample{Location: stack, Value: []int64{s.value, s.value * 10000000}})
+	}
+	return p
+}
+
+func TestFormatValues(t *testing.T) {
+	tests := []struct {
+		profileType string
+		values      []int64
+		want        string
+	}{
+		{ProfileTypeHeap, []int64{3, 4096, 1, 2048}, "3 objects allocated, 4.00KB allocated, 1 objects in use, 2.00KB in use"},
+		{ProfileTypeAllocs, []int64{3, 4096, 1, 2048}, "3 objects allocated, 4.00KB allocated, 1 objects in use, 2.00KB in use"},
+		{ProfileTypeCPU, []int64{5, 50000000}, "5 samples, 50ms CPU time"},
+		{ProfileTypeBlock, []int64{2, 1500000}, "2 contentions, 1.5ms delay"},
+		{ProfileTypeMutex, []int64{2, 1500000}, "2 contentions, 1.5ms delay"},
+		{ProfileTypeHeap, nil, "no values"},
+	}
+	for _, tt := range tests {
+		if got := formatValues(tt.values, tt.profileType); got != tt.want {
+			t.Errorf("formatValues(%v, %s) = %q, want %q", tt.values, tt.profileType, got, tt.want)
+		}
+	}
+}
+
+func TestRenderViewLabels(t *testing.T) {
+	contentionTypes := []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}}
+	tests := []struct {
+		name        string
+		profileType string
+		p           *profile.Profile
+		mode        ViewMode
+		want        string
+	}{
+		{"heap flat", ProfileTypeHeap, heapProfile(map[string]int64{"main.alloc": 3}), ViewModeFlat,
+			"main.alloc:0: 3 objects allocated, 3.00KB allocated, 3 objects in use, 3.00KB in use"},
+		{"allocs cumulative", ProfileTypeAllocs, heapProfile(map[string]int64{"main.alloc": 3}), ViewModeCum,
+			"main.alloc:0: 3 objects allocated, 3.00KB allocated, 3 objects in use, 3.00KB in use"},
+		{"cpu flat", ProfileTypeCPU, cpuProfile(map[string]int64{"main.spin": 5}), ViewModeFlat,
+			"main.spin:0: 5 samples, 50ms CPU time"},
+		{"mutex flat", ProfileTypeMutex, flatProfile(contentionTypes, map[string][]int64{"main.lock": {2, 1500000}}), ViewModeFlat,
+			"main.lock:0: 2 contentions, 1.5ms delay"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := renderView(tt.p, viewOptions{limit: 10, mode: tt.mode}, tt.profileType)
+			if !strings.Contains(out, tt.want+"\n") {
+				t.Errorf("view does not contain %q:\n%s", tt.want, out)
+			}
+		})
+	}
+}
+
+func TestRenderViewAggregatesFullNames(t *testing.T) {
+	samples := []stackSample{
+		{[]string{"github.com/a/util.F", "github.com/a/app.Run", "main.main"}, 30},
+		{[]string{"github.com/b/util.F", "github.com/a/app.Run", "main.main"}, 20},
+		{[]string{"github.com/a/app.Run", "main.main"}, 10},
+	}
+	// Small leaf functions with long import paths, shown only by the budget test.
+	for i := range 30 {
+		samples = append(samples, stackSample{[]string{fmt.Sprintf("github.com/example/service/internal/handlers/pkg%02d.Handle", i), "main.main"}, 1})
+	}
+	p := stackProfile(samples...)
+	tests := []struct {
+		name     string
+		opts     viewOptions
+		contains []string
+		absent   []string
+	}{
+		{
+			name:     "flat",
+			opts:     viewOptions{limit: 3, mode: ViewModeFlat},
+			contains: []string{"github.com/a/util.F:1: 30 samples", "github.com/b/util.F:1: 20 samples", "github.com/a/app.Run:1: 10 samples"},
+		},
+		{
+			name:     "flat trimmed",
+			opts:     viewOptions{limit: 3, mode: ViewModeFlat, trimNames: true},
+			contains: []string{"github.com/a/util.F:1: 30 samples", "github.com/b/util.F:1: 20 samples", "\napp.Run:1: 10 samples"},
+			absent:   []string{"\nutil.F", "github.com/a/app.Run"},
+		},
+		{
+			name:     "graph trimmed",
+			opts:     viewOptions{limit: 4, mode: ViewModeGraph, trimNames: true},
+			contains: []string{"Node: github.com/a/util.F:1\nValues: 30 samples", "Node: github.com/b/util.F:1\nValues: 20 samples", "Node: app.Run:1\nValues: 60 samples", "  app.Run:1: 30 samples"},
+			absent:   []string{"Node: util.F", "Values: 50 samples"},
+		},
+		{
+			name:     "budget",
+			opts:     viewOptions{limit: 100, mode: ViewModeFlat, maxBytes: 2200},
+			contains: []string{"github.com/a/util.F:1: 30 samples", "github.com/b/util.F:1: 20 samples", "\napp.Run:1: 10 samples", "\npkg07.Handle:1: 1 samples", "[Trimmed to fit 2200 bytes: function names trimmed]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := renderView(p, tt.opts, ProfileTypeCPU)
+			for _, s := range tt.contains {
+				if !strings.Contains(out, s) {
+					t.Errorf("view does not contain %q:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.absent {
+				if strings.Contains(out, s) {
+					t.Errorf("view contains %q:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderWithBudget(t *testing.T) {
+	// render prints one line per shown location: 100 locations, of which 20 are
+	// runtime frames and fewer remain as larger fractions are hidden. Lines are
+	// 100 bytes, or 50 with trimmed names.
+	render := func(o viewOptions) string {
+		n := 100
+		if o.collapseRuntime {
+			n = 80
+		}
+		if o.nodeFraction > 0 {
+			n -= int(o.nodeFraction * 1000)
+		}
+		n = min(n, o.limit)
+		width := 100
+		if o.trimNames {
+			width = 50
+		}
+		return strings.Repeat(strings.Repeat("x", width-1)+"\n", n)
+	}
+
+	tests := []struct {
+		name     string
+		opts     viewOptions
+		wantLen  int
+		wantNote string
+	}{
+		{"unlimited", viewOptions{limit: 100}, 10000, ""},
+		{"fits", viewOptions{limit: 100, maxBytes: 10000}, 10000, ""},
+		{"trimmed names", viewOptions{limit: 100, maxBytes: 5256}, 5000, "function names trimmed"},
+		{"note counted", viewOptions{limit: 100, maxBytes: 5020}, 4000, "function names trimmed; runtime frames collapsed into their callers"},
+		{"collapsed runtime", viewOptions{limit: 100, maxBytes: 4256}, 4000, "function names trimmed; runtime frames collapsed into their callers"},
+		{"already trimmed", viewOptions{limit: 100, maxBytes: 4256, trimNames: true}, 4000, "runtime frames collapsed into their callers"},
+		{"hidden locations", viewOptions{limit: 100, maxBytes: 3756}, 3500, "function names trimmed; runtime frames collapsed into their callers; locations below 1% of the total hidden"},
+		{"lowered limit", viewOptions{limit: 100, maxBytes: 1256}, 600, "function names trimmed; runtime frames collapsed into their callers; locations below 5% of the total hidden; limited to the top 12 locations"},
+		{"truncated", viewOptions{limit: 100, maxBytes: 200}, 0, "function names trimmed; runtime frames collapsed into their callers; locations below 5% of the total hidden; limited to the top 1 locations; output truncated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := renderWithBudget(tt.opts, render)
+			body, note, _ := strings.Cut(out, "\n[Trimmed to fit ")
+			if len(body) != tt.wantLen {
+				t.Errorf("output is %d bytes, want %d", len(body), tt.wantLen)
+			}
+			if tt.wantNote == "" {
+				if note != "" {
+					t.Errorf("unexpected note %q", note)
+				}
+				return
+			}
+			if want := fmt.Sprintf("%d bytes: %s]\n", tt.opts.maxBytes, tt.wantNote); note != want {
+				t.Errorf("note = %q, want %q", note, want)
+			}
+			if len(out) > tt.opts.maxBytes {
+				t.Errorf("output is %d bytes, above the budget of %d", len(out), tt.opts.maxBytes)
+			}
+		})
+	}
+}
+
+func TestViewParamsBudget(t *testing.T) {
+	tests := []struct {
+		arguments map[string]interface{}
+		want      int
+	}{
+		{map[string]interface{}{}, 0},
+		{map[string]interface{}{"max_bytes": 4096.0}, 4096},
+		{map[string]interface{}{"max_tokens": 2000.0}, 8000},
+		{map[string]interface{}{"max_bytes": 4096.0, "max_tokens": 2000.0}, 4096},
+		{map[string]interface{}{"max_bytes": 100.0}, minBudgetBytes},
+		{map[string]interface{}{"max_tokens": 10.0}, minBudgetBytes},
+	}
+	for _, tt := range tests {
+		var request mcp.CallToolRequest
+		request.Params.Arguments = tt.arguments
+		if got := viewParams(request).maxBytes; got != tt.want {
+			t.Errorf("viewParams(%v) budget = %d, want %d", tt.arguments, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesPackage(t *testing.T) {
+	tests := []struct {
+		pkg, pattern string
+		want         bool
+	}{
+		{"net/http", "net/http", true},
+		{"net/http/httputil", "net/http", true},
+		{"net/httptest", "net/http", false},
+		{"runtime", "std", true},
+		{"encoding/json", "std", true},
+		{"main", "std", false},
+		{"github.com/org/repo/pkg", "std", false},
+		{"github.com/org/repo/pkg", "github.com/org", true},
+		{"github.com/org/repository", "github.com/org/repo", false},
+	}
+	for _, tt := range tests {
+		if got := matchesPackage(tt.pkg, tt.pattern); got != tt.want {
+			t.Errorf("matchesPackage(%q, %q) = %t, want %t", tt.pkg, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestRenderViewSkipPackages(t *testing.T) {
+	p := stackProfile(
+		stackSample{[]string{"runtime.gopark", "sync.(*Cond).Wait", "main.worker", "main.main"}, 30},
+		stackSample{[]string{"runtime.mallocgc", "encoding/json.Marshal", "github.com/x/lib.Encode", "main.handler", "main.main"}, 20},
+		stackSample{[]string{"runtime.gcBgMarkWorker", "runtime.goexit"}, 10},
+	)
+	row := func(fn string, n int64) string {
+		return fn + ":1: " + formatValues([]int64{n, n * 10000000}, ProfileTypeCPU)
+	}
+	tests := []struct {
+		name string
+		opts viewOptions
+		want []string
+	}{
+		{
+			name: "none",
+			opts: viewOptions{},
+			want: []string{row("runtime.gopark", 30), row("runtime.mallocgc", 20), row("runtime.gcBgMarkWorker", 10)},
+		},
+		{
+			name: "runtime collapsed",
+			opts: viewOptions{collapseRuntime: true},
+			want: []string{row("sync.(*Cond).Wait", 30), row("encoding/json.Marshal", 20), row("runtime.gcBgMarkWorker", 10)},
+		},
+		{
+			name: "standard library",
+			opts: viewOptions{skipPackages: defaultSkipPackages},
+			want: []string{row("main.worker", 30), row("github.com/x/lib.Encode", 20), row("runtime.gcBgMarkWorker", 10)},
+		},
+		{
+			name: "standard library and a module",
+			opts: viewOptions{skipPackages: []string{"std", "github.com/x"}},
+			want: []string{row("main.worker", 30), row("main.handler", 20), row("runtime.gcBgMarkWorker", 10)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.limit = 10
+			tt.opts.mode = ViewModeFlat
+			out := renderView(p, tt.opts, ProfileTypeCPU)
+			_, body, _ := strings.Cut(out, "\n\n")
+			got := strings.Split(strings.TrimSpace(body), "\n")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("flat view = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}